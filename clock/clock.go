@@ -0,0 +1,85 @@
+/*
+Clock provides the time to the time based stages of a pipeline, so tests can replace the real time with a Fake advanced by hand.
+
+	fake := clock.NewFake(time.Unix(0, 0))
+	p := pipeline.NewPipeline().WithClock(fake)
+	throttle := pipeline.Throttle(p, input, time.Minute)
+	...
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+*/
+package clock
+
+import "time"
+
+// Clock is the subset of the time package used by the stages.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	// Return a channel which receives the time once d has passed.
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a time.Timer, with the channel returned by C.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is a time.Ticker, with the channel returned by C.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+	Reset(d time.Duration)
+}
+
+type realClock struct{}
+
+// Return the clock of the time package.
+func Real() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
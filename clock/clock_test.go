@@ -0,0 +1,136 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Unix(0, 0)
+
+func TestFakeTimer(t *testing.T) {
+	fake := NewFake(epoch)
+
+	timer := fake.NewTimer(time.Minute)
+	after := fake.After(2 * time.Minute)
+
+	fake.Advance(59 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("fired early")
+	default:
+	}
+
+	fake.Advance(2 * time.Minute)
+	if fired := <-timer.C(); !fired.Equal(epoch.Add(time.Minute)) {
+		t.Fatalf("fired %v", fired)
+	}
+	if fired := <-after; !fired.Equal(epoch.Add(2 * time.Minute)) {
+		t.Fatalf("after %v", fired)
+	}
+	if !fake.Now().Equal(epoch.Add(179*time.Second)) || fake.Waiters() != 0 {
+		t.Fatalf("now %v waiters %d", fake.Now(), fake.Waiters())
+	}
+}
+
+func TestFakeTimerStopReset(t *testing.T) {
+	fake := NewFake(epoch)
+
+	timer := fake.NewTimer(time.Minute)
+	if !timer.Stop() || timer.Stop() {
+		t.Fatal("stop")
+	}
+	fake.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+
+	if timer.Reset(time.Second) {
+		t.Fatal("reset stopped timer active")
+	}
+	fake.Advance(time.Second)
+	<-timer.C()
+
+	if timer := fake.NewTimer(0); !(<-timer.C()).Equal(fake.Now()) {
+		t.Fatal("zero timer")
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	fake := NewFake(epoch)
+
+	ticker := fake.NewTicker(time.Second)
+	fake.Advance(time.Second)
+	if tick := <-ticker.C(); !tick.Equal(epoch.Add(time.Second)) {
+		t.Fatalf("tick %v", tick)
+	}
+
+	// Ticks which are not received are dropped, as with a time.Ticker.
+	fake.Advance(10 * time.Second)
+	if tick := <-ticker.C(); !tick.Equal(epoch.Add(2 * time.Second)) {
+		t.Fatalf("tick %v", tick)
+	}
+	select {
+	case tick := <-ticker.C():
+		t.Fatalf("tick %v", tick)
+	default:
+	}
+
+	ticker.Reset(time.Minute)
+	fake.Advance(time.Minute)
+	<-ticker.C()
+
+	ticker.Stop()
+	if fake.Waiters() != 0 {
+		t.Fatalf("waiters %d", fake.Waiters())
+	}
+}
+
+func TestFakeSleep(t *testing.T) {
+	fake := NewFake(epoch)
+
+	slept := make(chan time.Duration)
+	go func() {
+		start := fake.Now()
+		fake.Sleep(10 * time.Minute)
+		slept <- fake.Since(start)
+	}()
+
+	fake.BlockUntil(1)
+	fake.Advance(10 * time.Minute)
+	if d := <-slept; d != 10*time.Minute {
+		t.Fatalf("slept %v", d)
+	}
+}
+
+func TestReal(t *testing.T) {
+	c := Real()
+
+	start := c.Now()
+	<-c.NewTimer(time.Millisecond).C()
+	ticker := c.NewTicker(time.Millisecond)
+	<-ticker.C()
+	ticker.Stop()
+	if c.Since(start) < 2*time.Millisecond {
+		t.Fatalf("since %v", c.Since(start))
+	}
+}
+
+func TestFakeFired(t *testing.T) {
+	fake := NewFake(epoch)
+
+	timer := fake.NewTimer(time.Second)
+	stopped := fake.NewTimer(time.Second)
+	fake.Advance(time.Second)
+	if fired := fake.Fired(); fired != 2 {
+		t.Fatalf("fired %d", fired)
+	}
+
+	// A stopped timer's time is not expected to be received.
+	stopped.Stop()
+	<-timer.C()
+	if fired := fake.Fired(); fired != 0 {
+		t.Fatalf("fired %d", fired)
+	}
+}
@@ -0,0 +1,220 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+Fake is a Clock whose time only moves when Advance or Set is called, firing the timers and tickers which fall due.
+
+A stage reads the clock in its own goroutine, so call BlockUntil before Advance to be sure the stage is waiting on the clock,
+otherwise the time may pass before the stage starts its timer, and wait for Fired to reach 0 after Advance to be sure the stage has received its time.
+*/
+type Fake struct {
+	lock *sync.Mutex
+	// Signalled each time a waiter is added or removed, guarded by lock.
+	changed *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+	// The waiters which have sent a time which may not yet be received, see Fired.
+	fired []*fakeWaiter
+}
+
+// fakeWaiter is a timer or ticker waiting for the fake time to reach at.
+type fakeWaiter struct {
+	fake *Fake
+	c    chan time.Time
+	at   time.Time
+	// The period of a ticker, 0 for a timer.
+	period time.Duration
+}
+
+// Return a new fake clock starting at now.
+func NewFake(now time.Time) *Fake {
+	lock := &sync.Mutex{}
+	return &Fake{lock: lock, changed: sync.NewCond(lock), now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// Block until the fake time has advanced by d.
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	w := &fakeWaiter{fake: f, c: make(chan time.Time, 1)}
+	w.Reset(d)
+	return w
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	w := &fakeWaiter{fake: f, c: make(chan time.Time, 1), period: d}
+	w.Reset(d)
+	return fakeTicker{w}
+}
+
+// Move the time forward by d, firing each timer and tick which falls due in order.
+func (f *Fake) Advance(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.advance(f.now.Add(d))
+}
+
+// Move the time forward to t, see Advance.
+func (f *Fake) Set(t time.Time) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.advance(t)
+}
+
+// Return the number of timers and tickers waiting on the clock.
+func (f *Fake) Waiters() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.waiters)
+}
+
+// Block until at least n timers and tickers are waiting on the clock.
+func (f *Fake) BlockUntil(n int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for len(f.waiters) < n {
+		f.changed.Wait()
+	}
+}
+
+// Return the number of times sent by fired timers and tickers which have not yet been received.
+// Once it is 0 every goroutine woken by Advance has been given its time.
+func (f *Fake) Fired() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	pending := f.fired[:0]
+	for _, w := range f.fired {
+		if len(w.c) > 0 {
+			pending = append(pending, w)
+		}
+	}
+	f.fired = pending
+	return len(f.fired)
+}
+
+// Stop counting the time sent by w as Fired, its owner has stopped or reset it, the caller holds the lock.
+func (f *Fake) unfire(w *fakeWaiter) {
+	for i, other := range f.fired {
+		if other == w {
+			f.fired = append(f.fired[:i], f.fired[i+1:]...)
+			return
+		}
+	}
+}
+
+// The caller holds the lock.
+func (f *Fake) advance(to time.Time) {
+	for len(f.waiters) > 0 && !f.waiters[0].at.After(to) {
+		w := f.waiters[0]
+		f.now = w.at
+		f.remove(w)
+		w.fire()
+	}
+	if to.After(f.now) {
+		f.now = to
+	}
+}
+
+// Add w in the order of when it is due, the caller holds the lock.
+func (f *Fake) add(w *fakeWaiter) {
+	i := sort.Search(len(f.waiters), func(i int) bool { return f.waiters[i].at.After(w.at) })
+	f.waiters = append(f.waiters, nil)
+	copy(f.waiters[i+1:], f.waiters[i:])
+	f.waiters[i] = w
+	f.changed.Broadcast()
+}
+
+// Remove w, returning whether it was waiting, the caller holds the lock.
+func (f *Fake) remove(w *fakeWaiter) bool {
+	for i, other := range f.waiters {
+		if other == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			f.changed.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+// Send the time, dropping it if the last is not yet received as a time.Ticker does, and re-arm a ticker, the caller holds the lock.
+func (w *fakeWaiter) fire() {
+	select {
+	case w.c <- w.at:
+		w.fake.fired = append(w.fake.fired, w)
+	default:
+	}
+	if w.period > 0 {
+		w.at = w.at.Add(w.period)
+		w.fake.add(w)
+	}
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+func (w *fakeWaiter) Stop() bool {
+	w.fake.lock.Lock()
+	defer w.fake.lock.Unlock()
+	w.fake.unfire(w)
+	return w.fake.remove(w)
+}
+
+// Reset the timer to fire after d, or the ticker to tick every d, from the fake now.
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	w.fake.lock.Lock()
+	defer w.fake.lock.Unlock()
+
+	w.fake.unfire(w)
+	active := w.fake.remove(w)
+	if w.period > 0 {
+		w.period = d
+	}
+	w.at = w.fake.now.Add(d)
+	if d <= 0 && w.period == 0 {
+		w.fire()
+		return active
+	}
+	w.fake.add(w)
+	return active
+}
+
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeWaiter.Stop()
+}
+
+func (t fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+	t.fakeWaiter.Reset(d)
+}
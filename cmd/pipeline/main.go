@@ -0,0 +1,303 @@
+/*
+Pipeline runs declarative JSON pipeline specs, see package spec.
+
+	pipeline run spec.json        run the spec, stages reading or writing "-" use stdin and stdout
+	pipeline validate spec.json   check the spec without running it
+	pipeline graph spec.json      print the stages and how they are connected
+	pipeline stats spec.json      run the spec then print the final stage metrics to stderr
+	pipeline stages               list the available stage types
+
+The exit code is 0 on success, 1 if the pipeline failed and 2 if the command or spec is invalid.
+An interrupt or termination signal closes the pipeline, which then exits with 1.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"example.com/m/v2/logging"
+	"example.com/m/v2/spec"
+	v3 "example.com/m/v2/v3"
+)
+
+const (
+	exitOK      = 0
+	exitFailed  = 1
+	exitInvalid = 2
+)
+
+const usage = `usage: pipeline <command> [arguments]
+
+commands:
+  run [-quiet] spec.json    run the spec
+  validate spec.json        check the spec
+  graph spec.json           print the stages and their connections
+  stats [-json] spec.json   run the spec, then print the stage metrics to stderr
+  stages                    list the available stage types
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// Run the command given by args, returning the exit code.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitInvalid
+	}
+
+	command := command{ctx, spec.DefaultRegistry(), stdin, stdout, stderr}
+
+	switch args[0] {
+	case "run":
+		return command.run(args[1:])
+	case "validate":
+		return command.validate(args[1:])
+	case "graph":
+		return command.graph(args[1:])
+	case "stats":
+		return command.stats(args[1:])
+	case "stages":
+		return command.stages(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "pipeline: unknown command %q\n\n%s", args[0], usage)
+		return exitInvalid
+	}
+}
+
+type command struct {
+	ctx      context.Context
+	registry *spec.Registry
+	stdin    io.Reader
+	stdout   io.Writer
+	stderr   io.Writer
+}
+
+func (command command) run(args []string) int {
+	flags := command.flags("run")
+	quiet := flags.Bool("quiet", false, "do not log the sink counts")
+	path, ok := command.parse(flags, args)
+	if !ok {
+		return exitInvalid
+	}
+
+	plan, ok := command.plan(path)
+	if !ok {
+		return exitInvalid
+	}
+
+	built, code := command.execute(plan)
+	if code != exitOK {
+		return code
+	}
+
+	if !*quiet {
+		logger := built.Pipeline.Logger()
+		for _, stage := range plan.Stages {
+			if count, ok := built.Counts[stage.ID]; ok {
+				logger.Info("sink done", "spec", plan.Name, "id", stage.ID, "count", count)
+			}
+		}
+	}
+	return exitOK
+}
+
+func (command command) validate(args []string) int {
+	path, ok := command.parse(command.flags("validate"), args)
+	if !ok {
+		return exitInvalid
+	}
+
+	if _, ok := command.plan(path); !ok {
+		return exitInvalid
+	}
+	fmt.Fprintf(command.stdout, "%s: ok\n", path)
+	return exitOK
+}
+
+func (command command) graph(args []string) int {
+	path, ok := command.parse(command.flags("graph"), args)
+	if !ok {
+		return exitInvalid
+	}
+
+	plan, ok := command.plan(path)
+	if !ok {
+		return exitInvalid
+	}
+	fmt.Fprint(command.stdout, plan)
+	return exitOK
+}
+
+func (command command) stats(args []string) int {
+	flags := command.flags("stats")
+	asJSON := flags.Bool("json", false, "print the metrics as JSON")
+	path, ok := command.parse(flags, args)
+	if !ok {
+		return exitInvalid
+	}
+
+	plan, ok := command.plan(path)
+	if !ok {
+		return exitInvalid
+	}
+
+	built, code := command.execute(plan)
+	if built == nil {
+		return code
+	}
+
+	// Print the metrics even if the pipeline failed, they show where it stopped.
+	snapshot := built.Pipeline.Metrics().Snapshot()
+	if *asJSON {
+		encoder := json.NewEncoder(command.stderr)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(snapshot)
+		return code
+	}
+
+	w := tabwriter.NewWriter(command.stderr, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTAGE\tIN\tOUT\tERRORS\tBLOCKED RECEIVE\tBLOCKED SEND\tCALLS\tCALL TIME")
+	for _, stage := range snapshot {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%v\t%v\t%d\t%v\n",
+			stage.ID, stage.Name, stage.In, stage.Out, stage.Errors,
+			stage.BlockedReceive, stage.BlockedSend, stage.Calls.Count, stage.Calls.Sum)
+	}
+	w.Flush()
+	return code
+}
+
+func (command command) stages(args []string) int {
+	if !command.parseNone(command.flags("stages"), args) {
+		return exitInvalid
+	}
+
+	w := tabwriter.NewWriter(command.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tIN\tOUT\tPARAMETERS\tHELP")
+	for _, factory := range command.registry.Factories() {
+		params := ""
+		for i, param := range factory.Params {
+			if i > 0 {
+				params += " "
+			}
+			params += fmt.Sprintf("%s:%s", param.Name, param.Kind)
+			if param.Required {
+				params += "!"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", factory.Name, factory.In, factory.Out, params, factory.Help)
+	}
+	w.Flush()
+	return exitOK
+}
+
+// built is a pipeline which has run to completion.
+type built struct {
+	Pipeline v3.Pipeline
+	// The count of elements consumed by each sink.
+	Counts map[string]int
+}
+
+// Build and run the plan until every sink is done, the pipeline fails or the command context is done.
+// Returns nil if the plan could not be built.
+func (command command) execute(plan *spec.Plan) (*built, int) {
+	pipeline := v3.NewPipeline(v3.WithLogger(logging.NewDefault()))
+	defer pipeline.Close()
+
+	go func() {
+		select {
+		case <-command.ctx.Done():
+			pipeline.CloseWithError(command.ctx.Err())
+		case <-pipeline.Control():
+		}
+	}()
+
+	b, err := plan.Build(spec.Env{Pipeline: pipeline, Stdin: command.stdin, Stdout: command.stdout})
+	if err != nil {
+		command.fail(err)
+		return nil, exitFailed
+	}
+
+	counts, err := b.Wait()
+	if err != nil {
+		command.fail(err)
+		return &built{pipeline, counts}, exitFailed
+	}
+	return &built{pipeline, counts}, exitOK
+}
+
+// Load and check the spec, printing every problem found.
+func (command command) plan(path string) (*spec.Plan, bool) {
+	s, err := spec.LoadFile(path)
+	if err != nil {
+		command.fail(err)
+		return nil, false
+	}
+
+	plan, err := s.Plan(command.registry)
+	if err != nil {
+		fmt.Fprintf(command.stderr, "pipeline: %s is invalid:\n", path)
+		for _, err := range unjoin(err) {
+			fmt.Fprintf(command.stderr, "  %v\n", err)
+		}
+		return nil, false
+	}
+	return plan, true
+}
+
+func (command command) flags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(command.stderr)
+	return flags
+}
+
+// Parse the flags, returning the single spec path argument.
+func (command command) parse(flags *flag.FlagSet, args []string) (string, bool) {
+	if err := flags.Parse(args); err != nil {
+		return "", false
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintf(command.stderr, "pipeline: %s expects a spec file\n\n%s", flags.Name(), usage)
+		return "", false
+	}
+	return flags.Arg(0), true
+}
+
+// Parse the flags for a command which takes no arguments.
+func (command command) parseNone(flags *flag.FlagSet, args []string) bool {
+	if err := flags.Parse(args); err != nil {
+		return false
+	}
+	if flags.NArg() != 0 {
+		fmt.Fprintf(command.stderr, "pipeline: %s takes no arguments\n\n%s", flags.Name(), usage)
+		return false
+	}
+	return true
+}
+
+func (command command) fail(err error) {
+	fmt.Fprintf(command.stderr, "pipeline: %v\n", err)
+}
+
+// Return the errors joined in err, or err itself.
+func unjoin(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
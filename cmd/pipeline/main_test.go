@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const errorsSpec = `{
+	"name": "errors",
+	"stages": [
+		{"id": "read", "type": "lines"},
+		{"id": "parse", "type": "json-decode", "input": "read"},
+		{"id": "errors", "type": "filter", "input": "parse", "params": {"field": "level", "equals": "error"}},
+		{"id": "write", "type": "jsonl-sink", "input": "errors"}
+	]
+}`
+
+func writeSpec(t *testing.T, spec string) string {
+	path := filepath.Join(t.TempDir(), "spec.json")
+	if err := os.WriteFile(path, []byte(spec), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func runCommand(args []string, stdin string) (int, string, string) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := run(context.Background(), args, strings.NewReader(stdin), stdout, stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun(t *testing.T) {
+	path := writeSpec(t, errorsSpec)
+
+	code, stdout, stderr := runCommand([]string{"run", "-quiet", path}, "{\"level\":\"info\"}\n{\"level\":\"error\",\"msg\":\"a\"}\n")
+	if code != exitOK {
+		t.Fatalf("code %d %s", code, stderr)
+	}
+	if stdout != "{\"level\":\"error\",\"msg\":\"a\"}\n" {
+		t.Fatalf("stdout %q", stdout)
+	}
+}
+
+func TestRunFailed(t *testing.T) {
+	path := writeSpec(t, errorsSpec)
+
+	code, _, stderr := runCommand([]string{"run", path}, "not json\n")
+	if code != exitFailed {
+		t.Fatalf("code %d", code)
+	}
+	if !strings.Contains(stderr, "pipeline: json-decode [not json]") {
+		t.Fatalf("stderr %q", stderr)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	code, stdout, stderr := runCommand([]string{"validate", writeSpec(t, errorsSpec)}, "")
+	if code != exitOK || !strings.HasSuffix(stdout, ": ok\n") {
+		t.Fatalf("code %d %q %q", code, stdout, stderr)
+	}
+
+	invalid := writeSpec(t, `{"stages": [{"id": "a", "type": "nope"}, {"id": "b", "type": "limit", "input": "a"}]}`)
+	code, _, stderr = runCommand([]string{"validate", invalid}, "")
+	if code != exitInvalid {
+		t.Fatalf("code %d", code)
+	}
+	for _, s := range []string{`stage "a": unknown stage type "nope"`, `stage "b": invalid parameters`} {
+		if !strings.Contains(stderr, s) {
+			t.Fatalf("stderr %q missing %q", stderr, s)
+		}
+	}
+}
+
+func TestGraph(t *testing.T) {
+	code, stdout, _ := runCommand([]string{"graph", writeSpec(t, errorsSpec)}, "")
+	if code != exitOK {
+		t.Fatalf("code %d", code)
+	}
+	if !strings.Contains(stdout, "parse json-decode <- read [string -> json]\n") {
+		t.Fatalf("stdout %q", stdout)
+	}
+}
+
+func TestStats(t *testing.T) {
+	code, _, stderr := runCommand([]string{"stats", writeSpec(t, errorsSpec)}, "{\"level\":\"error\"}\n")
+	if code != exitOK {
+		t.Fatalf("code %d %s", code, stderr)
+	}
+	for _, s := range []string{"LineSource", "ForEachTerminal"} {
+		if !strings.Contains(stderr, s) {
+			t.Fatalf("stderr %q missing %q", stderr, s)
+		}
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{{}, {"nope"}, {"run"}, {"graph", "a.json", "b.json"}} {
+		if code, _, _ := runCommand(args, ""); code != exitInvalid {
+			t.Fatalf("%v code %d", args, code)
+		}
+	}
+}
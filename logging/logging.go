@@ -0,0 +1,40 @@
+/*
+Logging provides the default logger shared by the pipeline packages.
+
+The level is read from the PIPELINE_LOG_LEVEL environment variable, one of DEBUG, INFO, WARN or ERROR, defaulting to INFO.
+Pipelines should be given their own logger, the default is only used when one is not.
+
+Stage loggers carry the same attributes in every package.
+
+	logger.With(slog.String(logging.StageKey, "Mapper"), slog.String(logging.StageIDKey, id))
+*/
+package logging
+
+import (
+	"log/slog"
+	"os"
+)
+
+const (
+	LevelEnv = "PIPELINE_LOG_LEVEL"
+
+	PipelineKey = "pipeline"
+	StageKey    = "stage"
+	StageIDKey  = "stage_id"
+)
+
+// Return the level from PIPELINE_LOG_LEVEL, INFO if it is not defined or invalid.
+func Level() slog.Level {
+	level := slog.LevelInfo
+	if s, ok := os.LookupEnv(LevelEnv); ok {
+		if err := level.UnmarshalText([]byte(s)); err != nil {
+			return slog.LevelInfo
+		}
+	}
+	return level
+}
+
+// Return a new text logger to stderr at the level from PIPELINE_LOG_LEVEL.
+func NewDefault() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: Level()}))
+}
@@ -0,0 +1,15 @@
+package logging
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestLevel(t *testing.T) {
+	for s, level := range map[string]slog.Level{"DEBUG": slog.LevelDebug, "warn": slog.LevelWarn, "foo": slog.LevelInfo} {
+		t.Setenv(LevelEnv, s)
+		if Level() != level {
+			t.Fatalf("[%v] level [%v]", s, Level())
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package metrics
+
+import "context"
+
+type stageKey struct{}
+
+// Return a child context carrying the stage, for the user function the stage calls to report to, e.g. its retries.
+func NewContext(ctx context.Context, stage *Stage) context.Context {
+	return context.WithValue(ctx, stageKey{}, stage)
+}
+
+// Return the stage carried by the context, or nil.
+func FromContext(ctx context.Context) *Stage {
+	stage, _ := ctx.Value(stageKey{}).(*Stage)
+	return stage
+}
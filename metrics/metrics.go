@@ -0,0 +1,329 @@
+/*
+Metrics provides a registry of per stage metrics for a pipeline.
+
+Each stage reports the elements it receives and sends, errors, the time spent in user functions and the time spent blocked receiving and sending.
+The registry can be queried at runtime with Snapshot, published with expvar and written in the Prometheus text format.
+
+	stage := registry.Stage(id, "Mapper")
+
+	start := time.Now()
+	t, ok := <-in
+	stage.Received(start)
+	defer stage.Done()
+*/
+package metrics
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The upper bounds in seconds of the user function duration histogram buckets.
+var DefaultBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}
+
+// Histogram counts durations into fixed buckets.
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Int64
+	count   atomic.Int64
+	// Sum of the observed durations in nanoseconds.
+	sum atomic.Int64
+}
+
+func (histogram *Histogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+	for i, bucket := range histogram.buckets {
+		if seconds <= bucket {
+			histogram.counts[i].Add(1)
+		}
+	}
+	histogram.count.Add(1)
+	histogram.sum.Add(int64(d))
+}
+
+// HistogramSnapshot is a point in time copy of a histogram, Counts are cumulative as in Prometheus.
+type HistogramSnapshot struct {
+	Buckets []float64     `json:"buckets"`
+	Counts  []int64       `json:"counts"`
+	Count   int64         `json:"count"`
+	Sum     time.Duration `json:"sum"`
+}
+
+func (histogram *Histogram) Snapshot() HistogramSnapshot {
+	snapshot := HistogramSnapshot{histogram.buckets, make([]int64, len(histogram.counts)), histogram.count.Load(), time.Duration(histogram.sum.Load())}
+	for i := range histogram.counts {
+		snapshot.Counts[i] = histogram.counts[i].Load()
+	}
+	return snapshot
+}
+
+func NewHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]atomic.Int64, len(buckets))}
+}
+
+// Stage holds the metrics for a single stage, safe for concurrent use by a stage's workers.
+type Stage struct {
+	id       string
+	name     string
+	in       atomic.Int64
+	out      atomic.Int64
+	errors   atomic.Int64
+	timedOut atomic.Int64
+	inFlight atomic.Int64
+	// Nanoseconds blocked receiving and sending.
+	blockedReceive atomic.Int64
+	blockedSend    atomic.Int64
+	calls          *Histogram
+	// The stage's output buffer, if registered with Buffer.
+	buffer      atomic.Pointer[buffer]
+	maxBuffered atomic.Int64
+	// The elements held back by a resequencing stage, see Reorder.
+	reorderDepth    atomic.Int64
+	maxReorderDepth atomic.Int64
+	// The state of a circuit breaker, see State, the times it opened and the calls it rejected.
+	state    atomic.Int64
+	trips    atomic.Int64
+	rejected atomic.Int64
+	// The attempts of retried user functions, see Retried.
+	attempts    atomic.Int64
+	retries     atomic.Int64
+	retryFailed atomic.Int64
+}
+
+// The states of a circuit breaker reported with State.
+const (
+	StateClosed int64 = iota
+	StateHalfOpen
+	StateOpen
+)
+
+type buffer struct {
+	len  func() int
+	size int
+}
+
+func (stage *Stage) ID() string {
+	return stage.id
+}
+
+func (stage *Stage) Name() string {
+	return stage.name
+}
+
+// Record an element received, where start is when the stage began waiting to receive.
+// The element is in flight until Done is called.
+func (stage *Stage) Received(start time.Time) {
+	stage.blockedReceive.Add(int64(time.Since(start)))
+	stage.in.Add(1)
+	stage.inFlight.Add(1)
+}
+
+// Record an element sent, where start is when the stage began waiting to send.
+// If the stage has a buffer its occupancy is sampled for the high water mark.
+func (stage *Stage) Sent(start time.Time) {
+	stage.blockedSend.Add(int64(time.Since(start)))
+	stage.out.Add(1)
+
+	if buffer := stage.buffer.Load(); buffer != nil {
+		n := int64(buffer.len())
+		for max := stage.maxBuffered.Load(); n > max && !stage.maxBuffered.CompareAndSwap(max, n); max = stage.maxBuffered.Load() {
+		}
+	}
+}
+
+// Register the stage's output buffer, len returns the elements waiting in the buffer.
+func (stage *Stage) Buffer(len func() int, size int) {
+	stage.buffer.Store(&buffer{len, size})
+}
+
+// Record an element received by the stage as finished with, either sent or dropped.
+func (stage *Stage) Done() {
+	stage.inFlight.Add(-1)
+}
+
+// Record a call to a user function, where start is when the function was called.
+// A non nil error is counted as an error.
+func (stage *Stage) Called(start time.Time, err error) {
+	stage.calls.Observe(time.Since(start))
+	if err != nil {
+		stage.errors.Add(1)
+	}
+}
+
+// Record an error which did not come from a user function.
+func (stage *Stage) Error() {
+	stage.errors.Add(1)
+}
+
+// Record an element dropped as the call to a user function exceeded the element timeout.
+func (stage *Stage) TimedOut() {
+	stage.timedOut.Add(1)
+}
+
+// Record the elements a resequencing stage holds back waiting for a missing element.
+func (stage *Stage) Reorder(depth int) {
+	n := int64(depth)
+	stage.reorderDepth.Store(n)
+	for max := stage.maxReorderDepth.Load(); n > max && !stage.maxReorderDepth.CompareAndSwap(max, n); max = stage.maxReorderDepth.Load() {
+	}
+}
+
+// Record the state of a circuit breaker, one of StateClosed, StateHalfOpen or StateOpen, counting a trip each time it opens.
+func (stage *Stage) State(state int64) {
+	if stage.state.Swap(state) != StateOpen && state == StateOpen {
+		stage.trips.Add(1)
+	}
+}
+
+// Record a call rejected by a circuit breaker.
+func (stage *Stage) Rejected() {
+	stage.rejected.Add(1)
+}
+
+// Record the attempts a retried user function took for an element, and whether its last attempt still failed.
+func (stage *Stage) Retried(attempts int, failed bool) {
+	stage.attempts.Add(int64(attempts))
+	stage.retries.Add(int64(attempts - 1))
+	if failed {
+		stage.retryFailed.Add(1)
+	}
+}
+
+// StageSnapshot is a point in time copy of a stage's metrics.
+type StageSnapshot struct {
+	ID             string            `json:"id"`
+	Name           string            `json:"name"`
+	In             int64             `json:"in"`
+	Out            int64             `json:"out"`
+	Errors         int64             `json:"errors"`
+	TimedOut       int64             `json:"timed_out"`
+	InFlight       int64             `json:"in_flight"`
+	BlockedReceive time.Duration     `json:"blocked_receive"`
+	BlockedSend    time.Duration     `json:"blocked_send"`
+	Calls          HistogramSnapshot `json:"calls"`
+	// The elements waiting in the output buffer, the most seen when sending, and the buffer size.
+	Buffered    int64 `json:"buffered"`
+	MaxBuffered int64 `json:"max_buffered"`
+	BufferSize  int64 `json:"buffer_size"`
+	// The elements held back by a resequencing stage now, and the most held back at once.
+	ReorderDepth    int64 `json:"reorder_depth"`
+	MaxReorderDepth int64 `json:"max_reorder_depth"`
+	// The state of a circuit breaker, the times it opened and the calls it rejected.
+	State    int64 `json:"state"`
+	Trips    int64 `json:"trips"`
+	Rejected int64 `json:"rejected"`
+	// The attempts and retries of retried user functions, and the elements which failed after their last attempt.
+	Attempts    int64 `json:"attempts"`
+	Retries     int64 `json:"retries"`
+	RetryFailed int64 `json:"retry_failed"`
+}
+
+func (stage *Stage) Snapshot() StageSnapshot {
+	snapshot := StageSnapshot{
+		ID:              stage.id,
+		Name:            stage.name,
+		In:              stage.in.Load(),
+		Out:             stage.out.Load(),
+		Errors:          stage.errors.Load(),
+		TimedOut:        stage.timedOut.Load(),
+		InFlight:        stage.inFlight.Load(),
+		BlockedReceive:  time.Duration(stage.blockedReceive.Load()),
+		BlockedSend:     time.Duration(stage.blockedSend.Load()),
+		Calls:           stage.calls.Snapshot(),
+		MaxBuffered:     stage.maxBuffered.Load(),
+		ReorderDepth:    stage.reorderDepth.Load(),
+		MaxReorderDepth: stage.maxReorderDepth.Load(),
+		State:           stage.state.Load(),
+		Trips:           stage.trips.Load(),
+		Rejected:        stage.rejected.Load(),
+		Attempts:        stage.attempts.Load(),
+		Retries:         stage.retries.Load(),
+		RetryFailed:     stage.retryFailed.Load(),
+	}
+	if buffer := stage.buffer.Load(); buffer != nil {
+		snapshot.Buffered = int64(buffer.len())
+		snapshot.BufferSize = int64(buffer.size)
+	}
+	return snapshot
+}
+
+// Registry holds the stage metrics for a pipeline.
+type Registry struct {
+	pipeline string
+	lock     *sync.Mutex
+	stages   map[string]*Stage
+}
+
+// Return the ID of the pipeline the registry belongs to.
+func (registry *Registry) Pipeline() string {
+	return registry.pipeline
+}
+
+// Return the metrics for the given stage ID, creating them if needed.
+func (registry *Registry) Stage(id string, name string) *Stage {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if stage, ok := registry.stages[id]; ok {
+		return stage
+	}
+
+	stage := &Stage{id: id, name: name, calls: NewHistogram(DefaultBuckets)}
+	registry.stages[id] = stage
+	return stage
+}
+
+// Return a snapshot of every stage ordered by ID.
+func (registry *Registry) Snapshot() []StageSnapshot {
+	registry.lock.Lock()
+	stages := make([]*Stage, 0, len(registry.stages))
+	for _, stage := range registry.stages {
+		stages = append(stages, stage)
+	}
+	registry.lock.Unlock()
+
+	sort.Slice(stages, func(i, j int) bool { return lessID(stages[i].id, stages[j].id) })
+
+	snapshot := make([]StageSnapshot, len(stages))
+	for i, stage := range stages {
+		snapshot[i] = stage.Snapshot()
+	}
+	return snapshot
+}
+
+// Return an expvar.Var which reports the registry snapshot as JSON.
+func (registry *Registry) Var() expvar.Var {
+	return expvar.Func(func() any {
+		return map[string]any{"pipeline": registry.pipeline, "stages": registry.Snapshot()}
+	})
+}
+
+// Publish the registry with expvar under the given name.
+// Like expvar.Publish this panics if the name is already published.
+func (registry *Registry) Publish(name string) {
+	expvar.Publish(name, registry.Var())
+}
+
+func NewRegistry(pipeline string) *Registry {
+	return &Registry{pipeline, &sync.Mutex{}, map[string]*Stage{}}
+}
+
+// Order numeric IDs numerically, otherwise lexically.
+func lessID(a string, b string) bool {
+	if len(a) != len(b) && isDigits(a) && isDigits(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
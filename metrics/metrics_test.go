@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStage(t *testing.T) {
+	registry := NewRegistry("p")
+
+	stage := registry.Stage("2", "Mapper")
+	if registry.Stage("2", "Mapper") != stage {
+		t.Fatal("stage not reused")
+	}
+	registry.Stage("10", "ForEach")
+
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		stage.Received(start)
+		stage.Called(start, nil)
+	}
+	stage.Called(time.Now(), errors.New("foo"))
+	stage.TimedOut()
+	stage.Sent(time.Now())
+	stage.Done()
+
+	snapshot := registry.Snapshot()
+	if len(snapshot) != 2 || snapshot[0].ID != "2" || snapshot[1].ID != "10" {
+		t.Fatalf("snapshot [%+v]", snapshot)
+	}
+	if s := snapshot[0]; s.In != 3 || s.Out != 1 || s.Errors != 1 || s.TimedOut != 1 || s.InFlight != 2 || s.Calls.Count != 4 {
+		t.Fatalf("stage [%+v]", s)
+	}
+	if _, err := json.Marshal(snapshot); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStageBuffer(t *testing.T) {
+	stage := NewRegistry("p").Stage("1", "Slice")
+
+	buffer := make(chan int, 4)
+	stage.Buffer(func() int { return len(buffer) }, cap(buffer))
+
+	for i := 0; i < 3; i++ {
+		buffer <- i
+		stage.Sent(time.Now())
+	}
+	<-buffer
+	<-buffer
+
+	if s := stage.Snapshot(); s.Buffered != 1 || s.MaxBuffered != 3 || s.BufferSize != 4 {
+		t.Fatalf("stage [%+v]", s)
+	}
+}
+
+func TestStageReorder(t *testing.T) {
+	stage := NewRegistry("p").Stage("1", "SequenceRemove")
+
+	for _, depth := range []int{1, 3, 2, 0} {
+		stage.Reorder(depth)
+	}
+
+	if s := stage.Snapshot(); s.ReorderDepth != 0 || s.MaxReorderDepth != 3 {
+		t.Fatalf("stage [%+v]", s)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	histogram := NewHistogram([]float64{0.001, 1})
+	histogram.Observe(time.Microsecond)
+	histogram.Observe(time.Millisecond * 10)
+	histogram.Observe(time.Second * 10)
+
+	snapshot := histogram.Snapshot()
+	if snapshot.Counts[0] != 1 || snapshot.Counts[1] != 2 || snapshot.Count != 3 {
+		t.Fatalf("snapshot [%+v]", snapshot)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	registry := NewRegistry("p")
+	registry.Stage("1", `Slice"`).Sent(time.Now())
+
+	b := strings.Builder{}
+	if err := registry.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"# TYPE pipeline_stage_out_total counter",
+		`pipeline_stage_out_total{pipeline="p",stage="Slice\"",id="1"} 1`,
+		`pipeline_stage_call_seconds_bucket{pipeline="p",stage="Slice\"",id="1",le="+Inf"} 0`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Fatalf("missing [%v] in\n%v", line, b.String())
+		}
+	}
+}
+
+func TestVar(t *testing.T) {
+	registry := NewRegistry("p")
+	registry.Stage("1", "Slice")
+
+	if !strings.Contains(registry.Var().String(), `"name":"Slice"`) {
+		t.Fatal(registry.Var().String())
+	}
+}
+
+func TestStageBreaker(t *testing.T) {
+	stage := NewRegistry("p").Stage("1", "users")
+
+	for _, state := range []int64{StateOpen, StateHalfOpen, StateOpen, StateOpen, StateClosed} {
+		stage.State(state)
+	}
+	stage.Rejected()
+
+	if s := stage.Snapshot(); s.State != StateClosed || s.Trips != 2 || s.Rejected != 1 {
+		t.Fatalf("stage [%+v]", s)
+	}
+}
+
+func TestStageRetried(t *testing.T) {
+	stage := NewRegistry("p").Stage("1", "fetch")
+
+	stage.Retried(1, false)
+	stage.Retried(3, true)
+
+	if s := stage.Snapshot(); s.Attempts != 4 || s.Retries != 2 || s.RetryFailed != 1 {
+		t.Fatalf("stage [%+v]", s)
+	}
+	if FromContext(context.Background()) != nil || FromContext(NewContext(context.Background(), stage)) != stage {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type prometheusMetric struct {
+	name  string
+	kind  string
+	help  string
+	value func(StageSnapshot) float64
+}
+
+var prometheusMetrics = []prometheusMetric{
+	{"pipeline_stage_in_total", "counter", "Elements received by the stage.", func(s StageSnapshot) float64 { return float64(s.In) }},
+	{"pipeline_stage_out_total", "counter", "Elements sent by the stage.", func(s StageSnapshot) float64 { return float64(s.Out) }},
+	{"pipeline_stage_errors_total", "counter", "Errors in the stage.", func(s StageSnapshot) float64 { return float64(s.Errors) }},
+	{"pipeline_stage_timed_out_total", "counter", "Elements dropped as a call exceeded the element timeout.", func(s StageSnapshot) float64 { return float64(s.TimedOut) }},
+	{"pipeline_stage_in_flight", "gauge", "Elements received by the stage and not yet sent or dropped.", func(s StageSnapshot) float64 { return float64(s.InFlight) }},
+	{"pipeline_stage_blocked_receive_seconds_total", "counter", "Time the stage spent blocked receiving.", func(s StageSnapshot) float64 { return s.BlockedReceive.Seconds() }},
+	{"pipeline_stage_blocked_send_seconds_total", "counter", "Time the stage spent blocked sending.", func(s StageSnapshot) float64 { return s.BlockedSend.Seconds() }},
+	{"pipeline_stage_buffered", "gauge", "Elements waiting in the stage's output buffer.", func(s StageSnapshot) float64 { return float64(s.Buffered) }},
+	{"pipeline_stage_buffered_max", "gauge", "Most elements seen waiting in the stage's output buffer when sending.", func(s StageSnapshot) float64 { return float64(s.MaxBuffered) }},
+	{"pipeline_stage_buffer_size", "gauge", "Size of the stage's output buffer.", func(s StageSnapshot) float64 { return float64(s.BufferSize) }},
+	{"pipeline_stage_reorder_depth", "gauge", "Elements held back by a resequencing stage.", func(s StageSnapshot) float64 { return float64(s.ReorderDepth) }},
+	{"pipeline_stage_reorder_depth_max", "gauge", "Most elements held back at once by a resequencing stage.", func(s StageSnapshot) float64 { return float64(s.MaxReorderDepth) }},
+	{"pipeline_stage_breaker_state", "gauge", "State of a circuit breaker, 0 closed, 1 half-open, 2 open.", func(s StageSnapshot) float64 { return float64(s.State) }},
+	{"pipeline_stage_breaker_trips_total", "counter", "Times a circuit breaker opened.", func(s StageSnapshot) float64 { return float64(s.Trips) }},
+	{"pipeline_stage_breaker_rejected_total", "counter", "Calls rejected by a circuit breaker while open.", func(s StageSnapshot) float64 { return float64(s.Rejected) }},
+	{"pipeline_stage_retry_attempts_total", "counter", "Attempts of retried user functions.", func(s StageSnapshot) float64 { return float64(s.Attempts) }},
+	{"pipeline_stage_retries_total", "counter", "Retries of retried user functions.", func(s StageSnapshot) float64 { return float64(s.Retries) }},
+	{"pipeline_stage_retry_failed_total", "counter", "Elements whose retried user function failed after its last attempt.", func(s StageSnapshot) float64 { return float64(s.RetryFailed) }},
+}
+
+// Write every registry in the Prometheus text exposition format.
+func WritePrometheus(w io.Writer, registries ...*Registry) error {
+	writer := bufio.NewWriter(w)
+
+	snapshots := make([][]StageSnapshot, len(registries))
+	for i, registry := range registries {
+		snapshots[i] = registry.Snapshot()
+	}
+
+	for _, metric := range prometheusMetrics {
+		fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind)
+		for i, registry := range registries {
+			for _, stage := range snapshots[i] {
+				fmt.Fprintf(writer, "%s{%s} %s\n", metric.name, prometheusLabels(registry, stage), formatFloat(metric.value(stage)))
+			}
+		}
+	}
+
+	name := "pipeline_stage_call_seconds"
+	fmt.Fprintf(writer, "# HELP %s Time spent in the stage's user function.\n# TYPE %s histogram\n", name, name)
+	for i, registry := range registries {
+		for _, stage := range snapshots[i] {
+			labels := prometheusLabels(registry, stage)
+			for j, bucket := range stage.Calls.Buckets {
+				fmt.Fprintf(writer, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(bucket), stage.Calls.Counts[j])
+			}
+			fmt.Fprintf(writer, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, stage.Calls.Count)
+			fmt.Fprintf(writer, "%s_sum{%s} %s\n", name, labels, formatFloat(stage.Calls.Sum.Seconds()))
+			fmt.Fprintf(writer, "%s_count{%s} %d\n", name, labels, stage.Calls.Count)
+		}
+	}
+
+	return writer.Flush()
+}
+
+// Write the registry in the Prometheus text exposition format.
+func (registry *Registry) WritePrometheus(w io.Writer) error {
+	return WritePrometheus(w, registry)
+}
+
+// Return a handler which serves the given registries in the Prometheus text exposition format.
+func PrometheusHandler(registries ...*Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w, registries...)
+	})
+}
+
+func prometheusLabels(registry *Registry, stage StageSnapshot) string {
+	return fmt.Sprintf("pipeline=%s,stage=%s,id=%s", quoteLabel(registry.pipeline), quoteLabel(stage.Name), quoteLabel(stage.ID))
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(s string) string {
+	return `"` + labelReplacer.Replace(s) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
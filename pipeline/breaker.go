@@ -0,0 +1,426 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"example.com/m/v2/clock"
+	"example.com/m/v2/logging"
+	"example.com/m/v2/metrics"
+	"github.com/google/uuid"
+)
+
+// BreakerState is the state of a Breaker.
+type BreakerState string
+
+const (
+	// Calls are made, and their failures counted.
+	BreakerClosed BreakerState = "closed"
+	// Calls are rejected until the cooldown has passed.
+	BreakerOpen BreakerState = "open"
+	// A limited number of calls are made to probe whether the dependency has recovered.
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerMode is what a call does while the breaker is open.
+type BreakerMode string
+
+const (
+	// Fail with ErrBreakerOpen, or call the fallback given to BreakFallback.
+	BreakerFailFast BreakerMode = "fail fast"
+	// Wait until the breaker lets the call through, or the context is done.
+	BreakerWait BreakerMode = "wait"
+)
+
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+// The failure recorded for a call which panicked, the panic carries on to the stage.
+var errBreakerPanic = errors.New("panic in call through circuit breaker")
+
+// The number of buckets the rolling window is counted in.
+const breakerBuckets = 10
+
+// breakerOptions configure a Breaker, create them with BreakerOptions.
+type breakerOptions struct {
+	// Trip once this many calls in a row fail, 0 to not trip on consecutive failures.
+	ConsecutiveFailures int
+	// Trip once the failed fraction of the calls in the window reaches ErrorRate, if there were at least MinCalls, 0 to not trip on the error rate.
+	ErrorRate float64
+	MinCalls  int
+	Window    time.Duration
+	// How long the breaker stays open before letting calls through half-open.
+	Cooldown time.Duration
+	// The calls let through half-open, the breaker closes once they all succeed.
+	HalfOpenCalls int
+	Mode          BreakerMode
+	// Return whether an error counts as a failure, nil counts every error.
+	IsFailure func(error) bool
+	// Called on each state change, holding the breaker, so it must not block or call the breaker.
+	OnStateChange func(BreakerEvent)
+	// The clock of the window and cooldown, the pipeline's clock by default.
+	Clock clock.Clock
+}
+
+func (o *breakerOptions) WithConsecutiveFailures(n int) *breakerOptions {
+	o.ConsecutiveFailures = n
+	return o
+}
+
+func (o *breakerOptions) WithErrorRate(rate float64, minCalls int, window time.Duration) *breakerOptions {
+	o.ErrorRate = rate
+	o.MinCalls = minCalls
+	o.Window = window
+	return o
+}
+
+func (o *breakerOptions) WithCooldown(d time.Duration) *breakerOptions {
+	o.Cooldown = d
+	return o
+}
+
+func (o *breakerOptions) WithHalfOpenCalls(n int) *breakerOptions {
+	o.HalfOpenCalls = n
+	return o
+}
+
+// Wait while the breaker is open, rather than failing fast.
+func (o *breakerOptions) WaitWhenOpen() *breakerOptions {
+	o.Mode = BreakerWait
+	return o
+}
+
+func (o *breakerOptions) WithIsFailure(f func(error) bool) *breakerOptions {
+	o.IsFailure = f
+	return o
+}
+
+func (o *breakerOptions) WithOnStateChange(f func(BreakerEvent)) *breakerOptions {
+	o.OnStateChange = f
+	return o
+}
+
+func (o *breakerOptions) WithClock(c clock.Clock) *breakerOptions {
+	o.Clock = c
+	return o
+}
+
+// Return the default breaker options, tripping after 5 consecutive failures with a 30s cooldown and failing fast while open.
+func BreakerOptions() *breakerOptions {
+	return (&breakerOptions{Mode: BreakerFailFast, Window: time.Minute}).WithConsecutiveFailures(5).WithCooldown(30 * time.Second).WithHalfOpenCalls(1)
+}
+
+// BreakerEvent describes a state change of a Breaker.
+type BreakerEvent struct {
+	Breaker string
+	From    BreakerState
+	To      BreakerState
+	Time    time.Time
+	// The failure which opened the breaker, otherwise nil.
+	Err error
+}
+
+func (event BreakerEvent) String() string {
+	if event.Err != nil {
+		return fmt.Sprintf("breaker %s %s -> %s: %v", event.Breaker, event.From, event.To, event.Err)
+	}
+	return fmt.Sprintf("breaker %s %s -> %s", event.Breaker, event.From, event.To)
+}
+
+// BreakerStats counts the calls through a Breaker.
+type BreakerStats struct {
+	State BreakerState
+	// The calls made, and those which failed.
+	Calls    int64
+	Failures int64
+	// The calls rejected, or held back if waiting, while open, and those answered by a fallback.
+	Rejected  int64
+	Fallbacks int64
+	// The times the breaker opened.
+	Trips int64
+}
+
+func (stats BreakerStats) String() string {
+	return fmt.Sprintf("%s calls %d failures %d rejected %d fallbacks %d trips %d", stats.State, stats.Calls, stats.Failures, stats.Rejected, stats.Fallbacks, stats.Trips)
+}
+
+type breakerBucket struct {
+	start    time.Time
+	calls    int
+	failures int
+}
+
+/*
+Breaker is a circuit breaker shared by the calls to a failing dependency, e.g. by every worker of a Mapper.
+
+While closed every call is made.
+The breaker opens once ConsecutiveFailures calls in a row fail, or the error rate over the rolling window reaches ErrorRate.
+While open calls are rejected, see BreakerMode, until the cooldown has passed and the breaker is half-open.
+Half-open HalfOpenCalls calls are let through, the breaker closes if they all succeed and opens again on the first failure.
+A call which panics counts as a failure.
+
+The state, trips and rejected calls are reported to the pipeline's metrics registry as a stage named after the breaker, and each state change is logged.
+
+	breaker := NewBreaker(p, "users", BreakerOptions().WithErrorRate(0.5, 20, time.Minute))
+	mapper := MapperContext(p, input, Break(breaker, fetch), *GroupOptions().ParallelWorkers())
+*/
+type Breaker struct {
+	name    string
+	opts    breakerOptions
+	logger  *slog.Logger
+	metrics *metrics.Stage
+	lock    *sync.Mutex
+	// Guarded by lock.
+	state       BreakerState
+	openedAt    time.Time
+	consecutive int
+	buckets     []breakerBucket
+	// The calls let through and succeeded while half-open.
+	probes    int
+	successes int
+	stats     BreakerStats
+	// Closed and replaced on each state change, for waiting calls.
+	changed chan struct{}
+}
+
+// Return a new closed breaker reporting to the pipeline's metrics registry and logger.
+func NewBreaker(p Pipeline, name string, opts *breakerOptions) *Breaker {
+	id := uuid.NewString()
+	b := &Breaker{
+		name:    name,
+		opts:    *opts,
+		logger:  p.Logger().With(slog.String(logging.StageKey, "Breaker"), slog.String(logging.StageIDKey, id), slog.String("Breaker", name)),
+		metrics: p.Metrics().Stage(id, name),
+		lock:    &sync.Mutex{},
+		state:   BreakerClosed,
+		stats:   BreakerStats{State: BreakerClosed},
+		changed: make(chan struct{}),
+	}
+	if b.opts.Clock == nil {
+		b.opts.Clock = p.Clock()
+	}
+	return b
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+func (b *Breaker) State() BreakerState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state
+}
+
+func (b *Breaker) Stats() BreakerStats {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.stats
+}
+
+// Wrap the user function of MapperContext with the breaker.
+// While the breaker is open the call fails with ErrBreakerOpen, or waits if the breaker was created with WaitWhenOpen.
+func Break[T, R any](b *Breaker, f func(context.Context, T) (R, error)) func(context.Context, T) (R, error) {
+	return func(ctx context.Context, t T) (R, error) {
+		var r R
+		err := b.do(ctx, func() (err error) {
+			r, err = f(ctx, t)
+			return err
+		})
+		return r, err
+	}
+}
+
+// Wrap the user function of MapperContext with the breaker, calling fallback for an element rejected while the breaker is open.
+func BreakFallback[T, R any](b *Breaker, f func(context.Context, T) (R, error), fallback func(context.Context, T) (R, error)) func(context.Context, T) (R, error) {
+	g := Break(b, f)
+	return func(ctx context.Context, t T) (R, error) {
+		r, err := g(ctx, t)
+		if errors.Is(err, ErrBreakerOpen) {
+			b.lock.Lock()
+			b.stats.Fallbacks++
+			b.lock.Unlock()
+			return fallback(ctx, t)
+		}
+		return r, err
+	}
+}
+
+// Wrap a consumer with the breaker, e.g. of ForEachContext, ForEachTerminalContext or PeekContext.
+func BreakConsumer[T any](b *Breaker, consumer func(context.Context, T) error) func(context.Context, T) error {
+	return func(ctx context.Context, t T) error {
+		return b.do(ctx, func() error { return consumer(ctx, t) })
+	}
+}
+
+// Wrap the consumer of WorkerGroupContext with the breaker.
+func BreakWorker[T any](b *Breaker, c func(context.Context, Pipeline, T) error) func(context.Context, Pipeline, T) error {
+	return func(ctx context.Context, p Pipeline, t T) error {
+		return b.do(ctx, func() error { return c(ctx, p, t) })
+	}
+}
+
+// Call f if the breaker allows it, recording the result, or a failure if f panics.
+func (b *Breaker) do(ctx context.Context, f func() error) (err error) {
+	for {
+		allowed, changed, wait := b.allow()
+		if allowed {
+			break
+		}
+		if b.opts.Mode != BreakerWait {
+			return ErrBreakerOpen
+		}
+
+		timer := b.opts.Clock.NewTimer(wait)
+		select {
+		case <-changed:
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w: %w", ErrBreakerOpen, ctx.Err())
+		}
+		timer.Stop()
+	}
+
+	// Release a half-open probe even if f panics.
+	start := time.Now()
+	err = errBreakerPanic
+	defer func() {
+		b.metrics.Called(start, err)
+		b.record(err)
+	}()
+	return f()
+}
+
+// Return whether a call is allowed, otherwise a channel closed on the next state change and how long until the cooldown has passed.
+func (b *Breaker) allow() (bool, <-chan struct{}, time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := b.opts.Clock.Now()
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.opts.Cooldown {
+		b.probes = 0
+		b.successes = 0
+		b.transition(BreakerHalfOpen, now, nil)
+	}
+
+	switch b.state {
+	case BreakerClosed:
+		return true, nil, 0
+	case BreakerHalfOpen:
+		if b.probes < b.opts.HalfOpenCalls {
+			b.probes++
+			return true, nil, 0
+		}
+	}
+
+	b.stats.Rejected++
+	b.metrics.Rejected()
+	wait := b.opts.Cooldown - now.Sub(b.openedAt)
+	if wait <= 0 {
+		// Half-open with every probe in flight, wait for their results.
+		wait = b.opts.Cooldown
+	}
+	return false, b.changed, wait
+}
+
+func (b *Breaker) record(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	failed := err == errBreakerPanic || (err != nil && (b.opts.IsFailure == nil || b.opts.IsFailure(err)))
+	now := b.opts.Clock.Now()
+
+	b.stats.Calls++
+	if failed {
+		b.stats.Failures++
+	}
+
+	switch b.state {
+	case BreakerClosed:
+		bucket := b.bucket(now)
+		bucket.calls++
+		if failed {
+			bucket.failures++
+			b.consecutive++
+		} else {
+			b.consecutive = 0
+		}
+		if failed && b.tripped() {
+			b.open(now, err)
+		}
+	case BreakerHalfOpen:
+		if failed {
+			b.open(now, err)
+			return
+		}
+		if b.successes++; b.successes >= b.opts.HalfOpenCalls {
+			b.consecutive = 0
+			b.buckets = nil
+			b.transition(BreakerClosed, now, nil)
+		}
+	}
+}
+
+// Return whether the failures while closed should open the breaker, the caller holds the lock.
+func (b *Breaker) tripped() bool {
+	if b.opts.ConsecutiveFailures > 0 && b.consecutive >= b.opts.ConsecutiveFailures {
+		return true
+	}
+	if b.opts.ErrorRate <= 0 {
+		return false
+	}
+	calls, failures := 0, 0
+	for _, bucket := range b.buckets {
+		calls += bucket.calls
+		failures += bucket.failures
+	}
+	return calls >= b.opts.MinCalls && calls > 0 && float64(failures)/float64(calls) >= b.opts.ErrorRate
+}
+
+// Return the bucket of the window for now, dropping the buckets which have left the window, the caller holds the lock.
+func (b *Breaker) bucket(now time.Time) *breakerBucket {
+	width := b.opts.Window / breakerBuckets
+	if width <= 0 {
+		width = 1
+	}
+
+	i := 0
+	for i < len(b.buckets) && now.Sub(b.buckets[i].start) >= b.opts.Window {
+		i++
+	}
+	b.buckets = b.buckets[i:]
+
+	if n := len(b.buckets); n == 0 || now.Sub(b.buckets[n-1].start) >= width {
+		b.buckets = append(b.buckets, breakerBucket{start: now})
+	}
+	return &b.buckets[len(b.buckets)-1]
+}
+
+func (b *Breaker) open(now time.Time, err error) {
+	b.openedAt = now
+	b.stats.Trips++
+	b.transition(BreakerOpen, now, err)
+}
+
+// The state of a breaker as reported to its metrics.
+var breakerStates = map[BreakerState]int64{BreakerClosed: metrics.StateClosed, BreakerHalfOpen: metrics.StateHalfOpen, BreakerOpen: metrics.StateOpen}
+
+// Change the state, publishing the event, the caller holds the lock.
+func (b *Breaker) transition(to BreakerState, now time.Time, err error) {
+	event := BreakerEvent{b.name, b.state, to, now, err}
+	b.state = to
+	b.stats.State = to
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+
+	b.metrics.State(breakerStates[to])
+	b.logger.Info("State changed", "From", event.From, "To", event.To, "Err", err)
+	if b.opts.OnStateChange != nil {
+		b.opts.OnStateChange(event)
+	}
+}
@@ -0,0 +1,180 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"example.com/m/v2/clock"
+	"example.com/m/v2/metrics"
+)
+
+var errDown = errors.New("down")
+
+func TestBreakerConsecutiveFailures(t *testing.T) {
+	p := NewPipeline()
+	fake := clock.NewFake(time.Unix(0, 0))
+	events := []BreakerState{}
+	breaker := NewBreaker(p, "consecutive", BreakerOptions().WithClock(fake).WithConsecutiveFailures(3).WithCooldown(time.Minute).WithHalfOpenCalls(2).WithOnStateChange(func(event BreakerEvent) {
+		events = append(events, event.To)
+	}))
+
+	down := true
+	f := Break(breaker, func(ctx context.Context, t int) (int, error) {
+		if down {
+			return 0, errDown
+		}
+		return t, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := f(context.Background(), i); !errors.Is(err, errDown) {
+			t.Fatalf("call %d %v", i, err)
+		}
+	}
+	if _, err := f(context.Background(), 3); !errors.Is(err, ErrBreakerOpen) || breaker.State() != BreakerOpen {
+		t.Fatalf("open %v %s", err, breaker.State())
+	}
+
+	down = false
+	fake.Advance(time.Minute)
+	for i := 0; i < 2; i++ {
+		if r, err := f(context.Background(), i); err != nil || r != i {
+			t.Fatalf("probe %d %d %v", i, r, err)
+		}
+	}
+
+	if !slices.Equal(events, []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerClosed}) {
+		t.Fatalf("events %v", events)
+	}
+	if stats := breaker.Stats(); stats.Calls != 5 || stats.Failures != 3 || stats.Rejected != 1 || stats.Trips != 1 || stats.State != BreakerClosed {
+		t.Fatalf("stats %v", stats)
+	}
+
+	// The breaker reports to the pipeline's metrics as a stage.
+	snapshot := p.Metrics().Snapshot()
+	if len(snapshot) != 1 {
+		t.Fatalf("snapshot [%+v]", snapshot)
+	}
+	if s := snapshot[0]; s.Name != "consecutive" || s.State != metrics.StateClosed || s.Trips != 1 || s.Rejected != 1 || s.Calls.Count != 5 || s.Errors != 3 {
+		t.Fatalf("stage [%+v]", s)
+	}
+}
+
+func TestBreakerErrorRate(t *testing.T) {
+	breaker := NewBreaker(Background(), "rate", BreakerOptions().WithConsecutiveFailures(0).WithErrorRate(0.5, 4, time.Minute).WithCooldown(time.Minute))
+	consumer := BreakConsumer(breaker, func(ctx context.Context, err error) error { return err })
+
+	for _, err := range []error{nil, errDown, nil, errDown} {
+		consumer(context.Background(), err)
+	}
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("state %s %v", breaker.State(), breaker.Stats())
+	}
+}
+
+func TestBreakerHalfOpenFailure(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	breaker := NewBreaker(Background(), "half-open", BreakerOptions().WithClock(fake).WithConsecutiveFailures(1).WithCooldown(time.Minute))
+	worker := BreakWorker(breaker, func(ctx context.Context, p Pipeline, t int) error { return errDown })
+
+	worker(context.Background(), Background(), 1)
+	fake.Advance(time.Minute)
+	if err := worker(context.Background(), Background(), 2); !errors.Is(err, errDown) {
+		t.Fatal(err)
+	}
+	if stats := breaker.Stats(); stats.State != BreakerOpen || stats.Trips != 2 {
+		t.Fatalf("stats %v", stats)
+	}
+}
+
+func TestBreakerFallback(t *testing.T) {
+	p := NewPipeline()
+
+	breaker := NewBreaker(p, "fallback", BreakerOptions().WithConsecutiveFailures(1).WithCooldown(time.Minute).WithIsFailure(RetryIs(errDown)))
+	f := BreakFallback(breaker, func(ctx context.Context, t int) (int, error) {
+		if t == 2 {
+			return 0, errDown
+		}
+		return t, nil
+	}, func(ctx context.Context, t int) (int, error) { return -1, nil })
+
+	// The failure of 2 reaches the error path, then the breaker is open for the rest.
+	result := []int{}
+	for _, t := range []int{1, 2, 3, 4} {
+		r, err := f(p.CTX(), t)
+		if err != nil {
+			continue
+		}
+		result = append(result, r)
+	}
+	if !slices.Equal(result, []int{1, -1, -1}) || breaker.Stats().Fallbacks != 2 {
+		t.Fatalf("result %v stats %v", result, breaker.Stats())
+	}
+}
+
+func TestBreakerWait(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	breaker := NewBreaker(Background(), "wait", BreakerOptions().WithClock(fake).WithConsecutiveFailures(1).WithCooldown(time.Minute).WaitWhenOpen())
+	consumer := BreakConsumer(breaker, func(ctx context.Context, err error) error { return err })
+
+	consumer(context.Background(), errDown)
+	start := fake.Now()
+	go func() {
+		fake.BlockUntil(1)
+		fake.Advance(time.Minute)
+	}()
+	if err := consumer(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if fake.Since(start) != time.Minute || breaker.State() != BreakerClosed {
+		t.Fatalf("waited %v state %s", fake.Since(start), breaker.State())
+	}
+
+	consumer(context.Background(), errDown)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := consumer(ctx, nil); !errors.Is(err, ErrBreakerOpen) || !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+}
+
+func TestBreakerProbePanic(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	breaker := NewBreaker(Background(), "panic", BreakerOptions().WithClock(fake).WithConsecutiveFailures(1).WithCooldown(time.Minute))
+
+	panics := true
+	f := Break(breaker, func(ctx context.Context, t int) (int, error) {
+		if panics {
+			panic("probe")
+		}
+		return t, nil
+	})
+	call := func(t int) (r int, err error) {
+		err = protect("Mapper", t, func() (err error) {
+			r, err = f(context.Background(), t)
+			return err
+		})
+		return r, err
+	}
+
+	// The panic of the first call opens the breaker, and the panic of the half-open probe opens it again.
+	for i := 0; i < 2; i++ {
+		var panicErr *PanicError
+		if _, err := call(i); !errors.As(err, &panicErr) || breaker.State() != BreakerOpen {
+			t.Fatalf("call %d %v %s", i, err, breaker.State())
+		}
+		fake.Advance(time.Minute)
+	}
+
+	// The probe is released, so the next call after the cooldown is let through.
+	panics = false
+	if r, err := call(3); err != nil || r != 3 || breaker.State() != BreakerClosed {
+		t.Fatalf("probe %d %v %s", r, err, breaker.State())
+	}
+	if stats := breaker.Stats(); stats.Failures != 2 || stats.Trips != 2 {
+		t.Fatalf("stats %v", stats)
+	}
+}
@@ -0,0 +1,322 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync/atomic"
+
+	"example.com/m/v2/clock"
+)
+
+// StageKind is the role of a stage in a Builder graph.
+type StageKind string
+
+const (
+	// Has no inputs.
+	KindSource StageKind = "source"
+	// Has inputs and outputs.
+	KindIntermediate StageKind = "intermediate"
+	// Has no outputs.
+	KindSink StageKind = "sink"
+)
+
+var (
+	ErrNoStages         = errors.New("no stages")
+	ErrDuplicateStage   = errors.New("duplicate stage name")
+	ErrInvalidStage     = errors.New("invalid stage")
+	ErrUnknownInput     = errors.New("input is not a stage of this builder")
+	ErrInputConsumed    = errors.New("input is already consumed by another stage")
+	ErrDanglingOutput   = errors.New("output is not consumed")
+	ErrUnconsumedSource = errors.New("source is not consumed")
+	ErrAlreadyRun       = errors.New("builder has already run")
+	ErrNotRunning       = errors.New("builder is not running")
+)
+
+// StageError is a problem with a stage of a Builder.
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %q: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+/*
+Builder registers the stages of a pipeline with their inputs and outputs, so the whole graph is known and checked before anything starts.
+
+Each stage is given as a function which creates it from the Pipeline and its inputs, which Run calls once the graph is valid.
+The Node returned for a stage's output is typed, so a stage can only consume an output of the type it expects.
+
+	b := NewBuilder("even")
+	numbers := From(b, "numbers", func(p Pipeline) Source[int] {
+		return Slice(p, []int{1, 2, 3, 4})
+	})
+	even := Via(b, "even", numbers, func(p Pipeline, input Source[int]) Source[int] {
+		return Filter(p, input, func(t int) (bool, error) { return t%2 == 0, nil })
+	})
+	Sink(b, "print", even, func(p Pipeline, input Source[int]) error {
+		return StdOutV(p, input)
+	})
+
+	report, err := b.Run(ctx)
+*/
+type Builder struct {
+	name   string
+	logger *slog.Logger
+	// The default buffer size of each stage's output.
+	bufferSize int
+	// The clock of the pipeline, nil for the real clock.
+	clock  clock.Clock
+	stages []*stage
+	// The problems found while registering stages.
+	errs []error
+	ran  atomic.Bool
+	// The run started by Run, for Shutdown.
+	current atomic.Pointer[run]
+}
+
+type stage struct {
+	builder *Builder
+	name    string
+	kind    StageKind
+	inputs  []*output
+	outputs []*output
+	// The workers the stage runs, for a graph without a report.
+	parallelism int
+	// The buffer size of each edge from the stage.
+	bufferSize int
+	// Create the stage from its inputs, returning its outputs, nil for a sink.
+	start func(p Pipeline, inputs []any) ([]any, error)
+	// Run a sink until its input is done.
+	run func(p Pipeline, inputs []any) error
+}
+
+// output is an output of a stage, the edge to the stage consuming it.
+type output struct {
+	stage    *stage
+	consumer *stage
+	// The element type.
+	typ string
+	// Relay the started Source through the edge, returning the Source for the consumer.
+	relay func(p Pipeline, source any, e *edge, done func()) any
+}
+
+func newOutput[T any](stage *stage) *output {
+	return &output{
+		stage: stage,
+		typ:   reflect.TypeFor[T]().String(),
+		relay: func(p Pipeline, source any, e *edge, done func()) any {
+			return relay[T](p, source.(Source[T]), e, done)
+		},
+	}
+}
+
+// Node is the output of a registered stage, which can be the input of one other stage.
+type Node[T any] struct {
+	output *output
+}
+
+// Return the name of the stage with this output.
+func (node Node[T]) Stage() string {
+	if node.output == nil {
+		return ""
+	}
+	return node.output.stage.name
+}
+
+// StageOption configures a stage registered with a Builder.
+type StageOption func(*stage)
+
+// Declare the number of workers the stage runs, e.g. the MaxWorkers given to a Mapper, for a graph drawn before a run.
+// A graph with the report of a run shows the MaxWorkers of the stage's WorkerGroup instead.
+func WithParallelism(n int) StageOption {
+	return func(stage *stage) {
+		stage.parallelism = n
+	}
+}
+
+// Buffer each edge from the stage, so it can send up to n elements before its consumer receives them.
+// The stage's own output is buffered by the builder's default buffer size, or WithBufferSize given to the stage function.
+func WithEdgeBufferSize(n int) StageOption {
+	return func(stage *stage) {
+		stage.bufferSize = n
+	}
+}
+
+// Return a new empty builder for the named pipeline.
+func NewBuilder(name string) *Builder {
+	return &Builder{name: name}
+}
+
+// Set the logger of the pipeline, rather than the package logger, returning the builder.
+func (b *Builder) WithLogger(l *slog.Logger) *Builder {
+	b.logger = l
+	return b
+}
+
+// Buffer the output of each stage by size, unless the stage function is given WithBufferSize, returning the builder.
+// The edges between stages are buffered separately, see WithEdgeBufferSize.
+func (b *Builder) WithDefaultBufferSize(size int) *Builder {
+	b.bufferSize = size
+	return b
+}
+
+// Set the clock of the pipeline's time based stages, rather than the real clock, returning the builder.
+func (b *Builder) WithClock(c clock.Clock) *Builder {
+	b.clock = c
+	return b
+}
+
+func (b *Builder) Name() string {
+	return b.name
+}
+
+// Register a stage, connecting its inputs, and recording any problems for Validate.
+func (b *Builder) add(name string, kind StageKind, inputs []*output, valid bool, options []StageOption) *stage {
+	stage := &stage{builder: b, name: name, kind: kind, parallelism: 1}
+	for _, option := range options {
+		option(stage)
+	}
+	b.stages = append(b.stages, stage)
+
+	fail := func(err error) {
+		b.errs = append(b.errs, &StageError{name, err})
+	}
+
+	if name == "" {
+		fail(fmt.Errorf("%w: no name", ErrInvalidStage))
+	}
+	for _, other := range b.stages[:len(b.stages)-1] {
+		if other.name == name {
+			fail(ErrDuplicateStage)
+			break
+		}
+	}
+	if !valid {
+		fail(fmt.Errorf("%w: no function", ErrInvalidStage))
+	}
+	if stage.parallelism < 1 || stage.bufferSize < 0 {
+		fail(fmt.Errorf("%w: parallelism %d, buffer size %d", ErrInvalidStage, stage.parallelism, stage.bufferSize))
+	}
+
+	for _, input := range inputs {
+		if input == nil || input.stage.builder != b {
+			fail(ErrUnknownInput)
+			continue
+		}
+		if input.consumer != nil {
+			fail(fmt.Errorf("%w %q: %q", ErrInputConsumed, input.stage.name, input.consumer.name))
+			continue
+		}
+		input.consumer = stage
+		stage.inputs = append(stage.inputs, input)
+	}
+
+	return stage
+}
+
+// Register a source stage, created by f.
+func From[T any](b *Builder, name string, f func(Pipeline) Source[T], options ...StageOption) Node[T] {
+	stage := b.add(name, KindSource, nil, f != nil, options)
+	stage.start = func(p Pipeline, _ []any) ([]any, error) {
+		return started(f(p))
+	}
+	stage.outputs = []*output{newOutput[T](stage)}
+	return Node[T]{stage.outputs[0]}
+}
+
+// Register a stage, created by f, which consumes the input.
+func Via[T, R any](b *Builder, name string, input Node[T], f func(Pipeline, Source[T]) Source[R], options ...StageOption) Node[R] {
+	stage := b.add(name, KindIntermediate, []*output{input.output}, f != nil, options)
+	stage.start = func(p Pipeline, inputs []any) ([]any, error) {
+		return started(f(p, inputs[0].(Source[T])))
+	}
+	stage.outputs = []*output{newOutput[R](stage)}
+	return Node[R]{stage.outputs[0]}
+}
+
+// Register a stage which merges the inputs, see Merge.
+func Join[T any](b *Builder, name string, inputs []Node[T], options ...StageOption) Node[T] {
+	outputs := make([]*output, len(inputs))
+	for i, input := range inputs {
+		outputs[i] = input.output
+	}
+	stage := b.add(name, KindIntermediate, outputs, len(inputs) > 0, options)
+	stage.start = func(p Pipeline, inputs []any) ([]any, error) {
+		sources := make([]Source[T], len(inputs))
+		for i, input := range inputs {
+			sources[i] = input.(Source[T])
+		}
+		return started(Merge[T](p, sources...))
+	}
+	stage.outputs = []*output{newOutput[T](stage)}
+	return Node[T]{stage.outputs[0]}
+}
+
+// Register a stage which sends each element of the input to n outputs, see Broadcast.
+func Fork[T any](b *Builder, name string, input Node[T], n int, options ...StageOption) []Node[T] {
+	stage := b.add(name, KindIntermediate, []*output{input.output}, n > 0, options)
+	stage.start = func(p Pipeline, inputs []any) ([]any, error) {
+		outputs := []any{}
+		for _, output := range Broadcast[T](p, inputs[0].(Source[T]), n) {
+			outputs = append(outputs, output)
+		}
+		return outputs, nil
+	}
+
+	nodes := make([]Node[T], n)
+	for i := range nodes {
+		stage.outputs = append(stage.outputs, newOutput[T](stage))
+		nodes[i] = Node[T]{stage.outputs[i]}
+	}
+	return nodes
+}
+
+// Register a sink, which runs f until it returns.
+// If f returns an error the pipeline is cancelled with it.
+func Sink[T any](b *Builder, name string, input Node[T], f func(Pipeline, Source[T]) error, options ...StageOption) {
+	stage := b.add(name, KindSink, []*output{input.output}, f != nil, options)
+	stage.run = func(p Pipeline, inputs []any) error {
+		return f(p, inputs[0].(Source[T]))
+	}
+}
+
+// Return the outputs of a started stage, or an error if the stage returned no source.
+func started[T any](source Source[T]) ([]any, error) {
+	if source == nil {
+		return nil, fmt.Errorf("%w: nil source", ErrInvalidStage)
+	}
+	return []any{source}, nil
+}
+
+// Check the graph, returning every problem found, including outputs which are not consumed.
+func (b *Builder) Validate() error {
+	if len(b.stages) == 0 {
+		return ErrNoStages
+	}
+
+	errs := append([]error{}, b.errs...)
+	for _, stage := range b.stages {
+		for i, output := range stage.outputs {
+			if output.consumer != nil {
+				continue
+			}
+			switch {
+			case stage.kind == KindSource:
+				errs = append(errs, &StageError{stage.name, ErrUnconsumedSource})
+			case len(stage.outputs) > 1:
+				errs = append(errs, &StageError{stage.name, fmt.Errorf("%w: %d", ErrDanglingOutput, i)})
+			default:
+				errs = append(errs, &StageError{stage.name, ErrDanglingOutput})
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
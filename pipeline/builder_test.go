@@ -0,0 +1,286 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBuilderRun(t *testing.T) {
+	b := NewBuilder("even")
+
+	numbers := From(b, "numbers", func(p Pipeline) Source[int] {
+		return Slice(p, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	})
+	even := Via(b, "even", numbers, func(p Pipeline, input Source[int]) Source[int] {
+		return Filter(p, input, func(t int) (bool, error) { return t%2 == 0, nil })
+	})
+	tens := Via(b, "tens", even, func(p Pipeline, input Source[int]) Source[int] {
+		return Mapper(p, input, func(t int) (int, error) { return t * 10, nil }, *GroupOptions())
+	})
+
+	result := []int{}
+	Sink(b, "collect", tens, func(p Pipeline, input Source[int]) error {
+		return ForEach(p, input, func(t int) error { result = append(result, t); return nil })
+	})
+
+	report, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(result, []int{0, 20, 40, 60, 80}) {
+		t.Fatalf("result %v", result)
+	}
+
+	if len(report.Stages) != 4 {
+		t.Fatalf("stages %d", len(report.Stages))
+	}
+	if stage := report.Stage("numbers"); stage.Kind != KindSource || stage.End.IsZero() {
+		t.Fatalf("numbers %+v", stage)
+	}
+	if stage := report.Stage("collect"); stage.Kind != KindSink || !slices.Equal(stage.Inputs, []string{"tens"}) {
+		t.Fatalf("collect %+v", stage)
+	}
+
+	counts := map[string]int64{}
+	for _, edge := range report.Edges {
+		if edge.Type != "int" {
+			t.Fatalf("edge %+v", edge)
+		}
+		counts[edge.From+"->"+edge.To] = edge.Count
+	}
+	if counts["numbers->even"] != 10 || counts["even->tens"] != 5 || counts["tens->collect"] != 5 {
+		t.Fatalf("counts %v", counts)
+	}
+}
+
+func TestBuilderValidate(t *testing.T) {
+	if err := NewBuilder("empty").Validate(); !errors.Is(err, ErrNoStages) {
+		t.Fatalf("empty %v", err)
+	}
+
+	other := NewBuilder("other")
+	foreign := From(other, "foreign", func(p Pipeline) Source[int] { return EmptySlice[int](p) })
+
+	b := NewBuilder("invalid")
+	source := func(p Pipeline) Source[int] { return EmptySlice[int](p) }
+	identity := func(p Pipeline, input Source[int]) Source[int] { return input }
+	drop := func(p Pipeline, input Source[int]) error { return Drop(p, input) }
+
+	From(b, "unconsumed", source)
+	numbers := From(b, "numbers", source)
+	Via(b, "dangling", numbers, identity)
+	Sink(b, "twice", numbers, drop)
+	Sink(b, "foreign", foreign, drop)
+	Sink(b, "twice", From(b, "another", source), drop)
+
+	err := b.Validate()
+	for _, target := range []error{ErrUnconsumedSource, ErrDanglingOutput, ErrInputConsumed, ErrUnknownInput, ErrDuplicateStage} {
+		if !errors.Is(err, target) {
+			t.Fatalf("%v is not %v", err, target)
+		}
+	}
+
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Run(context.Background()); err == nil {
+		t.Fatal("run invalid builder")
+	}
+}
+
+func TestBuilderRunError(t *testing.T) {
+	b := NewBuilder("error")
+
+	failure := errors.New("failure")
+
+	numbers := From(b, "numbers", func(p Pipeline) Source[int] {
+		return Slice(p, []int{0, 1, 2, 3, 4, 5})
+	})
+	mapped := Via(b, "map", numbers, func(p Pipeline, input Source[int]) Source[int] {
+		return Mapper(p, input, func(t int) (int, error) {
+			if t == 3 {
+				return 0, failure
+			}
+			return t, nil
+		}, *GroupOptions())
+	})
+	Sink(b, "drop", mapped, func(p Pipeline, input Source[int]) error { return Drop(p, input) })
+
+	report, err := b.Run(context.Background())
+	if !errors.Is(err, failure) {
+		t.Fatalf("err %v", err)
+	}
+	if !errors.Is(report.Stage("map").Err, failure) {
+		t.Fatalf("map %+v", report.Stage("map"))
+	}
+	if report.Stage("numbers").Err != nil {
+		t.Fatalf("numbers %+v", report.Stage("numbers"))
+	}
+}
+
+func TestBuilderSinkError(t *testing.T) {
+	b := NewBuilder("sink")
+
+	failure := errors.New("failure")
+
+	numbers := From(b, "numbers", func(p Pipeline) Source[int] {
+		return Supplier(p, func() (int, error) { return 1, nil })
+	})
+	Sink(b, "fail", numbers, func(p Pipeline, input Source[int]) error {
+		return ForEach(p, input, func(t int) error { return failure })
+	})
+
+	report, err := b.Run(context.Background())
+	if !errors.Is(err, failure) || !errors.Is(report.Stage("fail").Err, failure) {
+		t.Fatalf("err %v", err)
+	}
+}
+
+func TestBuilderForkJoin(t *testing.T) {
+	b := NewBuilder("fork")
+
+	numbers := From(b, "numbers", func(p Pipeline) Source[int] {
+		return Slice(p, []int{1, 2, 3})
+	})
+	forks := Fork(b, "fork", numbers, 2)
+	doubled := Via(b, "double", forks[1], func(p Pipeline, input Source[int]) Source[int] {
+		return Mapper(p, input, func(t int) (int, error) { return t * 2, nil }, *GroupOptions())
+	})
+	joined := Join(b, "join", []Node[int]{forks[0], doubled})
+
+	sum := 0
+	Sink(b, "sum", joined, func(p Pipeline, input Source[int]) error {
+		return ForEach(p, input, func(t int) error { sum += t; return nil })
+	})
+
+	report, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != 18 {
+		t.Fatalf("sum %d", sum)
+	}
+	if stage := report.Stage("join"); !slices.Equal(stage.Inputs, []string{"fork", "double"}) {
+		t.Fatalf("join %+v", stage)
+	}
+}
+
+func TestBuilderStopsUpstream(t *testing.T) {
+	b := NewBuilder("limit")
+
+	numbers := From(b, "numbers", func(p Pipeline) Source[int] {
+		return Supplier(p, func() (int, error) { return 1, nil })
+	})
+	limited := Via(b, "limit", numbers, func(p Pipeline, input Source[int]) Source[int] {
+		return Limit(p, input, 5)
+	})
+
+	count := 0
+	Sink(b, "count", limited, func(p Pipeline, input Source[int]) error {
+		return ForEach(p, input, func(t int) error { count++; return nil })
+	})
+
+	if _, err := b.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Fatalf("count %d", count)
+	}
+
+	if _, err := b.Run(context.Background()); !errors.Is(err, ErrAlreadyRun) {
+		t.Fatalf("run again %v", err)
+	}
+}
+
+func TestBuilderCancel(t *testing.T) {
+	b := NewBuilder("cancel")
+
+	numbers := From(b, "numbers", func(p Pipeline) Source[int] {
+		return Supplier(p, func() (int, error) { return 1, nil })
+	})
+	Sink(b, "drop", numbers, func(p Pipeline, input Source[int]) error { return Drop(p, input) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := b.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err %v", err)
+	}
+}
+
+func TestBuilderShutdown(t *testing.T) {
+	b := NewBuilder("shutdown").WithDefaultBufferSize(4)
+
+	supplied := 0
+	numbers := From(b, "numbers", func(p Pipeline) Source[int] {
+		return Supplier(p, func() (int, error) { supplied++; return supplied, nil })
+	})
+	mapped := Via(b, "map", numbers, func(p Pipeline, input Source[int]) Source[int] {
+		return Mapper(p, input, func(t int) (int, error) { return t, nil }, *GroupOptions())
+	}, WithEdgeBufferSize(4))
+
+	if err := b.Shutdown(context.Background()); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("shutdown before run %v", err)
+	}
+
+	count := 0
+	shutdown := make(chan error)
+	Sink(b, "count", mapped, func(p Pipeline, input Source[int]) error {
+		return ForEach(p, input, func(t int) error {
+			if count++; count == 10 {
+				go func() { shutdown <- b.Shutdown(context.Background()) }()
+			}
+			return nil
+		})
+	})
+
+	report, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+	if !report.Drained || count != supplied || count < 10 {
+		t.Fatalf("drained %v count %d supplied %d", report.Drained, count, supplied)
+	}
+}
+
+func TestBuilderShutdownTimeout(t *testing.T) {
+	b := NewBuilder("shutdown timeout")
+
+	numbers := From(b, "numbers", func(p Pipeline) Source[int] {
+		return Slice(p, []int{1, 2, 3})
+	})
+
+	release := make(chan struct{})
+	Sink(b, "blocked", numbers, func(p Pipeline, input Source[int]) error {
+		<-release
+		return Drop(p, input)
+	})
+
+	done := make(chan *Report)
+	go func() {
+		report, _ := b.Run(context.Background())
+		done <- report
+	}()
+
+	waitForStatus(t, "shutdown timeout", func(status RunStatus) bool { return true })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown %v", err)
+	}
+
+	close(release)
+	if report := <-done; report.Drained {
+		t.Fatalf("drained %v", report)
+	}
+}
@@ -2,17 +2,18 @@ package pipeline
 
 import (
 	"cmp"
-	"fmt"
+	"errors"
 	"sync"
+	"time"
 )
 
-func Count[T any](pipeline pipeline, input chan T) (optional[int], error) {
+func Count[T any](pipeline Pipeline, input Source[T]) (optional[int], error) {
 	count := 0
 	err := ForEach[T](pipeline, input, func(t T) error { count++; return nil })
 	return Optional[int](count), err
 }
 
-func Min[T cmp.Ordered](pipeline pipeline, input chan T) (optional[T], error) {
+func Min[T cmp.Ordered](pipeline Pipeline, input Source[T]) (optional[T], error) {
 	var min T
 	defined := false
 	consumer := func(t T) error {
@@ -27,10 +28,11 @@ func Min[T cmp.Ordered](pipeline pipeline, input chan T) (optional[T], error) {
 		return nil
 	}
 
-	return optional[T]{min, defined}, ForEach[T](pipeline, input, consumer)
+	err := ForEach[T](pipeline, input, consumer)
+	return optional[T]{min, defined}, err
 }
 
-func Max[T cmp.Ordered](pipeline pipeline, input chan T) (optional[T], error) {
+func Max[T cmp.Ordered](pipeline Pipeline, input Source[T]) (optional[T], error) {
 	var max T
 	defined := false
 	consumer := func(t T) error {
@@ -44,10 +46,11 @@ func Max[T cmp.Ordered](pipeline pipeline, input chan T) (optional[T], error) {
 		}
 		return nil
 	}
-	return Raw[T](max, defined), ForEach[T](pipeline, input, consumer)
+	err := ForEach[T](pipeline, input, consumer)
+	return Raw[T](max, defined), err
 }
 
-func ToSlice[T any](pipeline pipeline, input chan T) (optional[[]T], error) {
+func ToSlice[T any](pipeline Pipeline, input Source[T]) (optional[[]T], error) {
 	result := []T{}
 	defined := false
 	counter := func(t T) error {
@@ -55,12 +58,13 @@ func ToSlice[T any](pipeline pipeline, input chan T) (optional[[]T], error) {
 		result = append(result, t)
 		return nil
 	}
-	return Raw[[]T](result, defined), ForEach[T](pipeline, input, counter)
+	err := ForEach[T](pipeline, input, counter)
+	return Raw[[]T](result, defined), err
 }
 
 // Collect T in a map[K][]T which is created by applying mapper(T)(K,error) to produce a map key and adding T to the value []T.
 // If the mapper returns an error the collection is stopped.
-func GroupBy[T any, K cmp.Ordered](pipeline pipeline, input chan T, mapper func(t T) (K, error)) (optional[map[K][]T], error) {
+func GroupBy[T any, K cmp.Ordered](pipeline Pipeline, input Source[T], mapper func(t T) (K, error)) (optional[map[K][]T], error) {
 	result := make(map[K][]T)
 	defined := false
 
@@ -78,7 +82,8 @@ func GroupBy[T any, K cmp.Ordered](pipeline pipeline, input chan T, mapper func(
 		return nil
 	}
 
-	return Raw[map[K][]T](result, defined), ForEach[T](pipeline, input, adder)
+	err := ForEach[T](pipeline, input, adder)
+	return Raw[map[K][]T](result, defined), err
 }
 
 type to[T, A any] interface {
@@ -86,18 +91,42 @@ type to[T, A any] interface {
 	result() (A, error)
 }
 
+// Collect the input into an R, accumulating the elements into A's supplied for up to 4 workers, combining the A's and finishing the result.
+// An error or panic in the supplier, accumulator or combiner cancels the pipeline and is returned, a panic as a PanicError.
 func To[T, A, R any](
-	pipeline pipeline,
-	input chan T,
+	pipeline Pipeline,
+	input Source[T],
 	supplier func() (A, error),
 	accumulator func(A, T) (A, error),
 	combiner func(A, A) (A, error),
 	finisher func(A) (R, error),
 ) (optional[R], error) {
+	sink := newSink(pipeline, "To")
+	defer pipeline.FlowDone(sink)
 
-	result, err := supplier()
+	logger, stage := sink.logger, sink.metrics
+
+	// The errors the callbacks failed with, each cancels the pipeline.
+	errLock := sync.Mutex{}
+	var errs error
+	fail := func(err error) {
+		errLock.Lock()
+		errs = errors.Join(errs, err)
+		errLock.Unlock()
+		pipeline.CancelWithError(err)
+	}
+
+	supply := func() (a A, err error) {
+		err = protect("To", nil, func() (err error) {
+			a, err = supplier()
+			return err
+		})
+		return a, err
+	}
+
+	result, err := supply()
 	if err != nil {
-		return Empty[R](), err
+		return Empty[R](), pipeline.CancelWithError(err)
 	}
 
 	defined := false
@@ -113,23 +142,26 @@ func To[T, A, R any](
 	rwg.Add(1)
 	go func() {
 		defer func() {
-			fmt.Printf("closing result combiner\n")
+			logger.Debug("Closing result combiner")
 			rwg.Done()
 		}()
 
 		for {
 			select {
 			case a, ok := <-resultInput:
-				fmt.Printf("receive result combiner a[%v] ok[%v]\n", a, ok)
+				logger.Debug("Receive result combiner", "a", a, "ok", ok)
 				if !ok {
 					return
 				}
 				defined = true
-				r, err := combiner(result, a)
+				err := protect("To", a, func() (err error) {
+					result, err = combiner(result, a)
+					return err
+				})
 				if err != nil {
+					fail(err)
 					return
 				}
-				result = r
 			case <-pipeline.Done():
 				return
 			}
@@ -141,19 +173,22 @@ func To[T, A, R any](
 	wg.Add(1)
 	go func() {
 		defer func() {
-			fmt.Printf("close shim\n")
+			logger.Debug("Close shim")
 			close(workerInput)
 
 			wg.Done()
 		}()
 
 		for {
+			start := time.Now()
 			select {
-			case t, ok := <-input:
-				fmt.Printf("receive [%v] [%v]\n", t, ok)
+			case t, ok := <-input.Output():
+				logger.Debug("Receive", "t", t, "ok", ok)
 				if !ok {
 					return
 				}
+				// Done once a worker has accumulated t.
+				stage.Received(start)
 
 				select {
 				case workerInput <- t: // There is a free worker.
@@ -172,35 +207,44 @@ func To[T, A, R any](
 						workerCount++
 						wg.Add(1)
 						go func() {
-							fmt.Printf("worker [%v]\n", workerCount)
-							a, err := supplier()
-							fmt.Printf("supplied a[%v]\n", a)
+							defer wg.Done()
+
+							logger.Debug("Worker", "WorkerCount", workerCount)
+							a, err := supply()
+							logger.Debug("Supplied", "a", a)
 							if err != nil {
-								pipeline.Cancel()
+								fail(err)
 								return
 							}
 
 							defer func() {
-								fmt.Printf("closing worker returning a[%v]\n", a)
-								resultInput <- a
-								fmt.Printf("done worker\n")
-								wg.Done()
+								logger.Debug("Closing worker", "a", a)
+								select {
+								case resultInput <- a:
+								case <-pipeline.Done():
+								}
+								logger.Debug("Done worker")
 							}()
 
 							for {
 								select {
 								case t, ok := <-workerInput:
-									fmt.Printf("worker receive from shim t[%v] ok[%v]\n", t, ok)
+									logger.Debug("Worker receive from shim", "t", t, "ok", ok)
 									if !ok {
 										return
 									}
-									r, err := accumulator(a, t)
-									fmt.Printf("accumulated a[%v] t[%v] r[%v]\n", a, t, r)
+									start := time.Now()
+									err := protect("To", t, func() (err error) {
+										a, err = accumulator(a, t)
+										return err
+									})
+									stage.Called(start, err)
+									stage.Done()
+									logger.Debug("Accumulated", "a", a, "t", t)
 									if err != nil {
-										pipeline.Cancel()
+										fail(err)
 										return
 									}
-									a = r
 								case <-pipeline.Done():
 									return
 								}
@@ -223,12 +267,16 @@ func To[T, A, R any](
 
 	// Wait for the core and workers to finish
 	wg.Wait()
-	fmt.Printf("workers complete\n")
+	logger.Debug("Workers complete")
 
 	close(resultInput)
 
 	rwg.Wait()
-	fmt.Printf("result combiner complete\n")
+	logger.Debug("Result combiner complete")
+
+	if errs != nil {
+		return Empty[R](), errs
+	}
 
 	r, err := finisher(result)
 
@@ -0,0 +1,241 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"example.com/m/v2/logging"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Set the fields of the struct pointed to by v from the environment.
+// Fields are mapped with an `env:"NAME"` tag, fields without a tag are left alone unless they are structs, which are loaded recursively.
+// Fields whose variable is not defined keep their current value, so set defaults before loading.
+// The supported field types are those of EnvType.
+//
+//	type Config struct {
+//		Workers int           `env:"WORKERS"`
+//		Timeout time.Duration `env:"TIMEOUT"`
+//	}
+func LoadEnv(v any) error {
+	value, err := structValue(v)
+	if err != nil {
+		return err
+	}
+	return loadEnv(value)
+}
+
+func loadEnv(value reflect.Value) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		k, ok := field.Tag.Lookup("env")
+		if !ok {
+			if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+				if err := loadEnv(value.Field(i)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		s, ok := os.LookupEnv(k)
+		if !ok {
+			continue
+		}
+		if err := setField(value.Field(i), s); err != nil {
+			return &EnvError{k, s, err}
+		}
+	}
+	return nil
+}
+
+// Set the given field by parsing s.
+func setField(field reflect.Value, s string) error {
+	if !field.CanAddr() {
+		return fmt.Errorf("field not addressable %v", field.Type())
+	}
+	return parseEnv(s, field.Addr().Interface())
+}
+
+// Load the struct pointed to by v from the given JSON config file, then override it from the environment, see LoadEnv.
+// If path is "" only the environment is loaded.
+// Fields are matched to the file by their `json:"name"` tag or field name, a duration may be given as a string such as "1m30s".
+func LoadConfig(path string, v any) error {
+	value, err := structValue(v)
+	if err != nil {
+		return err
+	}
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := loadJSON(b, value); err != nil {
+			return fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+
+	return loadEnv(value)
+}
+
+func loadJSON(b []byte, value reflect.Value) error {
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			if tag = strings.Split(tag, ",")[0]; tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+		}
+
+		b, ok := raw[name]
+		if !ok {
+			continue
+		}
+
+		// Allow a duration, or any other field, to be given as a string to be parsed like the environment.
+		if field.Type != reflect.TypeOf("") && bytes.HasPrefix(bytes.TrimSpace(b), []byte(`"`)) {
+			s := ""
+			if err := json.Unmarshal(b, &s); err != nil {
+				return err
+			}
+			if err := setField(value.Field(i), s); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			continue
+		}
+
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			if err := loadJSON(b, value.Field(i)); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			continue
+		}
+
+		if err := json.Unmarshal(b, value.Field(i).Addr().Interface()); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func structValue(v any) (reflect.Value, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return value, fmt.Errorf("expected a pointer to a struct, got %T", v)
+	}
+	return value.Elem(), nil
+}
+
+// PipelineConfig configures every stage of a pipeline in one place.
+// Load it with LoadPipelineConfig, then use it to create the pipeline and the stage options.
+//
+//	config, err := LoadPipelineConfig("pipeline.json")
+//	p := config.WithCancel(context.Background())
+//	mapper := Mapper[int](p, input, f, *config.GroupOptions())
+type PipelineConfig struct {
+	// The maximum workers in a WorkerGroup or Mapper.
+	MaxWorkers int `json:"max_workers" env:"PIPELINE_GROUP_MAX_WORKERS"`
+	// How long a worker waits for input before exiting.
+	IdleWorkerDuration time.Duration `json:"idle_worker_duration" env:"PIPELINE_GROUP_IDLE_WORKER_DURATION"`
+	// The buffer size of each stage's output channel.
+	BufferSize int `json:"buffer_size" env:"PIPELINE_BUFFER_SIZE"`
+	// The maximum time the pipeline runs for, 0 for no timeout.
+	Timeout time.Duration `json:"timeout" env:"PIPELINE_TIMEOUT"`
+	// One of DEBUG, INFO, WARN or ERROR.
+	LogLevel string `json:"log_level" env:"PIPELINE_LOG_LEVEL"`
+}
+
+// Return the default config, matching GroupOptions().
+func DefaultPipelineConfig() PipelineConfig {
+	opts := GroupOptions()
+	return PipelineConfig{
+		MaxWorkers:         opts.MaxWorkers,
+		IdleWorkerDuration: opts.IdleWorkerDuration,
+		BufferSize:         0,
+		Timeout:            0,
+		LogLevel:           logging.Level().String(),
+	}
+}
+
+// Check the config is usable.
+func (config PipelineConfig) Validate() error {
+	errs := []error{}
+	if config.MaxWorkers < 1 {
+		errs = append(errs, fmt.Errorf("max_workers %d < 1", config.MaxWorkers))
+	}
+	if config.IdleWorkerDuration <= 0 {
+		errs = append(errs, fmt.Errorf("idle_worker_duration %v <= 0", config.IdleWorkerDuration))
+	}
+	if config.BufferSize < 0 {
+		errs = append(errs, fmt.Errorf("buffer_size %d < 0", config.BufferSize))
+	}
+	if config.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("timeout %v < 0", config.Timeout))
+	}
+	if _, err := config.Level(); err != nil {
+		errs = append(errs, fmt.Errorf("log_level %s: %w", config.LogLevel, err))
+	}
+	return errors.Join(errs...)
+}
+
+func (config PipelineConfig) Level() (slog.Level, error) {
+	level := slog.LevelInfo
+	err := level.UnmarshalText([]byte(config.LogLevel))
+	return level, err
+}
+
+// Return the group options for a WorkerGroup or Mapper.
+func (config PipelineConfig) GroupOptions() *groupOptions {
+	opts := GroupOptions()
+	opts.MaxWorkers = config.MaxWorkers
+	opts.IdleWorkerDuration = config.IdleWorkerDuration
+	return opts
+}
+
+// Return a new cancellable pipeline, with the config timeout if there is one and the config buffer size, logging at the config level.
+func (config PipelineConfig) WithCancel(parent context.Context) *pipeline {
+	var p *pipeline
+	if config.Timeout > 0 {
+		p = WithTimeout(parent, time.Now().Add(config.Timeout))
+	} else {
+		p = WithCancel(parent)
+	}
+
+	level, _ := config.Level()
+	return p.WithDefaultBufferSize(config.BufferSize).WithLogger(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+}
+
+// Return the default config overridden by the given JSON config file, if path is not "", and then the environment.
+func LoadPipelineConfig(path string) (PipelineConfig, error) {
+	config := DefaultPipelineConfig()
+	if err := LoadConfig(path, &config); err != nil {
+		return config, err
+	}
+	return config, config.Validate()
+}
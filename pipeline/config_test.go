@@ -0,0 +1,60 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadEnv(t *testing.T) {
+	type nested struct {
+		Names []string `env:"PIPELINE_TEST_NAMES"`
+	}
+	config := struct {
+		Workers int           `env:"PIPELINE_TEST_WORKERS"`
+		Timeout time.Duration `env:"PIPELINE_TEST_TIMEOUT"`
+		Other   string
+		Nested  nested
+	}{Workers: 1, Timeout: time.Second, Other: "other"}
+
+	t.Setenv("PIPELINE_TEST_WORKERS", "8")
+	t.Setenv("PIPELINE_TEST_NAMES", "a,b")
+
+	if err := LoadEnv(&config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Workers != 8 || config.Timeout != time.Second || config.Other != "other" || len(config.Nested.Names) != 2 {
+		t.Fatalf("config [%+v]", config)
+	}
+
+	if err := LoadEnv(config); err == nil {
+		t.Fatal("not a pointer")
+	}
+}
+
+func TestLoadPipelineConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipeline.json")
+	if err := os.WriteFile(path, []byte(`{"max_workers": 4, "timeout": "1m", "buffer_size": 16, "log_level": "WARN"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The environment overrides the file.
+	t.Setenv("PIPELINE_GROUP_MAX_WORKERS", "2")
+
+	config, err := LoadPipelineConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MaxWorkers != 2 || config.Timeout != time.Minute || config.BufferSize != 16 || config.LogLevel != "WARN" || config.IdleWorkerDuration != time.Minute {
+		t.Fatalf("config [%+v]", config)
+	}
+	if opts := config.GroupOptions(); opts.MaxWorkers != 2 {
+		t.Fatalf("opts [%+v]", opts)
+	}
+
+	t.Setenv("PIPELINE_LOG_LEVEL", "LOUD")
+	if _, err := LoadPipelineConfig(path); err == nil {
+		t.Fatal("invalid log level")
+	}
+}
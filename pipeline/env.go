@@ -1,11 +1,17 @@
 package pipeline
 
 import (
+	"cmp"
 	"errors"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
+var ErrEnvNotDefined = errors.New("Environment variable not defined")
+
 func GetEnv(k string) (string, error) {
 	logger := Logger().With("f", "GetEnv")
 	s, ok := os.LookupEnv(k)
@@ -13,7 +19,7 @@ func GetEnv(k string) (string, error) {
 	if ok {
 		return s, nil
 	}
-	return s, errors.New("Environment variable not defined")
+	return s, ErrEnvNotDefined
 }
 
 func GetEnvAsInt(k string) (int, error) {
@@ -24,14 +30,142 @@ func GetEnvAsInt(k string) (int, error) {
 	return strconv.Atoi(s)
 }
 
+// The types Env can parse.
+// Lists are comma separated, e.g. "a, b,c".
+type EnvType interface {
+	string | int | int64 | float64 | bool | time.Duration | []string | []int
+}
+
+// EnvError is returned when an environment variable cannot be parsed or is invalid.
+type EnvError struct {
+	Key   string
+	Value string
+	Err   error
+}
+
+func (e *EnvError) Error() string {
+	return fmt.Sprintf("environment variable %s [%s]: %v", e.Key, e.Value, e.Err)
+}
+
+func (e *EnvError) Unwrap() error {
+	return e.Err
+}
+
+// Return the environment variable k as a T, or the given default if k is not defined.
+// The value, including the default, is checked by each validator in turn.
+//
+//	workers, err := Env("PIPELINE_GROUP_MAX_WORKERS", 1, Between(1, 64))
+//
 // https://appliedgo.com/blog/a-tip-and-a-trick-when-working-with-generics
-// func Env[T any](k string, or T) (T, error) {
-// 	s, ok := os.LookupEnv(workMaxEnv)
-// 	if ok {
-// 		switch any(or).(type) {
-// 		case string:
+func Env[T EnvType](k string, or T, validators ...func(T) error) (T, error) {
+	t := or
+
+	s, ok := os.LookupEnv(k)
+	if ok {
+		if err := parseEnv(s, &t); err != nil {
+			return or, &EnvError{k, s, err}
+		}
+	}
+
+	for _, validator := range validators {
+		if err := validator(t); err != nil {
+			return or, &EnvError{k, s, err}
+		}
+	}
 
-// 		}
+	return t, nil
+}
+
+// Parse s into t, which must be a pointer to an EnvType.
+func parseEnv(s string, t any) error {
+	switch t := t.(type) {
+	case *string:
+		*t = s
+	case *int:
+		i, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		*t = i
+	case *int64:
+		i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return err
+		}
+		*t = i
+	case *float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return err
+		}
+		*t = f
+	case *bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		*t = b
+	case *time.Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		*t = d
+	case *[]string:
+		*t = splitList(s)
+	case *[]int:
+		list := []int{}
+		for _, e := range splitList(s) {
+			i, err := strconv.Atoi(e)
+			if err != nil {
+				return err
+			}
+			list = append(list, i)
+		}
+		*t = list
+	default:
+		return fmt.Errorf("unsupported type %T", t)
+	}
+	return nil
+}
 
-// 	}
-// }
+// Split a comma separated list, trimming each element and dropping empty elements.
+func splitList(s string) []string {
+	list := []string{}
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// Return a validator which checks min <= t <= max.
+func Between[T cmp.Ordered](min, max T) func(T) error {
+	return func(t T) error {
+		if t < min || t > max {
+			return fmt.Errorf("%v not between %v and %v", t, min, max)
+		}
+		return nil
+	}
+}
+
+// Return a validator which checks t is one of the given values.
+func OneOf[T comparable](values ...T) func(T) error {
+	return func(t T) error {
+		for _, v := range values {
+			if t == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("%v not one of %v", t, values)
+	}
+}
+
+// Validator which checks a string or list is not empty.
+func NotEmpty[T ~string | ~[]string | ~[]int](t T) error {
+	if len(t) == 0 {
+		return errors.New("empty")
+	}
+	return nil
+}
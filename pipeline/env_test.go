@@ -0,0 +1,55 @@
+package pipeline
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEnv(t *testing.T) {
+	t.Setenv("PIPELINE_TEST_INT", "4")
+	t.Setenv("PIPELINE_TEST_DURATION", "1m30s")
+	t.Setenv("PIPELINE_TEST_LIST", "a, b,,c")
+	t.Setenv("PIPELINE_TEST_BOOL", "true")
+	t.Setenv("PIPELINE_TEST_FLOAT", "0.5")
+
+	if i, err := Env("PIPELINE_TEST_INT", 1); i != 4 || err != nil {
+		t.Fatalf("int [%v] [%v]", i, err)
+	}
+	if d, err := Env("PIPELINE_TEST_DURATION", time.Second); d != 90*time.Second || err != nil {
+		t.Fatalf("duration [%v] [%v]", d, err)
+	}
+	if l, err := Env("PIPELINE_TEST_LIST", []string{}); !reflect.DeepEqual(l, []string{"a", "b", "c"}) || err != nil {
+		t.Fatalf("list [%v] [%v]", l, err)
+	}
+	if b, err := Env("PIPELINE_TEST_BOOL", false); !b || err != nil {
+		t.Fatalf("bool [%v] [%v]", b, err)
+	}
+	if f, err := Env("PIPELINE_TEST_FLOAT", 1.0); f != 0.5 || err != nil {
+		t.Fatalf("float [%v] [%v]", f, err)
+	}
+	if s, err := Env("PIPELINE_TEST_UNDEFINED", "or"); s != "or" || err != nil {
+		t.Fatalf("default [%v] [%v]", s, err)
+	}
+}
+
+func TestEnvInvalid(t *testing.T) {
+	t.Setenv("PIPELINE_TEST_INT", "four")
+
+	envError := &EnvError{}
+	if i, err := Env("PIPELINE_TEST_INT", 1); i != 1 || !errors.As(err, &envError) || envError.Key != "PIPELINE_TEST_INT" {
+		t.Fatalf("int [%v] [%v]", i, err)
+	}
+
+	t.Setenv("PIPELINE_TEST_INT", "100")
+	if _, err := Env("PIPELINE_TEST_INT", 1, Between(1, 64)); err == nil {
+		t.Fatal("between")
+	}
+	if _, err := Env("PIPELINE_TEST_UNDEFINED", "", NotEmpty[string]); err == nil {
+		t.Fatal("not empty")
+	}
+	if _, err := Env("PIPELINE_TEST_UNDEFINED", "c", OneOf("a", "b")); err == nil {
+		t.Fatal("one of")
+	}
+}
@@ -1,44 +1,61 @@
 package pipeline
 
-import "github.com/google/uuid"
+import (
+	"context"
+	"time"
+)
 
-func Filter[T any](pipeline pipeline, input chan T, predicate func(t T) (bool, error)) chan T {
-	logger := Logger().With("Filter", uuid.New())
-	logger.Debug("Begin")
+func Filter[T any](pipeline Pipeline, input Source[T], predicate func(t T) (bool, error), options ...SourceOption) *source[T] {
+	return FilterContext(pipeline, input, func(_ context.Context, t T) (bool, error) { return predicate(t) }, options...)
+}
 
-	output := make(chan T)
+// Filter the input like Filter, calling the predicate with the pipeline's context, or a child context if given WithElementTimeout.
+// An element whose call timed out is dropped.
+func FilterContext[T any](pipeline Pipeline, input Source[T], predicate func(ctx context.Context, t T) (bool, error), options ...SourceOption) *source[T] {
+	output := NewSource[T](pipeline, "Filter", options...)
+	logger := output.Logger()
+	logger.Debug("Begin")
 
 	go func() {
 		tCount := 0
 		tPermit := 0
 
 		defer func() {
-			close(output)
+			close(output.Output())
 			logger.Debug("End", "Count", tCount, "Permit", tPermit)
+			pipeline.FlowDone(output)
 		}()
 
 		for {
+			start := time.Now()
 			select {
-			case t, ok := <-input:
+			case t, ok := <-input.Output():
 				if !ok {
 					return
 				}
+				output.received(start)
 				tCount++
-				permit, err := predicate(t)
+				permit := false
+				_, err := output.call(pipeline, t, func(ctx context.Context) (err error) {
+					permit, err = predicate(ctx, t)
+					return err
+				})
 				if err != nil {
+					output.done()
 					pipeline.CancelWithError(err)
 					return
 				}
 				if !permit {
+					output.done()
 					break
 				}
 				tPermit++
-				select {
-				case output <- t:
-				case <-pipeline.ctx.Done():
+				sent := output.send(pipeline, t)
+				output.done()
+				if !sent {
 					return
 				}
-			case <-pipeline.ctx.Done():
+			case <-pipeline.Done():
 				return
 			}
 		}
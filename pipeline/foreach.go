@@ -1,15 +1,46 @@
 package pipeline
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"time"
 
-func ForEach[T any](pipeline pipeline, input chan T, consumer func(t T) error) error {
+	"example.com/m/v2/metrics"
+)
+
+func ForEach[T any](pipeline Pipeline, input Source[T], consumer func(t T) error) error {
+	return ForEachContext(pipeline, input, func(_ context.Context, t T) error { return consumer(t) })
+}
+
+// Consume the input like ForEach, calling the consumer with the pipeline's context.
+// For a timeout per element use ForEachTerminalContext with WithElementTimeout.
+func ForEachContext[T any](pipeline Pipeline, input Source[T], consumer func(ctx context.Context, t T) error) error {
+	sink := newSink(pipeline, "ForEach")
+	defer pipeline.FlowDone(sink)
+
+	stage := sink.metrics
+	ctx := metrics.NewContext(pipeline.CTX(), stage)
+	return forEach(pipeline, input, stage, func(t T) error {
+		start := time.Now()
+		err := protect("ForEach", t, func() error { return consumer(ctx, t) })
+		stage.Called(start, err)
+		return err
+	})
+}
+
+// Call f for each element of the input until it returns an error, recording the elements received in the stage's metrics.
+func forEach[T any](pipeline Pipeline, input Source[T], stage *metrics.Stage, f func(t T) error) error {
 	for {
+		start := time.Now()
 		select {
-		case t, ok := <-input:
+		case t, ok := <-input.Output():
 			if !ok {
 				return nil
 			}
-			if err := consumer(t); err != nil {
+			stage.Received(start)
+			err := f(t)
+			stage.Done()
+			if err != nil {
 				return err
 			}
 		case <-pipeline.Done():
@@ -18,11 +49,65 @@ func ForEach[T any](pipeline pipeline, input chan T, consumer func(t T) error) e
 	}
 }
 
-func StdOutV[T any](pipeline pipeline, input chan T) error {
+// Call the consumer for each element of the input in a new stage, which outputs the count of elements consumed once the input is closed.
+// If the consumer returns an error the pipeline is cancelled with it.
+//
+//	<-ForEachTerminal[int](p, input, consumer).Output()
+func ForEachTerminal[T any](pipeline Pipeline, input Source[T], consumer func(t T) error, options ...SourceOption) *source[int] {
+	return ForEachTerminalContext(pipeline, input, func(_ context.Context, t T) error { return consumer(t) }, options...)
+}
+
+// Consume the input like ForEachTerminal, calling the consumer with the pipeline's context, or a child context if given WithElementTimeout.
+// An element whose call timed out is not counted.
+func ForEachTerminalContext[T any](pipeline Pipeline, input Source[T], consumer func(ctx context.Context, t T) error, options ...SourceOption) *source[int] {
+	output := NewSource[int](pipeline, "ForEachTerminal", options...)
+
+	go func() {
+		count := 0
+
+		defer func() {
+			close(output.Output())
+			output.Metrics("Count", count)
+			pipeline.FlowDone(output)
+		}()
+
+		err := forEach(pipeline, input, output.metrics, func(t T) error {
+			called, err := output.call(pipeline, t, func(ctx context.Context) error { return consumer(ctx, t) })
+			if err != nil {
+				return err
+			}
+			if called {
+				count++
+			}
+			return nil
+		})
+		if err != nil {
+			pipeline.CancelWithError(err)
+			return
+		}
+
+		output.send(pipeline, count)
+	}()
+
+	return output
+}
+
+func StdOutV[T any](pipeline Pipeline, input Source[T]) error {
 	return ForEach[T](pipeline, input, func(t T) error { fmt.Printf("%v\n", t); return nil })
 }
 
+// Print each element of the input in a new stage, see ForEachTerminal.
+func ForEachStdOutV[T any](pipeline Pipeline, input Source[T], options ...SourceOption) *source[int] {
+	return ForEachTerminal[T](pipeline, input, func(t T) error { fmt.Printf("%v\n", t); return nil }, options...)
+}
+
+// Consumer which prints t.
+func StdOutConsumer[T any](pipeline Pipeline, t T) error {
+	fmt.Printf("%v\n", t)
+	return nil
+}
+
 // Drop everything from the input, AKA /dev/null, blackhole, etc...
-func Drop[T any](pipeline pipeline, input chan T) error {
+func Drop[T any](pipeline Pipeline, input Source[T]) error {
 	return ForEach[T](pipeline, input, func(t T) error { return nil })
 }
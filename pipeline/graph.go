@@ -0,0 +1,181 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Graph describes the stages of a Builder and the edges between them, with the element counts of a run if there is a report.
+type Graph struct {
+	Name   string
+	Stages []GraphStage
+	Edges  []GraphEdge
+}
+
+type GraphStage struct {
+	Name string
+	Kind StageKind
+	// The workers the stage ran if there is a report, otherwise as declared with WithParallelism.
+	Parallelism int
+	BufferSize  int
+	// Whether the stage failed in the run.
+	Failed bool
+}
+
+type GraphEdge struct {
+	From string
+	To   string
+	// The element type.
+	Type       string
+	BufferSize int
+	// The elements sent in the run, -1 if the graph has no report.
+	Count int64
+}
+
+// Return the graph of the builder, with the counts from the report of a run, or nil.
+func (b *Builder) Graph(report *Report) *Graph {
+	graph := &Graph{Name: b.name}
+
+	counts := map[[2]string]int64{}
+	if report != nil {
+		for _, edge := range report.Edges {
+			counts[[2]string{edge.From, edge.To}] += edge.Count
+		}
+	}
+
+	for _, stage := range b.stages {
+		failed := false
+		parallelism := stage.parallelism
+		if report != nil {
+			if stageReport := report.Stage(stage.name); stageReport != nil {
+				failed = stageReport.Err != nil
+				if stageReport.Parallelism > 0 {
+					parallelism = stageReport.Parallelism
+				}
+			}
+		}
+		graph.Stages = append(graph.Stages, GraphStage{stage.name, stage.kind, parallelism, stage.bufferSize, failed})
+
+		for _, output := range stage.outputs {
+			if output.consumer == nil {
+				continue
+			}
+			count := int64(-1)
+			if report != nil {
+				count = counts[[2]string{stage.name, output.consumer.name}]
+			}
+			graph.Edges = append(graph.Edges, GraphEdge{stage.name, output.consumer.name, output.typ, stage.bufferSize, count})
+		}
+	}
+
+	return graph
+}
+
+// Return the label of a stage, its name, kind and parallelism if it has more than one worker.
+func (stage GraphStage) label() []string {
+	label := []string{stage.Name, string(stage.Kind)}
+	if stage.Parallelism > 1 {
+		label[1] += fmt.Sprintf(" x%d", stage.Parallelism)
+	}
+	return label
+}
+
+// Return the label of an edge, its type, buffer size and count.
+func (edge GraphEdge) label() []string {
+	label := []string{edge.Type}
+	if edge.BufferSize > 0 {
+		label[0] += fmt.Sprintf(" [%d]", edge.BufferSize)
+	}
+	if edge.Count >= 0 {
+		label = append(label, fmt.Sprint(edge.Count))
+	}
+	return label
+}
+
+// Write the graph in the Graphviz DOT language.
+//
+//	dot -Tsvg pipeline.dot > pipeline.svg
+func (graph *Graph) WriteDOT(w io.Writer) error {
+	b := &strings.Builder{}
+
+	fmt.Fprintf(b, "digraph %s {\n", dotQuote(graph.Name))
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box];\n")
+	for _, stage := range graph.Stages {
+		attrs := fmt.Sprintf("label=%s", dotQuote(strings.Join(stage.label(), "\n")))
+		switch stage.Kind {
+		case KindSource:
+			attrs += ", shape=invhouse"
+		case KindSink:
+			attrs += ", shape=house"
+		}
+		if stage.Failed {
+			attrs += ", color=red"
+		}
+		fmt.Fprintf(b, "\t%s [%s];\n", dotQuote(stage.Name), attrs)
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(b, "\t%s -> %s [label=%s];\n", dotQuote(edge.From), dotQuote(edge.To), dotQuote(strings.Join(edge.label(), "\n")))
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Write the graph as a Mermaid flowchart, which renders in Markdown on GitHub and GitLab.
+func (graph *Graph) WriteMermaid(w io.Writer) error {
+	b := &strings.Builder{}
+
+	ids := map[string]string{}
+	b.WriteString("flowchart LR\n")
+	for i, stage := range graph.Stages {
+		id := fmt.Sprintf("s%d", i)
+		ids[stage.Name] = id
+
+		label := mermaidQuote(strings.Join(stage.label(), "<br/>"))
+		switch stage.Kind {
+		case KindSource:
+			fmt.Fprintf(b, "\t%s([%s])\n", id, label)
+		case KindSink:
+			fmt.Fprintf(b, "\t%s[[%s]]\n", id, label)
+		default:
+			fmt.Fprintf(b, "\t%s[%s]\n", id, label)
+		}
+		if stage.Failed {
+			fmt.Fprintf(b, "\tstyle %s stroke:red\n", id)
+		}
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(b, "\t%s -->|%s| %s\n", ids[edge.From], mermaidQuote(strings.Join(edge.label(), ": ")), ids[edge.To])
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Return the graph in the Graphviz DOT language.
+func (graph *Graph) DOT() string {
+	b := &strings.Builder{}
+	graph.WriteDOT(b)
+	return b.String()
+}
+
+// Return the graph as a Mermaid flowchart.
+func (graph *Graph) Mermaid() string {
+	b := &strings.Builder{}
+	graph.WriteMermaid(b)
+	return b.String()
+}
+
+// Return s as a DOT quoted string, with newlines as line breaks.
+func dotQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
+
+// Return s as a Mermaid quoted string, quotes are replaced by the #quot; entity.
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
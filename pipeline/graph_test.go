@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func graphBuilder() *Builder {
+	b := NewBuilder("graph")
+
+	numbers := From(b, "numbers", func(p Pipeline) Source[int] {
+		return Slice(p, []int{1, 2, 3, 4})
+	}, WithEdgeBufferSize(2))
+	words := Via(b, "strings", numbers, func(p Pipeline, input Source[int]) Source[string] {
+		opts := *GroupOptions()
+		opts.MaxWorkers = 4
+		return Mapper(p, input, func(t int) (string, error) { return strings.Repeat("a", t), nil }, opts)
+	}, WithParallelism(4))
+	Sink(b, "drop", words, func(p Pipeline, input Source[string]) error { return Drop(p, input) })
+
+	return b
+}
+
+func TestGraphDOT(t *testing.T) {
+	b := graphBuilder()
+
+	dot := b.Graph(nil).DOT()
+	for _, s := range []string{
+		`digraph "graph" {`,
+		`"numbers" [label="numbers\nsource", shape=invhouse];`,
+		`"strings" [label="strings\nintermediate x4"];`,
+		`"drop" [label="drop\nsink", shape=house];`,
+		`"numbers" -> "strings" [label="int [2]"];`,
+		`"strings" -> "drop" [label="string"];`,
+	} {
+		if !strings.Contains(dot, s) {
+			t.Fatalf("%s\nmissing %s", dot, s)
+		}
+	}
+
+	report, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dot = b.Graph(report).DOT()
+	for _, s := range []string{
+		`"numbers" -> "strings" [label="int [2]\n4"];`,
+		`"strings" -> "drop" [label="string\n4"];`,
+	} {
+		if !strings.Contains(dot, s) {
+			t.Fatalf("%s\nmissing %s", dot, s)
+		}
+	}
+}
+
+func TestGraphMermaid(t *testing.T) {
+	b := graphBuilder()
+
+	report, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `flowchart LR
+	s0(["numbers<br/>source"])
+	s1["strings<br/>intermediate x4"]
+	s2[["drop<br/>sink"]]
+	s0 -->|"int [2]: 4"| s1
+	s1 -->|"string: 4"| s2
+`
+	if mermaid := b.Graph(report).Mermaid(); mermaid != expected {
+		t.Fatalf("%s\nexpected\n%s", mermaid, expected)
+	}
+}
+
+func TestGraphParallelism(t *testing.T) {
+	b := NewBuilder("parallelism")
+
+	numbers := From(b, "numbers", func(p Pipeline) Source[int] { return Slice(p, []int{1, 2, 3}) })
+	doubled := Via(b, "doubled", numbers, func(p Pipeline, input Source[int]) Source[int] {
+		opts := *GroupOptions()
+		opts.MaxWorkers = 3
+		return Mapper(p, input, func(t int) (int, error) { return t * 2, nil }, opts)
+	})
+	Sink(b, "drop", doubled, func(p Pipeline, input Source[int]) error { return Drop(p, input) })
+
+	if stage := b.Graph(nil).Stages[1]; stage.Parallelism != 1 {
+		t.Fatalf("stage %+v", stage)
+	}
+
+	report, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stage := b.Graph(report).Stages[1]; stage.Parallelism != 3 {
+		t.Fatalf("stage %+v", stage)
+	}
+}
+
+func TestGraphQuote(t *testing.T) {
+	if s := dotQuote("a \"b\"\nc\\"); s != `"a \"b\"\nc\\"` {
+		t.Fatal(s)
+	}
+	if s := mermaidQuote(`a "b"`); s != `"a #quot;b#quot;"` {
+		t.Fatal(s)
+	}
+}
@@ -0,0 +1,225 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StageState is the state of a running stage, sampled from the edges around it.
+type StageState string
+
+const (
+	StateRunning        StageState = "running"
+	StateBlockedSend    StageState = "blocked on send"
+	StateBlockedReceive StageState = "blocked on receive"
+	StateDone           StageState = "done"
+	StateFailed         StageState = "failed"
+)
+
+// RunStatus is a point in time copy of the state of a running Builder.
+type RunStatus struct {
+	Name     string        `json:"name"`
+	Pipeline string        `json:"pipeline"`
+	Start    time.Time     `json:"start"`
+	Uptime   time.Duration `json:"uptime"`
+	// The errors the pipeline has been cancelled with, joined.
+	Err    string        `json:"error,omitempty"`
+	Stages []StageStatus `json:"stages"`
+	Edges  []EdgeStatus  `json:"edges"`
+}
+
+type StageStatus struct {
+	Name  string     `json:"name"`
+	Kind  StageKind  `json:"kind"`
+	State StageState `json:"state"`
+	// The elements received from the inputs and sent to the outputs.
+	In  int64 `json:"in"`
+	Out int64 `json:"out"`
+	// The running workers, if the stage runs a WorkerGroup, otherwise -1.
+	Workers int64 `json:"workers"`
+	// The elements waiting in the stage's outputs and their buffer sizes, before they are relayed to the edges.
+	Buffered   int `json:"buffered"`
+	BufferSize int `json:"buffer_size"`
+	// The last error the stage cancelled the pipeline with.
+	LastErr string `json:"last_error,omitempty"`
+}
+
+type EdgeStatus struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Type  string `json:"type"`
+	Count int64  `json:"count"`
+	// The elements waiting in the buffer and its size.
+	Buffered   int `json:"buffered"`
+	BufferSize int `json:"buffer_size"`
+}
+
+// runRegistry holds the running Builder runs.
+type runRegistry struct {
+	lock *sync.Mutex
+	runs map[*run]struct{}
+}
+
+var runs = &runRegistry{&sync.Mutex{}, map[*run]struct{}{}}
+
+func (registry *runRegistry) add(r *run) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.runs[r] = struct{}{}
+}
+
+func (registry *runRegistry) remove(r *run) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	delete(registry.runs, r)
+}
+
+// Return the status of each running Builder, oldest first.
+func Running() []RunStatus {
+	runs.lock.Lock()
+	list := make([]*run, 0, len(runs.runs))
+	for r := range runs.runs {
+		list = append(list, r)
+	}
+	runs.lock.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].start.Before(list[j].start) })
+
+	statuses := make([]RunStatus, len(list))
+	for i, r := range list {
+		statuses[i] = r.status()
+	}
+	return statuses
+}
+
+func (r *run) status() RunStatus {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	status := RunStatus{
+		Name:     r.name,
+		Pipeline: r.pipeline.ID(),
+		Start:    r.start,
+		Uptime:   time.Since(r.start),
+		Stages:   []StageStatus{},
+		Edges:    []EdgeStatus{},
+	}
+	if err := r.pipeline.Error(); err != nil {
+		status.Err = err.Error()
+	}
+
+	for _, stage := range r.stages {
+		stageStatus := StageStatus{
+			Name:    stage.report.Name,
+			Kind:    stage.report.Kind,
+			State:   stage.state(),
+			Workers: -1,
+		}
+		for _, e := range stage.inputs {
+			stageStatus.In += e.count.Load()
+		}
+		for _, e := range stage.outputs {
+			stageStatus.Out += e.count.Load()
+		}
+		if stage.workers != nil {
+			stageStatus.Workers = stage.workers()
+		}
+		for _, buffer := range stage.buffers {
+			stageStatus.Buffered += buffer.Buffered()
+			stageStatus.BufferSize += buffer.BufferSize()
+		}
+		if stage.lastErr != nil {
+			stageStatus.LastErr = stage.lastErr.Error()
+		}
+		status.Stages = append(status.Stages, stageStatus)
+	}
+
+	for _, e := range r.edges {
+		status.Edges = append(status.Edges, EdgeStatus{e.from.report.Name, e.to, e.typ, e.count.Load(), e.buffered(), e.size})
+	}
+
+	return status
+}
+
+// Return the state of the stage, the caller holds the run lock.
+// A stage is blocked on send when an output holds an element its consumer has not received,
+// and blocked on receive when every input is waiting for an element.
+func (stage *stageRun) state() StageState {
+	if stage.report.Err != nil {
+		return StateFailed
+	}
+	if !stage.report.End.IsZero() {
+		return StateDone
+	}
+	for _, e := range stage.outputs {
+		if e.state.Load() == edgeSending {
+			return StateBlockedSend
+		}
+	}
+	if len(stage.inputs) > 0 {
+		for _, e := range stage.inputs {
+			if e.state.Load() == edgeSending || e.buffered() > 0 {
+				return StateRunning
+			}
+		}
+		return StateBlockedReceive
+	}
+	return StateRunning
+}
+
+var introspectionTemplate = template.Must(template.New("pipelines").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Pipelines</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+.failed { color: red; }
+</style>
+</head>
+<body>
+<h1>Pipelines</h1>
+{{range .}}
+<h2>{{.Name}} <small>{{.Pipeline}}</small></h2>
+<p>Started {{.Start.Format "2006-01-02 15:04:05"}}, up {{.Uptime}}{{if .Err}}, <span class="failed">{{.Err}}</span>{{end}}</p>
+<table>
+<tr><th>Stage</th><th>Kind</th><th>State</th><th>In</th><th>Out</th><th>Workers</th><th>Buffered</th><th>Last error</th></tr>
+{{range .Stages}}<tr{{if eq .State "failed"}} class="failed"{{end}}><td>{{.Name}}</td><td>{{.Kind}}</td><td>{{.State}}</td><td>{{.In}}</td><td>{{.Out}}</td><td>{{if ge .Workers 0}}{{.Workers}}{{end}}</td><td>{{.Buffered}}/{{.BufferSize}}</td><td>{{.LastErr}}</td></tr>
+{{end}}</table>
+<table>
+<tr><th>From</th><th>To</th><th>Type</th><th>Count</th><th>Buffered</th></tr>
+{{range .Edges}}<tr><td>{{.From}}</td><td>{{.To}}</td><td>{{.Type}}</td><td>{{.Count}}</td><td>{{.Buffered}}/{{.BufferSize}}</td></tr>
+{{end}}</table>
+{{else}}
+<p>No pipelines are running.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// Return a handler listing the running Builder pipelines, as JSON if the request has ?format=json or accepts application/json, otherwise as HTML.
+//
+//	http.Handle("/debug/pipelines", IntrospectionHandler())
+func IntrospectionHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statuses := Running()
+
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(statuses)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := introspectionTemplate.Execute(w, statuses); err != nil {
+			logger.Warn("Introspection", "err", err)
+		}
+	})
+}
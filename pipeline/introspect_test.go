@@ -0,0 +1,137 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Return the status of the named run once ok returns true for it.
+func waitForStatus(t *testing.T, name string, ok func(RunStatus) bool) RunStatus {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, status := range Running() {
+			if status.Name == name && ok(status) {
+				return status
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("no status for %s: %+v", name, Running())
+	return RunStatus{}
+}
+
+func stageStatus(status RunStatus, name string) StageStatus {
+	for _, stage := range status.Stages {
+		if stage.Name == name {
+			return stage
+		}
+	}
+	return StageStatus{}
+}
+
+func TestIntrospection(t *testing.T) {
+	b := NewBuilder("introspection")
+
+	numbers := From(b, "numbers", func(p Pipeline) Source[int] {
+		return Slice(p, []int{1, 2, 3, 4, 5, 6})
+	}, WithEdgeBufferSize(2))
+	mapped := Via(b, "map", numbers, func(p Pipeline, input Source[int]) Source[int] {
+		return Mapper(p, input, func(t int) (int, error) { return t, nil }, *GroupOptions())
+	})
+
+	release := make(chan struct{})
+	Sink(b, "slow", mapped, func(p Pipeline, input Source[int]) error {
+		<-release
+		return Drop(p, input)
+	})
+
+	done := make(chan error)
+	go func() {
+		_, err := b.Run(context.Background())
+		done <- err
+	}()
+
+	status := waitForStatus(t, "introspection", func(status RunStatus) bool {
+		return len(status.Edges) == 2 && status.Edges[0].Buffered == 2 && stageStatus(status, "numbers").State == StateBlockedSend && stageStatus(status, "map").State == StateBlockedSend
+	})
+	if stage := stageStatus(status, "map"); stage.Workers != 1 || stage.In < 3 || stage.Out != 0 {
+		t.Fatalf("map %+v", stage)
+	}
+	if stage := stageStatus(status, "slow"); stage.State != StateBlockedReceive && stage.State != StateRunning {
+		t.Fatalf("slow %+v", stage)
+	}
+	if edge := status.Edges[0]; edge.From != "numbers" || edge.Buffered != 2 || edge.BufferSize != 2 {
+		t.Fatalf("edge %+v", edge)
+	}
+
+	handler := IntrospectionHandler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/debug/pipelines?format=json", nil))
+	statuses := []RunStatus{}
+	if err := json.NewDecoder(w.Body).Decode(&statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) == 0 || statuses[len(statuses)-1].Name != "introspection" {
+		t.Fatalf("statuses %+v", statuses)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/debug/pipelines", nil))
+	if body := w.Body.String(); !strings.Contains(body, "<h2>introspection") || !strings.Contains(body, "blocked on send") {
+		t.Fatalf("body %s", body)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, status := range Running() {
+		if status.Name == "introspection" {
+			t.Fatal("still running")
+		}
+	}
+}
+
+func TestIntrospectionBuffered(t *testing.T) {
+	b := NewBuilder("introspection buffered").WithDefaultBufferSize(3)
+
+	numbers := From(b, "numbers", func(p Pipeline) Source[int] {
+		return Slice(p, []int{1, 2, 3, 4, 5, 6})
+	})
+	mapped := Via(b, "map", numbers, func(p Pipeline, input Source[int]) Source[int] {
+		return Mapper(p, input, func(t int) (int, error) { return t, nil }, *GroupOptions(), WithBufferSize(1))
+	})
+
+	release := make(chan struct{})
+	Sink(b, "slow", mapped, func(p Pipeline, input Source[int]) error {
+		<-release
+		return Drop(p, input)
+	})
+
+	done := make(chan error)
+	go func() {
+		_, err := b.Run(context.Background())
+		done <- err
+	}()
+
+	status := waitForStatus(t, "introspection buffered", func(status RunStatus) bool {
+		return stageStatus(status, "map").Buffered == 1 && stageStatus(status, "numbers").State == StateBlockedSend
+	})
+	if stage := stageStatus(status, "numbers"); stage.BufferSize != 3 {
+		t.Fatalf("numbers %+v", stage)
+	}
+	if stage := stageStatus(status, "map"); stage.BufferSize != 1 {
+		t.Fatalf("map %+v", stage)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
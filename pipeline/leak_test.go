@@ -0,0 +1,42 @@
+package pipeline_test
+
+import (
+	"testing"
+
+	"example.com/m/v2/pipeline"
+	"example.com/m/v2/pipeline/pipelinetest"
+)
+
+func stages(p pipeline.Pipeline, input pipeline.Source[int]) pipeline.Source[int] {
+	mapper := pipeline.Mapper(p, input, func(t int) (int, error) { return t, nil }, *pipeline.GroupOptions().ParallelWorkers())
+	filter := pipeline.Filter(p, mapper, func(t int) (bool, error) { return true, nil })
+	peek := pipeline.Peek(p, filter, func(t int) error { return nil })
+	tagged := pipeline.TagAdd(p, peek)
+	broadcast := pipeline.Broadcast(p, pipeline.TagRemove(p, tagged), 2)
+	return pipeline.Merge(p, broadcast[0], broadcast[1])
+}
+
+func TestCompleteNoLeaks(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	p := pipeline.NewPipeline()
+	output := stages(p, pipeline.Slice(p, []int{1, 2, 3}))
+
+	pipelinetest.ExpectUnordered(t, p, output, 1, 1, 2, 2, 3, 3)
+}
+
+func TestCancelNoLeaks(t *testing.T) {
+	pipelinetest.VerifyNoLeaks(t)
+
+	p := pipeline.NewPipeline()
+	supplied := 0
+	output := stages(p, pipeline.Supplier(p, func() (int, error) { supplied++; return supplied, nil }))
+
+	count := 0
+	pipeline.ForEach(p, output, func(t int) error {
+		if count++; count == 100 {
+			p.Cancel()
+		}
+		return nil
+	})
+}
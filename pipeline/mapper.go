@@ -1,39 +1,54 @@
 package pipeline
 
 import (
-	"github.com/google/uuid"
+	"context"
+	"time"
 )
 
 type MapperOpts struct {
 	workerMax *int
 }
 
-func Mapper[T, R any](pipeline pipeline, input chan T, f func(T) (R, error), opts groupOptions) chan R {
-	logger := Logger().With("Mapper", uuid.New())
+func Mapper[T, R any](pipeline Pipeline, input Source[T], f func(T) (R, error), opts groupOptions, options ...SourceOption) *source[R] {
+	return MapperContext(pipeline, input, func(_ context.Context, t T) (R, error) { return f(t) }, opts, options...)
+}
+
+// Map each element of the input like Mapper, calling f with the pipeline's context, or a child context if given WithElementTimeout.
+func MapperContext[T, R any](pipeline Pipeline, input Source[T], f func(context.Context, T) (R, error), opts groupOptions, options ...SourceOption) *source[R] {
+	output := NewSource[R](pipeline, "Mapper", options...)
+	logger := output.Logger()
 
-	output := make(chan R)
+	// The WorkerGroup records the time blocked receiving, the element is received by the Mapper once a worker calls c.
+	c := func(pipeline Pipeline, t T) error {
+		output.received(time.Now())
+		defer output.done()
 
-	c := func(t T) error {
-		r, err := f(t)
+		var r R
+		called, err := output.call(pipeline, t, func(ctx context.Context) (err error) {
+			r, err = f(ctx, t)
+			return err
+		})
 		if err != nil {
+			// The WorkerGroup cancels the pipeline with err.
 			return err
 		}
-		select {
-		case output <- r:
-			return nil
-		case <-pipeline.Done():
+		if !called {
 			return nil
 		}
+		output.send(pipeline, r)
+		return nil
 	}
 
 	go func() {
 		defer func() {
 			logger.Debug("Close output")
-			close(output)
+			close(output.Output())
 			logger.Debug("OK")
+			pipeline.FlowDone(output)
 		}()
 		logger.Debug("Run worker")
-		<-Group[T](pipeline, input, c, opts)
+		for range WorkerGroup[T](pipeline, input, c, opts).Output() {
+		}
 		logger.Debug("Worker done")
 	}()
 
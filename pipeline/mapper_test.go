@@ -1,8 +1,10 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestMapper(t *testing.T) {
@@ -18,3 +20,41 @@ func TestMapper(t *testing.T) {
 	}
 	fmt.Printf("count [%v]\n", count)
 }
+
+func TestMapperContext(t *testing.T) {
+	pipeline := NewPipeline()
+
+	slice := Slice[int](pipeline, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+
+	// Odd elements block until their call times out.
+	mapper := MapperContext[int](pipeline, slice, func(ctx context.Context, t int) (int, error) {
+		if t%2 == 1 {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		return t, nil
+	}, *GroupOptions().ParallelWorkers(), WithElementTimeout(time.Millisecond))
+
+	filter := FilterContext(pipeline, mapper, func(ctx context.Context, t int) (bool, error) { return true, ctx.Err() })
+
+	count, err := Count[int](pipeline, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count.Value() != 5 || mapper.TimedOut() != 5 {
+		t.Fatalf("count [%v] timed out [%d]", count, mapper.TimedOut())
+	}
+}
+
+func TestSupplierContextCancel(t *testing.T) {
+	pipeline := NewPipeline()
+
+	supplier := SupplierContext(pipeline, func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+
+	pipeline.Cancel()
+	for range supplier.Output() {
+	}
+}
@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"sync"
+	"time"
+)
+
+// Merge the inputs into one output, in the order the elements arrive.
+// The output is closed once every input is closed.
+func Merge[T any](pipeline Pipeline, inputs ...Source[T]) *source[T] {
+	output := NewSource[T](pipeline, "Merge")
+
+	wg := sync.WaitGroup{}
+	for _, input := range inputs {
+		wg.Add(1)
+		go func(input Source[T]) {
+			defer wg.Done()
+
+			for {
+				start := time.Now()
+				select {
+				case t, ok := <-input.Output():
+					if !ok {
+						return
+					}
+					output.received(start)
+					sent := output.send(pipeline, t)
+					output.done()
+					if !sent {
+						return
+					}
+				case <-pipeline.Done():
+					return
+				}
+			}
+		}(input)
+	}
+
+	go func() {
+		wg.Wait()
+		close(output.Output())
+		pipeline.FlowDone(output)
+	}()
+
+	return output
+}
+
+// Send each element of the input to all n outputs, so the slowest output sets the pace.
+// The outputs are closed once the input is closed.
+func Broadcast[T any](pipeline Pipeline, input Source[T], n int, options ...SourceOption) []*source[T] {
+	outputs := make([]*source[T], n)
+	for i := range outputs {
+		outputs[i] = NewSource[T](pipeline, "Broadcast", options...)
+	}
+
+	go func() {
+		defer func() {
+			for _, output := range outputs {
+				close(output.Output())
+				pipeline.FlowDone(output)
+			}
+		}()
+
+		for {
+			start := time.Now()
+			select {
+			case t, ok := <-input.Output():
+				if !ok {
+					return
+				}
+				for _, output := range outputs {
+					output.received(start)
+					sent := output.send(pipeline, t)
+					output.done()
+					if !sent {
+						return
+					}
+				}
+			case <-pipeline.Done():
+				return
+			}
+		}
+	}()
+
+	return outputs
+}
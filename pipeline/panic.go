@@ -0,0 +1,38 @@
+package pipeline
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is a panic recovered from a stage's user function, with the element it was called with and the stack of the panic.
+type PanicError struct {
+	Stage string
+	// The value passed to panic.
+	Value any
+	// The element the function was called with, nil if it takes none, e.g. a Supplier.
+	Element any
+	Stack   []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %s with element %v: %v\n%s", e.Stage, e.Element, e.Value, e.Stack)
+}
+
+// Return the value passed to panic if it is an error, so errors.Is and errors.As see it.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// Call f, returning a panic as a PanicError for the named stage.
+func protect(stage string, element any, f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{stage, r, element, debug.Stack()}
+		}
+	}()
+	return f()
+}
@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMapperPanic(t *testing.T) {
+	pipeline := NewPipeline()
+
+	slice := Slice[int](pipeline, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+
+	mapper := Mapper[int](pipeline, slice, func(t int) (int, error) {
+		if t == 5 {
+			panic("five")
+		}
+		return t, nil
+	}, *GroupOptions().ParallelWorkers())
+
+	// The output closes, so draining it returns.
+	for range mapper.Output() {
+	}
+	<-pipeline.Done()
+
+	var panicErr *PanicError
+	if !errors.As(pipeline.Error(), &panicErr) {
+		t.Fatalf("err %v", pipeline.Error())
+	}
+	if panicErr.Stage != "Mapper" || panicErr.Element != 5 || panicErr.Value != "five" || !strings.Contains(string(panicErr.Stack), "TestMapperPanic") {
+		t.Fatalf("panic %+v", panicErr)
+	}
+}
+
+func TestPeekPanic(t *testing.T) {
+	pipeline := NewPipeline()
+
+	slice := Slice[int](pipeline, []int{0, 1, 2})
+
+	cause := errors.New("cause")
+	peek := Peek[int](pipeline, slice, func(t int) error { panic(cause) })
+
+	Drop[int](pipeline, peek)
+
+	if !errors.Is(pipeline.Error(), cause) {
+		t.Fatalf("err %v", pipeline.Error())
+	}
+}
+
+func TestForEachPanic(t *testing.T) {
+	pipeline := NewPipeline()
+
+	slice := Slice[int](pipeline, []int{0, 1, 2})
+
+	err := ForEachContext(pipeline, slice, func(_ context.Context, t int) error {
+		var m map[int]int
+		m[t] = t
+		return nil
+	})
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Stage != "ForEach" || panicErr.Element != 0 {
+		t.Fatalf("err %v", err)
+	}
+}
+
+func TestBuilderPanic(t *testing.T) {
+	b := NewBuilder("panic")
+
+	numbers := From(b, "numbers", func(p Pipeline) Source[int] {
+		return Slice(p, []int{1, 2, 3})
+	})
+	broken := Via(b, "broken", numbers, func(p Pipeline, input Source[int]) Source[int] {
+		panic("broken")
+	})
+	Sink(b, "drop", broken, func(p Pipeline, input Source[int]) error { return Drop(p, input) })
+
+	_, err := b.Run(context.Background())
+	var stageErr *StageError
+	var panicErr *PanicError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "broken" || !errors.As(err, &panicErr) {
+		t.Fatalf("err %v", err)
+	}
+}
+
+func TestBuilderSinkPanic(t *testing.T) {
+	b := NewBuilder("sink panic")
+
+	numbers := From(b, "numbers", func(p Pipeline) Source[int] {
+		return Supplier(p, func() (int, error) { return 1, nil })
+	})
+	Sink(b, "broken", numbers, func(p Pipeline, input Source[int]) error {
+		<-input.Output()
+		panic("broken")
+	})
+
+	_, err := b.Run(context.Background())
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Stage != "broken" {
+		t.Fatalf("err %v", err)
+	}
+}
+
+// Collect the slice with To, appending to a slice supplied for each worker.
+func toSlice(pipeline Pipeline, supplier func() ([]int, error), accumulator func([]int, int) ([]int, error), combiner func([]int, []int) ([]int, error)) error {
+	slice := Slice[int](pipeline, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+
+	_, err := To[int, []int, []int](pipeline, slice, supplier, accumulator, combiner, func(a []int) ([]int, error) { return a, nil })
+	return err
+}
+
+func TestToSupplierPanic(t *testing.T) {
+	pipeline := NewPipeline()
+
+	// The first supplier is called by To, the second by its first worker.
+	supplied := 0
+	err := toSlice(pipeline, func() ([]int, error) {
+		supplied++
+		if supplied == 2 {
+			panic("supplier")
+		}
+		return []int{}, nil
+	}, func(a []int, t int) ([]int, error) { return append(a, t), nil }, func(a, b []int) ([]int, error) { return append(a, b...), nil })
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Stage != "To" || panicErr.Element != nil || panicErr.Value != "supplier" || !errors.Is(pipeline.Error(), panicErr) {
+		t.Fatalf("err %v", err)
+	}
+}
+
+func TestToAccumulatorPanic(t *testing.T) {
+	pipeline := NewPipeline()
+
+	err := toSlice(pipeline, func() ([]int, error) { return []int{}, nil }, func(a []int, t int) ([]int, error) {
+		if t == 5 {
+			panic("accumulator")
+		}
+		return append(a, t), nil
+	}, func(a, b []int) ([]int, error) { return append(a, b...), nil })
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Stage != "To" || panicErr.Element != 5 || panicErr.Value != "accumulator" || !errors.Is(pipeline.Error(), panicErr) {
+		t.Fatalf("err %v", err)
+	}
+}
+
+func TestToCombinerPanic(t *testing.T) {
+	pipeline := NewPipeline()
+
+	cause := errors.New("cause")
+	err := toSlice(pipeline, func() ([]int, error) { return []int{}, nil }, func(a []int, t int) ([]int, error) { return append(a, t), nil }, func(a, b []int) ([]int, error) {
+		panic(cause)
+	})
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Stage != "To" || !errors.Is(err, cause) || !errors.Is(pipeline.Error(), cause) {
+		t.Fatalf("err %v", err)
+	}
+}
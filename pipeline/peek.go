@@ -1,38 +1,47 @@
 package pipeline
 
 import (
+	"context"
 	"time"
-
-	"github.com/google/uuid"
 )
 
 // Peek the input channel using the given consumer.
-// If the consumer returns an error return early.
-func Peek[T any](pipeline pipeline, input chan T, consumer func(t T) error) chan T {
-	logger := Logger().With("Peek", uuid.New())
+// If the consumer returns an error the pipeline is cancelled with it.
+func Peek[T any](pipeline Pipeline, input Source[T], consumer func(t T) error, options ...SourceOption) *source[T] {
+	return PeekContext(pipeline, input, func(_ context.Context, t T) error { return consumer(t) }, options...)
+}
 
-	logger.Debug("Begin")
+// Peek the input like Peek, calling the consumer with the pipeline's context, or a child context if given WithElementTimeout.
+// An element whose call timed out is still sent.
+func PeekContext[T any](pipeline Pipeline, input Source[T], consumer func(ctx context.Context, t T) error, options ...SourceOption) *source[T] {
+	output := NewSource[T](pipeline, "Peek", options...)
+	logger := output.Logger()
 
-	output := make(chan T)
+	logger.Debug("Begin")
 
 	go func() {
 		defer func() {
-			close(output)
+			close(output.Output())
 			logger.Debug("End")
+			pipeline.FlowDone(output)
 		}()
 
 		for {
+			start := time.Now()
 			select {
-			case t, ok := <-input:
+			case t, ok := <-input.Output():
 				if !ok {
 					return
 				}
-				if err := consumer(t); err != nil {
+				output.received(start)
+				if _, err := output.call(pipeline, t, func(ctx context.Context) error { return consumer(ctx, t) }); err != nil {
+					output.done()
+					pipeline.CancelWithError(err)
 					return
 				}
-				select {
-				case output <- t:
-				case <-pipeline.Done():
+				sent := output.send(pipeline, t)
+				output.done()
+				if !sent {
 					return
 				}
 			case <-pipeline.Done():
@@ -44,7 +53,14 @@ func Peek[T any](pipeline pipeline, input chan T, consumer func(t T) error) chan
 	return output
 }
 
-// Throttle each T for the given time duration.
-func Throttle[T any](pipeline pipeline, input chan T, d time.Duration) chan T {
-	return Peek[T](pipeline, input, func(t T) error { time.Sleep(d); return nil })
+// Throttle each T for the given time duration, on the pipeline's clock.
+func Throttle[T any](pipeline Pipeline, input Source[T], d time.Duration, options ...SourceOption) *source[T] {
+	return PeekContext[T](pipeline, input, func(ctx context.Context, t T) error {
+		select {
+		case <-pipeline.Clock().After(d):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, options...)
 }
@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 )
@@ -21,3 +22,18 @@ func TestPeek(t *testing.T) {
 
 	Drop[int](pipeline, peek)
 }
+
+func TestPeekError(t *testing.T) {
+	pipeline := NewPipeline()
+
+	slice := Slice[int](pipeline, []int{0, 1, 2})
+
+	cause := errors.New("cause")
+	peek := Peek[int](pipeline, slice, func(t int) error { return cause })
+
+	Drop[int](pipeline, peek)
+
+	if !errors.Is(pipeline.Error(), cause) {
+		t.Fatalf("err %v", pipeline.Error())
+	}
+}
@@ -2,94 +2,295 @@ package pipeline
 
 import (
 	"context"
+	"errors"
 	"log/slog"
-	"os"
+	"sync"
 	"time"
+
+	"example.com/m/v2/clock"
+	"example.com/m/v2/logging"
+	"example.com/m/v2/metrics"
+	"github.com/google/uuid"
 )
 
 var logger *slog.Logger
 
-func init() {
-	// buildInfo, _ := debug.ReadBuildInfo()
+// ErrNotCancellable is returned by Shutdown for a pipeline which has no cancel function to fall back to.
+var ErrNotCancellable = errors.New("pipeline cannot be cancelled")
 
-	opts := &slog.HandlerOptions{
-		Level: slog.LevelDebug,
-	}
-
-	// x := slog.Group("program_info",
-	// 	slog.Int("pid", os.Getpid()),
-	// 	slog.String("go_version", buildInfo.GoVersion),
-	// )
+func init() {
+	logger = logging.NewDefault()
+}
 
-	logger = slog.New(
-		slog.NewTextHandler(os.Stdout, opts),
-	)
-	// .With(x)
+// Pipeline is passed to every stage, giving it the context to stop on, somewhere to report errors and a logger.
+type Pipeline interface {
+	ID() string
+	Logger() *slog.Logger
+	CTX() context.Context
+	Done() <-chan struct{}
+	// The errors the pipeline was cancelled with, joined, or nil.
+	Error() error
+	Cancel()
+	CancelWithError(err error) error
+	// Called by a stage once it has closed its output.
+	FlowDone(flow Flow)
+	// The buffer size of a stage's output, unless the stage is given WithBufferSize.
+	BufferSize() int
+	// Closed once Shutdown is called, the sources stop producing when it is closed.
+	Draining() <-chan struct{}
+	// The clock of the time based stages, e.g. Throttle.
+	Clock() clock.Clock
+	// The metrics registry each stage reports to, see metrics.Registry.
+	Metrics() *metrics.Registry
 }
 
 type pipeline struct {
+	id  string
 	ctx context.Context
 	// If this pipeline can be cancelled, otherwise nil.
 	cancel context.CancelFunc
 	// If the pipeline has an error, otherwise nil.
 	// If a step within a pipeline calls CancelWithError(*error).
-	err error
+	err     error
+	errLock *sync.Mutex
+	// With the pipeline ID.
+	logger     *slog.Logger
+	bufferSize int
+	draining   chan struct{}
+	drainOnce  *sync.Once
+	// The stages whose output has not been closed.
+	flows   *openFlows
+	clock   clock.Clock
+	metrics *metrics.Registry
+}
+
+func (p *pipeline) ID() string {
+	return p.id
+}
+
+func (p *pipeline) Logger() *slog.Logger {
+	return p.logger
+}
+
+// Set the logger, rather than the package logger, returning the pipeline.
+//
+//	p := Background().WithLogger(logger)
+func (p *pipeline) WithLogger(l *slog.Logger) *pipeline {
+	p.logger = l.With(slog.String(logging.PipelineKey, p.id))
+	return p
+}
+
+func (p *pipeline) BufferSize() int {
+	return p.bufferSize
+}
+
+// Buffer the output of each stage by size, unless the stage is given WithBufferSize, returning the pipeline.
+//
+//	p := Background().WithDefaultBufferSize(16)
+func (p *pipeline) WithDefaultBufferSize(size int) *pipeline {
+	p.bufferSize = size
+	return p
+}
+
+func (p *pipeline) Clock() clock.Clock {
+	return p.clock
+}
+
+// Set the clock of the time based stages, rather than the real clock, returning the pipeline.
+//
+//	p := NewPipeline().WithClock(clock.NewFake(time.Now()))
+func (p *pipeline) WithClock(c clock.Clock) *pipeline {
+	p.clock = c
+	return p
+}
+
+func (p *pipeline) Metrics() *metrics.Registry {
+	return p.metrics
 }
 
 func (p *pipeline) CTX() context.Context {
 	return p.ctx
 }
 
-func (p pipeline) Done() <-chan struct{} {
+func (p *pipeline) Done() <-chan struct{} {
 	return p.ctx.Done()
 }
 
-func (p pipeline) Error() error {
+func (p *pipeline) Error() error {
+	p.errLock.Lock()
+	defer p.errLock.Unlock()
 	return p.err
 }
 
 // Cancel the pipeline.
-func (p pipeline) Cancel() {
+func (p *pipeline) Cancel() {
 	if p.cancel == nil {
 		return
 	}
 	(p.cancel)()
 }
 
-// Cancel the pipeline with an error.
+// Cancel the pipeline with an error, which is joined to any earlier errors.
 // We return the error passed in to allow the function to be used in a return.
 //
 //	if err != nil {
 //		return pipeline.CancelWithError(err)
 //	}
 func (p *pipeline) CancelWithError(err error) error {
-	p.err = err
+	p.errLock.Lock()
+	p.err = errors.Join(p.err, err)
+	p.errLock.Unlock()
 	p.Cancel()
 	return err
 }
 
-func Background() pipeline {
+func (p *pipeline) FlowDone(flow Flow) {
+	p.logger.Debug("Flow done", logging.StageKey, flow.Name(), logging.StageIDKey, flow.ID())
+	p.flows.add(-1)
+}
+
+func (p *pipeline) Draining() <-chan struct{} {
+	return p.draining
+}
+
+func (p *pipeline) isDraining() bool {
+	select {
+	case <-p.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// Start draining the pipeline, the sources stop producing and close their outputs.
+func (p *pipeline) drain() {
+	p.drainOnce.Do(func() {
+		p.logger.Debug("Draining")
+		close(p.draining)
+	})
+}
+
+/*
+Shutdown drains the pipeline rather than dropping the elements in flight, as Cancel does.
+
+The sources, e.g. Slice and Supplier, stop producing and close their outputs, each following stage then closes its output once it has consumed its input,
+so every element already produced reaches the terminals.
+Shutdown returns nil once every stage created with NewSource has closed its output and every sink, e.g. ForEach or To, has returned.
+If ctx is done first the pipeline is cancelled, dropping the elements still in flight, and the context error is returned.
+Call Shutdown from another goroutine than the sinks, as it waits for them.
+
+A pipeline created with Background or Using cannot be cancelled, so Shutdown returns ErrNotCancellable without draining it.
+*/
+func (p *pipeline) Shutdown(ctx context.Context) error {
+	if p.cancel == nil {
+		return ErrNotCancellable
+	}
+
+	p.drain()
+
+	if err := p.flows.wait(ctx); err != nil {
+		p.logger.Debug("Drain incomplete", "Open", p.flows.count(), "Err", err)
+		p.Cancel()
+		return err
+	}
+
+	p.logger.Debug("Drained")
+	return nil
+}
+
+// openFlows counts the stages of a pipeline which have not closed their output.
+type openFlows struct {
+	lock *sync.Mutex
+	open int
+	// Closed and replaced each time open falls to 0.
+	closed chan struct{}
+}
+
+func (flows *openFlows) add(delta int) {
+	flows.lock.Lock()
+	defer flows.lock.Unlock()
+
+	flows.open += delta
+	if flows.open == 0 {
+		close(flows.closed)
+		flows.closed = make(chan struct{})
+	}
+}
+
+func (flows *openFlows) count() int {
+	flows.lock.Lock()
+	defer flows.lock.Unlock()
+	return flows.open
+}
+
+// Wait until every flow is done or ctx is done.
+func (flows *openFlows) wait(ctx context.Context) error {
+	for {
+		flows.lock.Lock()
+		open, closed := flows.open, flows.closed
+		flows.lock.Unlock()
+
+		if open == 0 {
+			return nil
+		}
+
+		select {
+		case <-closed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// flowCounter is implemented by a Pipeline which counts the stages created with NewSource or newSink until they call FlowDone.
+type flowCounter interface {
+	flowStarted()
+}
+
+func (p *pipeline) flowStarted() {
+	p.flows.add(1)
+}
+
+func newPipeline() *pipeline {
 	p := new(pipeline)
+	p.id = uuid.NewString()
+	p.errLock = &sync.Mutex{}
+	p.draining = make(chan struct{})
+	p.drainOnce = &sync.Once{}
+	p.flows = &openFlows{&sync.Mutex{}, 0, make(chan struct{})}
+	p.clock = clock.Real()
+	p.metrics = metrics.NewRegistry(p.id)
+	p.logger = logger.With(slog.String(logging.PipelineKey, p.id))
+	return p
+}
+
+func Background() *pipeline {
+	p := newPipeline()
 	p.ctx = context.Background()
-	return *p
+	return p
 }
 
-func Using(parent context.Context) pipeline {
-	p := new(pipeline)
+func Using(parent context.Context) *pipeline {
+	p := newPipeline()
 	p.ctx = parent
-	return *p
+	return p
 }
 
-func WithCancel(parent context.Context) pipeline {
-	p := new(pipeline)
+func WithCancel(parent context.Context) *pipeline {
+	p := newPipeline()
 	p.ctx, p.cancel = context.WithCancel(parent)
-	return *p
+	return p
 }
 
-func WithTimeout(parent context.Context, d time.Time) pipeline {
-	p := new(pipeline)
+func WithTimeout(parent context.Context, d time.Time) *pipeline {
+	p := newPipeline()
 	p.ctx, p.cancel = context.WithDeadline(parent, d)
-	return *p
+	return p
+}
+
+// Return a new cancellable pipeline.
+func NewPipeline() *pipeline {
+	return WithCancel(context.Background())
 }
 
 func Logger() *slog.Logger {
@@ -3,6 +3,7 @@ package pipeline
 import (
 	"context"
 	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -82,3 +83,121 @@ func TestPipelineCancelWithError(t *testing.T) {
 	}
 
 }
+
+func TestPipelineBufferSize(t *testing.T) {
+	p := Background().WithDefaultBufferSize(4)
+
+	slice := Slice(p, []int{1, 2, 3})
+	if slice.BufferSize() != 4 {
+		t.Fatalf("buffer size %d", slice.BufferSize())
+	}
+
+	// The slice fills the buffer without a receiver.
+	deadline := time.Now().Add(5 * time.Second)
+	for slice.Buffered() != 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if slice.Buffered() != 3 {
+		t.Fatalf("buffered %d", slice.Buffered())
+	}
+
+	filter := Filter(p, slice, func(t int) (bool, error) { return true, nil }, WithBufferSize(1))
+	if filter.BufferSize() != 1 {
+		t.Fatalf("buffer size %d", filter.BufferSize())
+	}
+
+	if count, err := Count[int](p, filter); err != nil || count.Value() != 3 {
+		t.Fatalf("count %v %v", count, err)
+	}
+}
+
+func TestPipelineShutdown(t *testing.T) {
+	p := NewPipeline()
+
+	supplied := 0
+	supplier := Supplier(p, func() (int, error) { supplied++; return supplied, nil })
+	filter := Filter(p, supplier, func(t int) (bool, error) { return true, nil })
+
+	consumed := 0
+	terminal := ForEachTerminal(p, filter, func(t int) error {
+		if consumed++; consumed == 10 {
+			go p.Shutdown(context.Background())
+		}
+		return nil
+	})
+
+	count := <-terminal.Output()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if count != supplied || p.CTX().Err() != nil {
+		t.Fatalf("count %d supplied %d err %v", count, supplied, p.CTX().Err())
+	}
+}
+
+func TestPipelineShutdownForEach(t *testing.T) {
+	p := NewPipeline()
+
+	supplied := atomic.Int64{}
+	supplier := Supplier(p, func() (int, error) { return int(supplied.Add(1)), nil })
+
+	consumed := atomic.Int64{}
+	go ForEach(p, supplier, func(t int) error {
+		if consumed.Add(1) == 10 {
+			go p.Shutdown(context.Background())
+		}
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+
+	<-p.Draining()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if consumed.Load() != supplied.Load() || p.CTX().Err() != nil {
+		t.Fatalf("consumed %d supplied %d err %v", consumed.Load(), supplied.Load(), p.CTX().Err())
+	}
+}
+
+func TestPipelineShutdownNotCancellable(t *testing.T) {
+	p := Background()
+
+	if err := p.Shutdown(context.Background()); !errors.Is(err, ErrNotCancellable) {
+		t.Fatal(err)
+	}
+	if p.isDraining() {
+		t.Fatal("draining")
+	}
+}
+
+func TestPipelineMetrics(t *testing.T) {
+	p := Background()
+
+	slice := Slice[int](p, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+
+	filter := Filter[int](p, slice, func(t int) (bool, error) { return t%2 == 0, nil })
+
+	mapper := Mapper[int](p, filter, func(t int) (int, error) { return t, nil }, *GroupOptions().ParallelWorkers())
+
+	if err := ForEach[int](p, mapper, func(_ int) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	stages := map[string][2]int64{}
+	for _, stage := range p.Metrics().Snapshot() {
+		stages[stage.Name] = [2]int64{stage.In, stage.Out}
+		if stage.InFlight != 0 {
+			t.Fatalf("stage [%+v]", stage)
+		}
+	}
+
+	if stages["Slice"] != [2]int64{0, 10} || stages["Filter"] != [2]int64{10, 5} || stages["Mapper"] != [2]int64{5, 5} || stages["ForEach"] != [2]int64{5, 0} {
+		t.Fatalf("stages [%v]", stages)
+	}
+}
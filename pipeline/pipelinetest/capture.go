@@ -0,0 +1,90 @@
+package pipelinetest
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"example.com/m/v2/pipeline"
+)
+
+// Recorder records the elements consumed by a sink, safe for concurrent use by a stage's workers.
+//
+//	recorder := pipelinetest.NewRecorder[int]()
+//	pipeline.Sink(b, "record", node, recorder.Sink)
+//	...
+//	pipelinetest.Equal(t, []int{1, 2, 3}, recorder.Elements())
+type Recorder[T any] struct {
+	lock     *sync.Mutex
+	elements []T
+}
+
+func NewRecorder[T any]() *Recorder[T] {
+	return &Recorder[T]{lock: &sync.Mutex{}}
+}
+
+// Record t, a consumer for ForEach or ForEachTerminal.
+func (r *Recorder[T]) Consume(t T) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.elements = append(r.elements, t)
+	return nil
+}
+
+// Record t, a consumer for ForEachContext, ForEachTerminalContext or PeekContext.
+func (r *Recorder[T]) ConsumeContext(_ context.Context, t T) error {
+	return r.Consume(t)
+}
+
+// Record each element of the input until it is closed, a sink for Builder.
+func (r *Recorder[T]) Sink(p pipeline.Pipeline, input pipeline.Source[T]) error {
+	return pipeline.ForEach(p, input, r.Consume)
+}
+
+// Return a copy of the elements recorded so far.
+func (r *Recorder[T]) Elements() []T {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]T{}, r.elements...)
+}
+
+func (r *Recorder[T]) Len() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.elements)
+}
+
+// Call f, returning the lines it wrote to stdout, e.g. from StdOutV or ForEachStdOutV.
+// Stdout is replaced while f runs, so do not use it with t.Parallel.
+func CaptureStdout(t testing.TB, f func()) []string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("capturing stdout: %v", err)
+	}
+
+	lines := []string{}
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+	}()
+
+	stdout := os.Stdout
+	os.Stdout = w
+	func() {
+		defer func() { os.Stdout = stdout }()
+		f()
+	}()
+
+	w.Close()
+	<-read
+	r.Close()
+	return lines
+}
@@ -0,0 +1,124 @@
+package pipelinetest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/m/v2/pipeline"
+)
+
+// Consume the input until it is closed, returning its elements.
+// The test fails if the pipeline has an error.
+func Collect[T any](t testing.TB, p pipeline.Pipeline, input pipeline.Source[T]) []T {
+	t.Helper()
+
+	got := []T{}
+	if err := pipeline.ForEach(p, input, func(t T) error { got = append(got, t); return nil }); err != nil {
+		t.Fatalf("consuming %s: %v", input.Name(), err)
+	}
+	if err := p.Error(); err != nil {
+		t.Errorf("pipeline error: %v", err)
+	}
+	return got
+}
+
+// Consume the input, checking it emits exactly want in order.
+//
+//	pipelinetest.ExpectOrdered(t, p, mapper, 2, 4, 6)
+func ExpectOrdered[T any](t testing.TB, p pipeline.Pipeline, input pipeline.Source[T], want ...T) {
+	t.Helper()
+	Equal(t, want, Collect(t, p, input))
+}
+
+// Consume the input, checking it emits exactly want in any order, e.g. from parallel workers.
+func ExpectUnordered[T any](t testing.TB, p pipeline.Pipeline, input pipeline.Source[T], want ...T) {
+	t.Helper()
+	ElementsMatch(t, want, Collect(t, p, input))
+}
+
+// Check got equals want element by element, failing with a diff.
+func Equal[T any](t testing.TB, want []T, got []T) {
+	t.Helper()
+	if len(want) == len(got) && (len(want) == 0 || reflect.DeepEqual(want, got)) {
+		return
+	}
+	t.Errorf("elements differ (-want +got):\n%s", Diff(want, got))
+}
+
+// Check got has the elements of want, each as many times, in any order, failing with the missing and unexpected elements.
+func ElementsMatch[T any](t testing.TB, want []T, got []T) {
+	t.Helper()
+
+	unexpected := append([]T{}, got...)
+	missing := []T{}
+	for _, w := range want {
+		found := false
+		for i, u := range unexpected {
+			if reflect.DeepEqual(w, u) {
+				unexpected = append(unexpected[:i], unexpected[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, w)
+		}
+	}
+	if len(missing) == 0 && len(unexpected) == 0 {
+		return
+	}
+
+	var b strings.Builder
+	for _, m := range missing {
+		fmt.Fprintf(&b, "- %v\n", m)
+	}
+	for _, u := range unexpected {
+		fmt.Fprintf(&b, "+ %v\n", u)
+	}
+	t.Errorf("elements differ (-missing +unexpected):\n%s", b.String())
+}
+
+/*
+Diff returns a line per element, prefixed with "-" for an element only in want, "+" for one only in got and a space for one in both.
+
+	  1
+	- 2
+	+ 7
+	  3
+*/
+func Diff[T any](want []T, got []T) string {
+	// lcs[i][j] is the length of the longest common subsequence of want[i:] and got[j:].
+	lcs := make([][]int, len(want)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(got)+1)
+	}
+	for i := len(want) - 1; i >= 0; i-- {
+		for j := len(got) - 1; j >= 0; j-- {
+			if reflect.DeepEqual(want[i], got[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var b strings.Builder
+	i, j := 0, 0
+	for i < len(want) || j < len(got) {
+		switch {
+		case i < len(want) && j < len(got) && reflect.DeepEqual(want[i], got[j]):
+			fmt.Fprintf(&b, "  %v\n", want[i])
+			i++
+			j++
+		case j == len(got) || (i < len(want) && lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&b, "- %v\n", want[i])
+			i++
+		default:
+			fmt.Fprintf(&b, "+ %v\n", got[j])
+			j++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package pipelinetest
+
+import (
+	"bytes"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/m/v2/pipeline"
+)
+
+// LeakTimeout is how long VerifyNoLeaks waits for the stage goroutines to exit before failing the test.
+var LeakTimeout = 2 * time.Second
+
+// The prefix of a stack frame in the pipeline package.
+var stageFrame = reflect.TypeFor[pipeline.Builder]().PkgPath() + "."
+
+/*
+VerifyNoLeaks checks, once the test and its cleanups registered later have finished, that every goroutine started by the pipeline package during the test has exited.
+The stage goroutines exit once their output is closed, after the pipeline completes or is cancelled, so call it at the start of the test.
+
+	func TestMyOperator(t *testing.T) {
+		pipelinetest.VerifyNoLeaks(t)
+		p := pipeline.NewPipeline()
+		...
+	}
+
+Goroutines started by tests running in parallel are counted too, so do not use it with t.Parallel.
+*/
+func VerifyNoLeaks(t testing.TB) {
+	t.Helper()
+
+	before := stageGoroutines()
+	t.Cleanup(func() {
+		t.Helper()
+		if leaked := leaks(before, LeakTimeout); len(leaked) > 0 {
+			t.Errorf("%d stage goroutines still running after %v:\n\n%s", len(leaked), LeakTimeout, strings.Join(leaked, "\n\n"))
+		}
+	})
+}
+
+// Wait up to timeout for the stage goroutines not in before to exit, returning the stacks of those still running.
+func leaks(before map[int]string, timeout time.Duration) []string {
+	deadline := time.Now().Add(timeout)
+	for {
+		leaked := []string{}
+		for id, stack := range stageGoroutines() {
+			if _, ok := before[id]; !ok {
+				leaked = append(leaked, stack)
+			}
+		}
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			return leaked
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Return the stacks of the goroutines running or started by code in the pipeline package, by goroutine ID.
+func stageGoroutines() map[int]string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	goroutines := map[int]string{}
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		lines := strings.Split(string(stack), "\n")
+		// goroutine 7 [chan receive]:
+		fields := strings.Fields(lines[0])
+		if len(fields) < 2 || fields[0] != "goroutine" {
+			continue
+		}
+		id, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		for _, line := range lines[1:] {
+			if strings.HasPrefix(line, stageFrame) || strings.HasPrefix(line, "created by "+stageFrame) {
+				goroutines[id] = string(stack)
+				break
+			}
+		}
+	}
+	return goroutines
+}
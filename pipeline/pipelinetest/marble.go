@@ -0,0 +1,440 @@
+package pipelinetest
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/m/v2/clock"
+	"example.com/m/v2/pipeline"
+)
+
+// ErrMarble is the error a marble source cancels the pipeline with at a '#'.
+var ErrMarble = errors.New("marble error")
+
+// SettleTimeout is how long the Scheduler waits in real time for the stages to block after each frame before failing the test.
+var SettleTimeout = 10 * time.Second
+
+// The real time between the Scheduler's checks that the stages have settled.
+const settlePoll = 100 * time.Microsecond
+
+// The checks in a row the pipeline must be unchanged for to have settled, and to give up on an output's expected elements.
+const (
+	settledChecks = 3
+	expectChecks  = 20
+)
+
+/*
+Scheduler runs a marble test, driving sources from marble strings and checking the outputs against marble strings on a virtual clock.
+
+A marble string is a timeline with a character per frame of virtual time:
+
+	'-'     nothing happens in the frame
+	'a'     an element, looked up in the values given with the marbles
+	'|'     the source completes, its output is closed
+	'#'     the pipeline is cancelled with ErrMarble
+	'(ab|)' everything in the parentheses happens in the same frame
+	' '     spaces are ignored, to line up marbles
+
+For example a Mapper which doubles each element:
+
+	s := pipelinetest.NewScheduler(t)
+	p := s.Pipeline()
+	in := pipelinetest.FromMarbles(s, "-a-b-c|", map[rune]int{'a': 1, 'b': 2, 'c': 3})
+	out := pipeline.Mapper(p, in, double, *pipeline.GroupOptions())
+	pipelinetest.ExpectMarbles(s, out, "-A-B-C|", map[rune]int{'A': 2, 'B': 4, 'C': 6})
+	s.Run()
+
+Run advances the virtual clock a frame at a time, waiting after each frame until the stages have settled, so the output records exactly which frame each element reached it in.
+The stages have settled once every marble source is waiting, every timer fired has been received, the stage metrics of the pipeline stop changing,
+and each output has recorded the elements expected up to the frame.
+Time based stages must use the pipeline's clock, e.g. Throttle, with durations in frames, see Frames.
+*/
+type Scheduler struct {
+	t        testing.TB
+	clock    *clock.Fake
+	start    time.Time
+	frame    time.Duration
+	pipeline pipeline.Pipeline
+	// The frames of the longest marble string.
+	frames       int
+	expectations []*expectation
+	lock         *sync.Mutex
+	// The marble sources running, and those waiting on the clock, the pipeline or a stage to receive.
+	running int
+	waiting int
+}
+
+// Return a new scheduler with a pipeline on a fake clock, with frames of one second.
+// The pipeline is cancelled when the test ends.
+func NewScheduler(t testing.TB) *Scheduler {
+	start := time.Unix(0, 0)
+	fake := clock.NewFake(start)
+	p := pipeline.NewPipeline().WithClock(fake)
+	t.Cleanup(p.Cancel)
+	return &Scheduler{t: t, clock: fake, start: start, frame: time.Second, pipeline: p, lock: &sync.Mutex{}}
+}
+
+// The pipeline to create the stages under test in.
+func (s *Scheduler) Pipeline() pipeline.Pipeline {
+	return s.pipeline
+}
+
+func (s *Scheduler) Clock() *clock.Fake {
+	return s.clock
+}
+
+// Return the virtual duration of n frames, e.g. for Throttle.
+func (s *Scheduler) Frames(n int) time.Duration {
+	return time.Duration(n) * s.frame
+}
+
+// Return the current frame.
+func (s *Scheduler) frameNow() int {
+	return int(s.clock.Since(s.start) / s.frame)
+}
+
+// Return a source which emits the elements of the marble string in their frames, see Scheduler.
+// If values is nil and T is string each element is its character.
+func FromMarbles[T any](s *Scheduler, marbles string, values map[rune]T) pipeline.Source[T] {
+	s.t.Helper()
+
+	events := s.parse(marbles)
+	output := pipeline.NewSource[T](s.pipeline, "Marbles")
+	p := s.pipeline
+
+	elements := make([]T, len(events))
+	for i, event := range events {
+		if event.char == '|' || event.char == '#' {
+			continue
+		}
+		t, ok := value(values, event.char)
+		if !ok {
+			s.t.Fatalf("marbles %q: no value for %q", marbles, event.char)
+		}
+		elements[i] = t
+	}
+
+	s.track(&s.running, 1)
+	go func() {
+		defer func() {
+			close(output.Output())
+			p.FlowDone(output)
+			s.track(&s.running, -1)
+		}()
+
+		// Wait for the clock, or the pipeline once c is nil, returning false if the pipeline is done first.
+		wait := func(c <-chan time.Time) bool {
+			s.track(&s.waiting, 1)
+			defer s.track(&s.waiting, -1)
+			select {
+			case <-c:
+				return true
+			case <-p.Done():
+				return false
+			}
+		}
+		// Send t, waiting for the stage receiving it, returning false if the pipeline is done first.
+		send := func(t T) bool {
+			s.track(&s.waiting, 1)
+			defer s.track(&s.waiting, -1)
+			select {
+			case output.Output() <- t:
+				return true
+			case <-p.Done():
+				return false
+			}
+		}
+
+		for i, event := range events {
+			if d := s.start.Add(s.Frames(event.frame)).Sub(s.clock.Now()); d > 0 && !wait(s.clock.After(d)) {
+				return
+			}
+
+			switch event.char {
+			case '|':
+				return
+			case '#':
+				p.CancelWithError(ErrMarble)
+				return
+			}
+
+			if !send(elements[i]) {
+				return
+			}
+		}
+		wait(nil)
+	}()
+
+	return output
+}
+
+// Add delta to the count of marble sources running or waiting.
+func (s *Scheduler) track(count *int, delta int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	*count += delta
+}
+
+// Return whether every marble source is waiting on the clock, the pipeline or a stage to receive.
+func (s *Scheduler) sourcesWaiting() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.waiting == s.running
+}
+
+// Check the input emits the marble string, once Run has run, see Scheduler.
+// Each element is shown as the character of its value, or ? if it has none.
+func ExpectMarbles[T any](s *Scheduler, input pipeline.Source[T], marbles string, values map[rune]T) {
+	s.t.Helper()
+
+	e := &expectation{want: s.parse(marbles), lock: &sync.Mutex{}}
+	s.expectations = append(s.expectations, e)
+
+	go func() {
+		for t := range input.Output() {
+			e.record(s.frameNow(), char(values, t))
+		}
+		if s.pipeline.Error() != nil {
+			e.record(s.frameNow(), '#')
+		} else {
+			e.record(s.frameNow(), '|')
+		}
+	}()
+}
+
+// expectation is the marbles expected of an output and those it has recorded.
+type expectation struct {
+	want []marbleEvent
+	lock *sync.Mutex
+	got  []marbleEvent
+}
+
+func (e *expectation) record(frame int, char rune) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.got = append(e.got, marbleEvent{frame, char})
+}
+
+// Return whether the output has recorded as many events as expected up to the frame, or has completed.
+func (e *expectation) caughtUp(frame int) bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if n := len(e.got); n > 0 && (e.got[n-1].char == '|' || e.got[n-1].char == '#') {
+		return true
+	}
+	want := 0
+	for _, event := range e.want {
+		if event.frame <= frame {
+			want++
+		}
+	}
+	return len(e.got) >= want
+}
+
+// Return the expected and recorded marble strings.
+func (e *expectation) marbles() (string, string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return render(e.want), render(e.got)
+}
+
+// Run the frames of the longest marble string, then check each output against its expected marbles.
+func (s *Scheduler) Run() {
+	s.t.Helper()
+
+	s.settle()
+	for frame := 1; frame < s.frames; frame++ {
+		s.clock.Advance(s.frame)
+		s.settle()
+	}
+
+	for i, expectation := range s.expectations {
+		if want, got := expectation.marbles(); want != got {
+			s.t.Errorf("output %d marbles differ:\nwant %s\n got %s", i, want, got)
+		}
+	}
+}
+
+/*
+Wait until the stages have done everything they can in the frame.
+
+The marble sources must be waiting and every timer fired by the frame received, so the stages woken by the frame are running or done,
+then the counts of the stage metrics must stop changing, so the elements sent in the frame have been passed on or are held by a stage waiting on the clock.
+Each output must also record the elements expected in the frame, as a stage closing its output is not counted,
+unless the pipeline stops changing for long enough that the elements are not coming.
+*/
+func (s *Scheduler) settle() {
+	s.t.Helper()
+
+	deadline := time.Now().Add(SettleTimeout)
+	last := s.progress()
+	for unchanged := 0; ; {
+		runtime.Gosched()
+		time.Sleep(settlePoll)
+
+		progress := s.progress()
+		if progress != last || !s.sourcesWaiting() || (s.clock.Fired() > 0 && s.pipeline.Error() == nil) {
+			last, unchanged = progress, 0
+		} else {
+			unchanged++
+		}
+		if unchanged >= expectChecks || (unchanged >= settledChecks && s.caughtUp()) {
+			return
+		}
+		if time.Now().After(deadline) {
+			s.t.Fatalf("stages still running after %v in frame %d", SettleTimeout, s.frameNow())
+		}
+	}
+}
+
+// progress is a sum of the pipeline's stage metrics and the outputs' events, which changes as the stages pass elements on.
+type progress struct {
+	in, out, inFlight, buffered, errors int64
+	waiters                             int
+	recorded                            int
+}
+
+func (s *Scheduler) progress() progress {
+	p := progress{waiters: s.clock.Waiters()}
+	for _, stage := range s.pipeline.Metrics().Snapshot() {
+		p.in += stage.In
+		p.out += stage.Out
+		p.inFlight += stage.InFlight
+		p.buffered += stage.Buffered
+		p.errors += stage.Errors
+	}
+	for _, e := range s.expectations {
+		e.lock.Lock()
+		p.recorded += len(e.got)
+		e.lock.Unlock()
+	}
+	return p
+}
+
+// Return whether every output has recorded the events expected up to the current frame.
+func (s *Scheduler) caughtUp() bool {
+	frame := s.frameNow()
+	for _, e := range s.expectations {
+		if !e.caughtUp(frame) {
+			return false
+		}
+	}
+	return true
+}
+
+// marbleEvent is an element, '|' or '#' in a frame of a marble string.
+type marbleEvent struct {
+	frame int
+	char  rune
+}
+
+// Parse the marble string, failing the test if it is invalid, and record its length.
+func (s *Scheduler) parse(marbles string) []marbleEvent {
+	s.t.Helper()
+
+	events := []marbleEvent{}
+	frame := 0
+	group := false
+	for _, char := range marbles {
+		switch char {
+		case ' ':
+			continue
+		case '-':
+			if group {
+				s.t.Fatalf("marbles %q: - in a group", marbles)
+			}
+		case '(':
+			if group {
+				s.t.Fatalf("marbles %q: nested group", marbles)
+			}
+			group = true
+			continue
+		case ')':
+			if !group {
+				s.t.Fatalf("marbles %q: ) without (", marbles)
+			}
+			group = false
+		default:
+			events = append(events, marbleEvent{frame, char})
+			if group {
+				continue
+			}
+		}
+		frame++
+	}
+	if group {
+		s.t.Fatalf("marbles %q: ( without )", marbles)
+	}
+
+	s.frames = max(s.frames, frame)
+	return events
+}
+
+// Return the events as a marble string, up to the last event.
+func render(events []marbleEvent) string {
+	events = append([]marbleEvent{}, events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].frame < events[j].frame })
+
+	var b strings.Builder
+	frame := 0
+	for i := 0; i < len(events); {
+		for ; frame < events[i].frame; frame++ {
+			b.WriteRune('-')
+		}
+		j := i
+		for j < len(events) && events[j].frame == frame {
+			j++
+		}
+		if j-i > 1 {
+			b.WriteRune('(')
+		}
+		for _, event := range events[i:j] {
+			b.WriteRune(event.char)
+		}
+		if j-i > 1 {
+			b.WriteRune(')')
+		}
+		i = j
+		frame++
+	}
+	return b.String()
+}
+
+// Return the value of the character, or the character itself if values is nil and T is string.
+func value[T any](values map[rune]T, char rune) (T, bool) {
+	if values == nil {
+		t, ok := any(string(char)).(T)
+		return t, ok
+	}
+	t, ok := values[char]
+	return t, ok
+}
+
+// Return the character of the value, or '?'.
+func char[T any](values map[rune]T, t T) rune {
+	if values == nil {
+		if s, ok := any(t).(string); ok && len([]rune(s)) == 1 {
+			return []rune(s)[0]
+		}
+		return '?'
+	}
+	// Look the characters up in order, so the result does not depend on the map order.
+	chars := []rune{}
+	for char := range values {
+		chars = append(chars, char)
+	}
+	sort.Slice(chars, func(i, j int) bool { return chars[i] < chars[j] })
+	for _, char := range chars {
+		if reflect.DeepEqual(values[char], t) {
+			return char
+		}
+	}
+	return '?'
+}
@@ -0,0 +1,110 @@
+package pipelinetest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"example.com/m/v2/pipeline"
+)
+
+var (
+	lower = map[rune]int{'a': 1, 'b': 2, 'c': 3, 'd': 4}
+	upper = map[rune]int{'A': 2, 'B': 4, 'C': 6, 'D': 8}
+)
+
+func TestMarblesMapper(t *testing.T) {
+	s := NewScheduler(t)
+	p := s.Pipeline()
+
+	in := FromMarbles(s, "-a-b-c|", lower)
+	ExpectMarbles(s, pipeline.Mapper(p, in, double, *pipeline.GroupOptions()), "-A-B-C|", upper)
+
+	s.Run()
+}
+
+func TestMarblesFilter(t *testing.T) {
+	s := NewScheduler(t)
+	p := s.Pipeline()
+
+	in := FromMarbles(s, "a-b-(cd)-|", lower)
+	even := pipeline.Filter(p, in, func(t int) (bool, error) { return t%2 == 0, nil })
+	ExpectMarbles(s, even, "--b-d-|", lower)
+
+	s.Run()
+}
+
+func TestMarblesMerge(t *testing.T) {
+	s := NewScheduler(t)
+	p := s.Pipeline()
+
+	left := FromMarbles[string](s, "-a---c|", nil)
+	right := FromMarbles[string](s, "--b-d--|", nil)
+	ExpectMarbles(s, pipeline.Merge(p, left, right), "-ab-dc-|", nil)
+
+	s.Run()
+}
+
+func TestMarblesThrottle(t *testing.T) {
+	s := NewScheduler(t)
+	p := s.Pipeline()
+
+	// Each element waits two frames, and holds back those behind it.
+	in := FromMarbles[string](s, "abc|", nil)
+	ExpectMarbles(s, pipeline.Throttle(p, in, s.Frames(2)), "--a-b-(c|)", nil)
+
+	s.Run()
+}
+
+func TestMarblesError(t *testing.T) {
+	s := NewScheduler(t)
+	p := s.Pipeline()
+
+	in := FromMarbles(s, "-a-#", lower)
+	ExpectMarbles(s, pipeline.Mapper(p, in, double, *pipeline.GroupOptions()), "-A-#", upper)
+
+	s.Run()
+
+	if !errors.Is(p.Error(), ErrMarble) {
+		t.Fatalf("err %v", p.Error())
+	}
+}
+
+func TestMarblesDiffer(t *testing.T) {
+	errs := failures(t, func(t testing.TB) {
+		s := NewScheduler(t)
+		p := s.Pipeline()
+
+		in := FromMarbles(s, "-a-b|", lower)
+		ExpectMarbles(s, pipeline.Mapper(p, in, double, *pipeline.GroupOptions()), "-A--B|", upper)
+
+		s.Run()
+	})
+	want := "output 0 marbles differ:\nwant -A--B|\n got -A-B|"
+	if len(errs) != 1 || errs[0] != want {
+		t.Fatalf("errs %q", errs)
+	}
+}
+
+func TestMarblesInvalid(t *testing.T) {
+	for _, marbles := range []string{"-(a", "a)", "(a(b))", "(a-b)"} {
+		errs := failures(t, func(t testing.TB) {
+			FromMarbles[string](NewScheduler(t), marbles, nil)
+		})
+		if len(errs) != 1 || !strings.Contains(errs[0], marbles) {
+			t.Fatalf("marbles %q errs %q", marbles, errs)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	s := NewScheduler(t)
+	for _, marbles := range []string{"-a-b-c|", "(ab)-(c|)", "--#", ""} {
+		if got := render(s.parse(marbles)); got != marbles {
+			t.Fatalf("render %q %q", marbles, got)
+		}
+	}
+	if got := render(s.parse("- a - -  ")); got != "-a" {
+		t.Fatalf("render %q", got)
+	}
+}
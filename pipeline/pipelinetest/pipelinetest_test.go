@@ -0,0 +1,151 @@
+package pipelinetest
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/m/v2/pipeline"
+)
+
+// recordingT records failures rather than failing the test, to check the helpers fail.
+type recordingT struct {
+	testing.TB
+	errs []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...any) {
+	t.errs = append(t.errs, fmt.Sprintf(format, args...))
+}
+
+func (t *recordingT) Fatalf(format string, args ...any) {
+	t.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// Call f with a recordingT, returning its failures.
+func failures(t testing.TB, f func(t testing.TB)) []string {
+	rt := &recordingT{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(rt)
+	}()
+	<-done
+	return rt.errs
+}
+
+func double(t int) (int, error) {
+	return 2 * t, nil
+}
+
+func TestVerifyNoLeaks(t *testing.T) {
+	VerifyNoLeaks(t)
+
+	p := pipeline.NewPipeline()
+	slice := pipeline.Slice(p, []int{1, 2, 3})
+	mapper := pipeline.Mapper(p, slice, double, *pipeline.GroupOptions().ParallelWorkers())
+
+	ExpectUnordered(t, p, mapper, 2, 4, 6)
+}
+
+func TestLeaks(t *testing.T) {
+	before := stageGoroutines()
+
+	p := pipeline.NewPipeline()
+	supplier := pipeline.Supplier(p, func() (int, error) { return 1, nil })
+
+	leaked := leaks(before, 50*time.Millisecond)
+	if len(leaked) != 1 || !strings.Contains(leaked[0], "pipeline.SupplierContext") {
+		t.Fatalf("leaked %v", leaked)
+	}
+
+	p.Cancel()
+	for range supplier.Output() {
+	}
+	if leaked := leaks(before, time.Second); len(leaked) != 0 {
+		t.Fatalf("leaked after cancel %v", leaked)
+	}
+}
+
+func TestExpectOrdered(t *testing.T) {
+	VerifyNoLeaks(t)
+
+	p := pipeline.NewPipeline()
+	slice := pipeline.Slice(p, []int{1, 2, 3})
+	ExpectOrdered(t, p, pipeline.Mapper(p, slice, double, *pipeline.GroupOptions()), 2, 4, 6)
+
+	errs := failures(t, func(t testing.TB) {
+		p := pipeline.NewPipeline()
+		slice := pipeline.Slice(p, []int{1, 2, 3})
+		ExpectOrdered(t, p, pipeline.Mapper(p, slice, double, *pipeline.GroupOptions()), 2, 3, 6, 8)
+	})
+	want := "elements differ (-want +got):\n  2\n- 3\n+ 4\n  6\n- 8\n"
+	if len(errs) != 1 || errs[0] != want {
+		t.Fatalf("errs %q", errs)
+	}
+}
+
+func TestExpectUnordered(t *testing.T) {
+	errs := failures(t, func(t testing.TB) {
+		p := pipeline.NewPipeline()
+		slice := pipeline.Slice(p, []int{1, 2, 2})
+		ExpectUnordered(t, p, slice, 2, 1, 3)
+	})
+	want := "elements differ (-missing +unexpected):\n- 3\n+ 2\n"
+	if len(errs) != 1 || errs[0] != want {
+		t.Fatalf("errs %q", errs)
+	}
+}
+
+func TestCollectError(t *testing.T) {
+	errs := failures(t, func(t testing.TB) {
+		p := pipeline.NewPipeline()
+		slice := pipeline.Slice(p, []int{1, 2, 3})
+		Collect(t, p, pipeline.Mapper(p, slice, func(t int) (int, error) { return 0, fmt.Errorf("failed %d", t) }, *pipeline.GroupOptions()))
+	})
+	if len(errs) != 1 || !strings.Contains(errs[0], "failed 1") {
+		t.Fatalf("errs %q", errs)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	if diff := Diff([]string{"a", "b"}, []string{"a", "b"}); diff != "  a\n  b\n" {
+		t.Fatalf("diff %q", diff)
+	}
+	if diff := Diff([]string{}, []string{"a"}); diff != "+ a\n" {
+		t.Fatalf("diff %q", diff)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	VerifyNoLeaks(t)
+
+	recorder := NewRecorder[int]()
+
+	b := pipeline.NewBuilder("record")
+	numbers := pipeline.From(b, "numbers", func(p pipeline.Pipeline) pipeline.Source[int] {
+		return pipeline.Slice(p, []int{1, 2, 3})
+	})
+	pipeline.Sink(b, "record", numbers, recorder.Sink)
+
+	if _, err := b.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	Equal(t, []int{1, 2, 3}, recorder.Elements())
+}
+
+func TestCaptureStdout(t *testing.T) {
+	lines := CaptureStdout(t, func() {
+		p := pipeline.NewPipeline()
+		if err := pipeline.StdOutV(p, pipeline.Slice(p, []string{"a", "b"})); err != nil {
+			t.Error(err)
+		}
+	})
+	Equal(t, []string{"a", "b"}, lines)
+}
@@ -0,0 +1,171 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"example.com/m/v2/clock"
+	"example.com/m/v2/resequence"
+)
+
+// resequenceOptions configure a Resequence stage, create them with ResequenceOptions.
+type resequenceOptions struct {
+	resequence.Options
+	stats *resequenceStats
+}
+
+// Buffer up to n elements behind a missing key, the MaxGap follows unless set after.
+func (o *resequenceOptions) WithMaxBuffered(n int) *resequenceOptions {
+	o.MaxBuffered = n
+	o.MaxGap = n
+	return o
+}
+
+func (o *resequenceOptions) WithMaxGap(n int) *resequenceOptions {
+	o.MaxGap = n
+	return o
+}
+
+// Apply the policy once a key has been missing for d on the pipeline's clock.
+func (o *resequenceOptions) WithGapTimeout(d time.Duration, policy resequence.Policy) *resequenceOptions {
+	o.GapTimeout = d
+	o.Policy = policy
+	return o
+}
+
+// Apply the policy when the buffer overflows or the input closes with a key missing, without a timeout.
+func (o *resequenceOptions) WithGapPolicy(policy resequence.Policy) *resequenceOptions {
+	o.Policy = policy
+	return o
+}
+
+// Return the counts of the stage most recently run with these options.
+func (o *resequenceOptions) Stats() resequence.Stats {
+	return o.stats.snapshot()
+}
+
+// Return the default resequence options, buffering up to 1024 elements and waiting for a missing key until the input closes.
+func ResequenceOptions() *resequenceOptions {
+	return &resequenceOptions{Options: resequence.DefaultOptions(), stats: &resequenceStats{lock: &sync.Mutex{}}}
+}
+
+type resequenceStats struct {
+	lock  *sync.Mutex
+	stats resequence.Stats
+}
+
+func (s *resequenceStats) store(stats resequence.Stats) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.stats = stats
+}
+
+func (s *resequenceStats) snapshot() resequence.Stats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.stats
+}
+
+/*
+Resequence sends the input in the order of its keys, starting with first and following next, e.g. after a parallel Mapper.
+
+Elements arriving early are buffered until the missing key arrives.
+A missing key is handled by the policy once the buffer is full, the gap timeout passes or the input closes:
+Wait and Fail cancel the pipeline with resequence.ErrOverflow or resequence.ErrGap, except Wait keeps waiting on the timeout, and Skip skips the gap.
+Elements arriving after their key was sent or skipped are dropped.
+*/
+func Resequence[T any, K comparable](p Pipeline, input Source[T], key func(T) K, first K, next func(K) K, opts *resequenceOptions, options ...SourceOption) *source[T] {
+	return resequenceStage(p, "Resequence", input, key, func(t T) T { return t }, first, next, opts, options...)
+}
+
+// Resequence the input by key, sending the value of each element.
+func resequenceStage[T, R any, K comparable](p Pipeline, name string, input Source[T], key func(T) K, value func(T) R, first K, next func(K) K, opts *resequenceOptions, options ...SourceOption) *source[R] {
+	output := NewSource[R](p, name, options...)
+	logger := output.Logger()
+
+	r := resequence.New[K, R](first, next, opts.Options)
+
+	go func() {
+		// The gap timer runs while an element is buffered, restarting on progress.
+		var timer clock.Timer
+		var timeout <-chan time.Time
+
+		stopTimer := func() {
+			if timer != nil {
+				timer.Stop()
+			}
+			timer, timeout = nil, nil
+		}
+		startTimer := func() {
+			stopTimer()
+			if opts.GapTimeout > 0 {
+				timer = p.Clock().NewTimer(opts.GapTimeout)
+				timeout = timer.C()
+			}
+		}
+
+		defer func() {
+			stopTimer()
+			stats := r.Stats()
+			opts.stats.store(stats)
+			output.Metrics("Released", stats.Released, "Reordered", stats.Reordered, "MaxDepth", stats.MaxDepth, "Gaps", stats.Gaps, "Late", stats.Late)
+			close(output.Output())
+			p.FlowDone(output)
+		}()
+
+		// Send the elements ready, then update the gap timer.
+		send := func(ready []R, err error) bool {
+			for _, element := range ready {
+				if !output.send(p, element) {
+					return false
+				}
+			}
+			opts.stats.store(r.Stats())
+			output.metrics.Reorder(r.Len())
+			if err != nil {
+				p.CancelWithError(fmt.Errorf("%s: %w", name, err))
+				return false
+			}
+			switch {
+			case r.Len() == 0:
+				stopTimer()
+			case len(ready) > 0 || timer == nil:
+				startTimer()
+			}
+			return true
+		}
+
+		for {
+			start := time.Now()
+			select {
+			case t, ok := <-input.Output():
+				if !ok {
+					send(r.Close())
+					return
+				}
+				output.received(start)
+				sent := send(r.Add(key(t), value(t)))
+				output.done()
+				if !sent {
+					return
+				}
+			case <-timeout:
+				timer, timeout = nil, nil
+				ready, err := r.Timeout()
+				if err == nil && len(ready) == 0 {
+					logger.Warn("Waiting for missing key", "Key", r.Expected(), "Buffered", r.Len(), "Waited", opts.GapTimeout)
+				}
+				if !send(ready, err) {
+					return
+				}
+			case <-p.Done():
+				return
+			}
+		}
+	}()
+
+	return output
+}
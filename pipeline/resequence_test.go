@@ -0,0 +1,111 @@
+package pipeline
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"example.com/m/v2/clock"
+	"example.com/m/v2/resequence"
+)
+
+func next(k int) int {
+	return k + 1
+}
+
+func TestResequenceGapSkip(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	p := NewPipeline().WithClock(fake)
+	defer p.Cancel()
+
+	opts := ResequenceOptions().WithGapTimeout(time.Minute, resequence.Skip)
+	input := NewSource[int](p, "input")
+	output := Resequence(p, input, func(t int) int { return t }, 1, next, opts)
+
+	input.Output() <- 1
+	if element := <-output.Output(); element != 1 {
+		t.Fatalf("element %d", element)
+	}
+	input.Output() <- 3
+
+	// 2 is skipped once it has been missing for a minute.
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+	if element := <-output.Output(); element != 3 {
+		t.Fatalf("element %d", element)
+	}
+
+	input.Output() <- 2
+	input.Output() <- 4
+	close(input.Output())
+	result, _ := ToSlice[int](p, output)
+	if !slices.Equal(result.Value(), []int{4}) {
+		t.Fatalf("result %v", result.Value())
+	}
+	if stats := opts.Stats(); stats.Released != 3 || stats.Gaps != 1 || stats.Late != 1 {
+		t.Fatalf("stats %v", stats)
+	}
+}
+
+func TestResequenceGapFail(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	p := NewPipeline().WithClock(fake)
+	defer p.Cancel()
+
+	input := NewSource[int](p, "input")
+	output := Resequence(p, input, func(t int) int { return t }, 1, next, ResequenceOptions().WithGapTimeout(time.Minute, resequence.Fail))
+
+	input.Output() <- 2
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+	for range output.Output() {
+	}
+	if !errors.Is(p.Error(), resequence.ErrGap) {
+		t.Fatal(p.Error())
+	}
+}
+
+func TestResequenceOverflow(t *testing.T) {
+	p := NewPipeline()
+	defer p.Cancel()
+
+	slice := Slice(p, []int{3, 4, 5, 1, 2})
+	output := Resequence(p, slice, func(t int) int { return t }, 1, next, ResequenceOptions().WithMaxBuffered(2))
+	for range output.Output() {
+	}
+	if !errors.Is(p.Error(), resequence.ErrOverflow) {
+		t.Fatal(p.Error())
+	}
+
+	// Skipping 1 and 2 makes room rather than failing, 2 then arrives late and is dropped.
+	p = NewPipeline()
+	defer p.Cancel()
+
+	slice = Slice(p, []int{3, 4, 5, 2})
+	result, err := ToSlice[int](p, Resequence(p, slice, func(t int) int { return t }, 1, next, ResequenceOptions().WithMaxBuffered(2).WithGapPolicy(resequence.Skip)))
+	if err != nil || p.Error() != nil || !slices.Equal(result.Value(), []int{3, 4, 5}) {
+		t.Fatalf("result %v %v %v", result.Value(), err, p.Error())
+	}
+}
+
+func TestResequenceMapper(t *testing.T) {
+	p := NewPipeline()
+	defer p.Cancel()
+
+	data := []int{}
+	for i := 1; i <= 100; i++ {
+		data = append(data, i)
+	}
+
+	// The parallel workers finish out of order.
+	mapper := Mapper(p, Slice(p, data), func(t int) (int, error) {
+		time.Sleep(time.Duration(t%7) * time.Millisecond)
+		return t, nil
+	}, *GroupOptions().ParallelWorkers())
+
+	result, err := ToSlice[int](p, Resequence(p, mapper, func(t int) int { return t }, 1, next, ResequenceOptions()))
+	if err != nil || !slices.Equal(result.Value(), data) {
+		t.Fatalf("result %v %v", result.Value(), err)
+	}
+}
@@ -0,0 +1,294 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"example.com/m/v2/clock"
+	"example.com/m/v2/metrics"
+)
+
+// retryOptions configure the retries of a function wrapped with Retry, create them with RetryOptions.
+type retryOptions struct {
+	// The maximum calls of the function per element, including the first.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// The maximum time from the first call to the start of the last retry, 0 for no limit.
+	MaxElapsed time.Duration
+	// Return whether an error is retryable, nil retries every error.
+	// An error wrapped with Permanent is never retried.
+	Retryable func(error) bool
+	// Called before each retry.
+	OnRetry func(RetryEvent)
+	// The clock of the backoff, the real clock by default.
+	Clock clock.Clock
+	stats *retryStats
+}
+
+func (o *retryOptions) WithMaxAttempts(n int) *retryOptions {
+	o.MaxAttempts = n
+	return o
+}
+
+func (o *retryOptions) WithBackoff(initial time.Duration, max time.Duration) *retryOptions {
+	o.InitialBackoff = initial
+	o.MaxBackoff = max
+	return o
+}
+
+func (o *retryOptions) WithMaxElapsed(d time.Duration) *retryOptions {
+	o.MaxElapsed = d
+	return o
+}
+
+func (o *retryOptions) WithRetryable(f func(error) bool) *retryOptions {
+	o.Retryable = f
+	return o
+}
+
+func (o *retryOptions) WithOnRetry(f func(RetryEvent)) *retryOptions {
+	o.OnRetry = f
+	return o
+}
+
+func (o *retryOptions) WithClock(c clock.Clock) *retryOptions {
+	o.Clock = c
+	return o
+}
+
+// Return the attempts made by the functions wrapped with these options.
+func (o *retryOptions) Stats() RetryStats {
+	return o.stats.snapshot()
+}
+
+// Return the default retry options, 3 attempts with a backoff from 100ms up to 10s, retrying every error.
+func RetryOptions() *retryOptions {
+	return (&retryOptions{Clock: clock.Real(), stats: &retryStats{lock: &sync.Mutex{}}}).WithMaxAttempts(3).WithBackoff(100*time.Millisecond, 10*time.Second)
+}
+
+// RetryEvent describes a failed attempt which is about to be retried.
+type RetryEvent struct {
+	// The attempt which failed, from 1.
+	Attempt int
+	Err     error
+	// The wait before the next attempt.
+	Backoff time.Duration
+	// The time since the first attempt.
+	Elapsed time.Duration
+}
+
+// RetryError is returned by a function wrapped with Retry once it gives up.
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Wrap err so Retry does not retry it, whatever the Retryable classifier returns.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// Return a classifier which retries an error matching any of the targets, see errors.Is.
+func RetryIs(targets ...error) func(error) bool {
+	return func(err error) bool {
+		for _, target := range targets {
+			if errors.Is(err, target) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Return a classifier which retries an error with an E in its chain, see errors.As.
+//
+//	RetryAs[net.Error]()
+func RetryAs[E error]() func(error) bool {
+	return func(err error) bool {
+		var target E
+		return errors.As(err, &target)
+	}
+}
+
+// Return a classifier which retries the errors f does not, e.g. RetryNot(RetryIs(ErrInvalid)).
+func RetryNot(f func(error) bool) func(error) bool {
+	return func(err error) bool {
+		return !f(err)
+	}
+}
+
+/*
+Retry wraps the user function of MapperContext, calling it again when it returns a retryable error.
+Use RetryConsumer for a consumer, e.g. of ForEachContext, and RetryWorker for a WorkerGroupContext consumer.
+
+Each retry waits an exponential backoff with full jitter, a random duration up to InitialBackoff doubled for each attempt, capped at MaxBackoff.
+The function is retried until it succeeds, it has been called MaxAttempts times, the error is not retryable, the next backoff would exceed MaxElapsed or the context is done.
+
+	opts := RetryOptions().WithMaxAttempts(5).WithRetryable(RetryIs(ErrUnavailable))
+	mapper := MapperContext(p, input, Retry(opts, fetch), *GroupOptions())
+	fmt.Println(opts.Stats())
+
+The attempts are also recorded in the metrics of the calling stage, see metrics.StageSnapshot Attempts.
+The context spans every attempt, so a WithElementTimeout given to the stage limits the total time for an element.
+*/
+func Retry[T, R any](opts *retryOptions, f func(context.Context, T) (R, error)) func(context.Context, T) (R, error) {
+	return func(ctx context.Context, t T) (R, error) {
+		var r R
+		err := opts.do(ctx, func() (err error) {
+			r, err = f(ctx, t)
+			return err
+		})
+		return r, err
+	}
+}
+
+// Wrap a consumer with retries, e.g. of ForEachContext, ForEachTerminalContext or PeekContext.
+func RetryConsumer[T any](opts *retryOptions, consumer func(context.Context, T) error) func(context.Context, T) error {
+	return func(ctx context.Context, t T) error {
+		return opts.do(ctx, func() error { return consumer(ctx, t) })
+	}
+}
+
+// Wrap the consumer of WorkerGroupContext with retries.
+func RetryWorker[T any](opts *retryOptions, c func(context.Context, Pipeline, T) error) func(context.Context, Pipeline, T) error {
+	return func(ctx context.Context, p Pipeline, t T) error {
+		return opts.do(ctx, func() error { return c(ctx, p, t) })
+	}
+}
+
+// Call f until it succeeds or should not be retried, returning a RetryError wrapping the last error.
+// The attempts are recorded in the options' stats and the metrics of the stage carried by ctx, if any.
+func (o *retryOptions) do(ctx context.Context, f func() error) error {
+	stage := metrics.FromContext(ctx)
+	record := func(attempts int, failed bool) {
+		o.stats.record(attempts, failed)
+		if stage != nil {
+			stage.Retried(attempts, failed)
+		}
+	}
+
+	start := o.Clock.Now()
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil {
+			record(attempt, false)
+			return nil
+		}
+
+		backoff := o.backoff(attempt)
+		if attempt >= o.MaxAttempts || !o.retryable(err) || (o.MaxElapsed > 0 && o.Clock.Since(start)+backoff > o.MaxElapsed) {
+			record(attempt, true)
+			return &RetryError{attempt, err}
+		}
+
+		if o.OnRetry != nil {
+			o.OnRetry(RetryEvent{attempt, err, backoff, o.Clock.Since(start)})
+		}
+
+		timer := o.Clock.NewTimer(backoff)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			record(attempt, true)
+			return &RetryError{attempt, err}
+		}
+	}
+}
+
+func (o *retryOptions) retryable(err error) bool {
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+	return o.Retryable == nil || o.Retryable(err)
+}
+
+// Return a random backoff up to the exponential backoff of the given attempt, capped at MaxBackoff.
+func (o *retryOptions) backoff(attempt int) time.Duration {
+	ceiling := o.InitialBackoff
+	for i := 1; i < attempt && ceiling < o.MaxBackoff; i++ {
+		ceiling *= 2
+	}
+	if ceiling > o.MaxBackoff {
+		ceiling = o.MaxBackoff
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// RetryStats counts the attempts made by the functions wrapped with a retryOptions.
+type RetryStats struct {
+	// The elements the wrapped functions were called for.
+	Elements int64
+	Attempts int64
+	Retries  int64
+	// The elements which still failed after their last attempt.
+	Failed int64
+	// The elements by the attempts they took, the first is those which took one attempt.
+	ByAttempts []int64
+}
+
+func (stats RetryStats) String() string {
+	return fmt.Sprintf("elements %d attempts %d retries %d failed %d by attempts %v", stats.Elements, stats.Attempts, stats.Retries, stats.Failed, stats.ByAttempts)
+}
+
+type retryStats struct {
+	lock  *sync.Mutex
+	stats RetryStats
+}
+
+func (s *retryStats) record(attempts int, failed bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.stats.Elements++
+	s.stats.Attempts += int64(attempts)
+	s.stats.Retries += int64(attempts - 1)
+	if failed {
+		s.stats.Failed++
+	}
+	for len(s.stats.ByAttempts) < attempts {
+		s.stats.ByAttempts = append(s.stats.ByAttempts, 0)
+	}
+	s.stats.ByAttempts[attempts-1]++
+}
+
+func (s *retryStats) snapshot() RetryStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats := s.stats
+	stats.ByAttempts = append([]int64{}, s.stats.ByAttempts...)
+	return stats
+}
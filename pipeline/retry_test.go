@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"example.com/m/v2/clock"
+)
+
+var errRetry = errors.New("retry")
+
+func TestRetryMapper(t *testing.T) {
+	p := NewPipeline()
+
+	// Each element fails until its third attempt.
+	attempts := map[int]int{}
+	retries := 0
+	opts := RetryOptions().WithBackoff(time.Microsecond, time.Millisecond).WithOnRetry(func(event RetryEvent) {
+		retries++
+		if event.Backoff > time.Millisecond || !errors.Is(event.Err, errRetry) {
+			t.Errorf("event %+v", event)
+		}
+	})
+
+	mapper := MapperContext(p, Slice(p, []int{1, 2, 3}), Retry(opts, func(ctx context.Context, t int) (int, error) {
+		if attempts[t]++; attempts[t] < 3 {
+			return 0, errRetry
+		}
+		return t * 10, nil
+	}), *GroupOptions())
+
+	result, err := ToSlice[int](p, mapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Value(), []int{10, 20, 30}) || retries != 6 {
+		t.Fatalf("result %v retries %d", result, retries)
+	}
+
+	stats := opts.Stats()
+	if stats.Elements != 3 || stats.Attempts != 9 || stats.Retries != 6 || stats.Failed != 0 || !slices.Equal(stats.ByAttempts, []int64{0, 0, 3}) {
+		t.Fatalf("stats %v", stats)
+	}
+
+	for _, stage := range p.Metrics().Snapshot() {
+		if stage.Name == "Mapper" && (stage.Attempts != 9 || stage.Retries != 6 || stage.RetryFailed != 0) {
+			t.Fatalf("stage %+v", stage)
+		}
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	errOther := errors.New("other")
+
+	opts := RetryOptions().WithMaxAttempts(4).WithBackoff(0, 0).WithRetryable(RetryIs(errRetry))
+	consumer := RetryConsumer(opts, func(ctx context.Context, err error) error { return err })
+
+	err := consumer(context.Background(), errRetry)
+	retryErr := &RetryError{}
+	if !errors.As(err, &retryErr) || retryErr.Attempts != 4 || !errors.Is(err, errRetry) {
+		t.Fatalf("retryable %v", err)
+	}
+
+	if err := consumer(context.Background(), errOther); !errors.As(err, &retryErr) || retryErr.Attempts != 1 {
+		t.Fatalf("not retryable %v", err)
+	}
+	if err := consumer(context.Background(), Permanent(errRetry)); !errors.As(err, &retryErr) || retryErr.Attempts != 1 {
+		t.Fatalf("permanent %v", err)
+	}
+
+	if stats := opts.Stats(); stats.Failed != 3 || !slices.Equal(stats.ByAttempts, []int64{2, 0, 0, 1}) {
+		t.Fatalf("stats %v", stats)
+	}
+}
+
+func TestRetryConsumerMetrics(t *testing.T) {
+	p := NewPipeline()
+
+	opts := RetryOptions().WithMaxAttempts(2).WithBackoff(0, 0)
+	err := ForEachContext(p, Slice(p, []int{1, 2, 3}), RetryConsumer(opts, func(ctx context.Context, t int) error {
+		if t == 2 {
+			return errRetry
+		}
+		return nil
+	}))
+	if !errors.Is(err, errRetry) {
+		t.Fatal(err)
+	}
+
+	for _, stage := range p.Metrics().Snapshot() {
+		if stage.Name == "ForEach" && (stage.Attempts != 3 || stage.Retries != 1 || stage.RetryFailed != 1) {
+			t.Fatalf("stage %+v", stage)
+		}
+	}
+}
+
+func TestRetryMaxElapsed(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	opts := RetryOptions().WithClock(fake).WithMaxAttempts(100).WithBackoff(0, 0).WithMaxElapsed(10 * time.Minute)
+	// Each attempt takes a minute.
+	worker := RetryWorker(opts, func(ctx context.Context, p Pipeline, t int) error {
+		fake.Advance(time.Minute)
+		return errRetry
+	})
+
+	if err := worker(context.Background(), Background(), 1); !errors.Is(err, errRetry) {
+		t.Fatal(err)
+	}
+	if stats := opts.Stats(); stats.Attempts != 11 {
+		t.Fatalf("stats %v", stats)
+	}
+}
+
+func TestRetryClassifiers(t *testing.T) {
+	err := &StageError{"stage", errRetry}
+
+	if !RetryAs[*StageError]()(err) || RetryAs[*RetryError]()(err) {
+		t.Fatal("RetryAs")
+	}
+	if RetryNot(RetryIs(errRetry))(err) || !RetryNot(RetryIs(errRetry))(errors.New("other")) {
+		t.Fatal("RetryNot")
+	}
+}
@@ -0,0 +1,396 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Report describes a run of a Builder.
+type Report struct {
+	Name string
+	// The ID of the pipeline the stages ran in.
+	Pipeline string
+	Start    time.Time
+	End      time.Time
+	// The errors the pipeline was cancelled with, and the context error if it was cancelled by the caller, joined.
+	Err error
+	// Whether Shutdown was called and every element in flight reached the sinks before the pipeline was cancelled.
+	Drained bool
+	Stages  []*StageReport
+	Edges   []*EdgeReport
+}
+
+func (report *Report) Duration() time.Duration {
+	return report.End.Sub(report.Start)
+}
+
+// Return the report of the named stage, or nil.
+func (report *Report) Stage(name string) *StageReport {
+	for _, stage := range report.Stages {
+		if stage.Name == name {
+			return stage
+		}
+	}
+	return nil
+}
+
+// Return the report as text, one stage per line with its inputs, duration, elements sent and error.
+func (report *Report) String() string {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "%s %v", report.Name, report.Duration())
+	if report.Drained {
+		b.WriteString(" drained")
+	}
+	if report.Err != nil {
+		fmt.Fprintf(&b, " error: %v", report.Err)
+	}
+	b.WriteString("\n")
+	for _, stage := range report.Stages {
+		fmt.Fprintf(&b, "  %s %s", stage.Name, stage.Kind)
+		if len(stage.Inputs) > 0 {
+			fmt.Fprintf(&b, " <- %s", strings.Join(stage.Inputs, ", "))
+		}
+		fmt.Fprintf(&b, " %v", stage.Duration())
+		if stage.Kind != KindSink {
+			fmt.Fprintf(&b, " out %d", report.sent(stage.Name))
+		}
+		if stage.Err != nil {
+			fmt.Fprintf(&b, " error: %v", stage.Err)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Return the count of elements sent by the named stage.
+func (report *Report) sent(name string) int64 {
+	count := int64(0)
+	for _, edge := range report.Edges {
+		if edge.From == name {
+			count += edge.Count
+		}
+	}
+	return count
+}
+
+// StageReport describes a stage of a run.
+type StageReport struct {
+	Name   string
+	Kind   StageKind
+	Inputs []string
+	Start  time.Time
+	// When the stage closed its outputs, or the sink returned.
+	End time.Time
+	// The errors the stage cancelled the pipeline with, joined.
+	Err error
+	// The MaxWorkers of the stage's WorkerGroup, e.g. of a Mapper, 0 if it runs none.
+	Parallelism int
+}
+
+func (stage *StageReport) Duration() time.Duration {
+	return stage.End.Sub(stage.Start)
+}
+
+// EdgeReport describes the elements sent from one stage to another.
+type EdgeReport struct {
+	From string
+	To   string
+	// The element type.
+	Type  string
+	Count int64
+}
+
+// run is the live state of a Builder run.
+type run struct {
+	name     string
+	pipeline *pipeline
+	start    time.Time
+	// Guards the stage reports and errors.
+	lock   *sync.Mutex
+	stages []*stageRun
+	edges  []*edge
+	// Closed once the run has finished.
+	done chan struct{}
+}
+
+type stageRun struct {
+	report  *StageReport
+	lastErr error
+	inputs  []*edge
+	outputs []*edge
+	// The count of running workers, if the stage runs a WorkerGroup.
+	workers func() int64
+	// The outputs of the stage which report their buffer occupancy.
+	buffers []buffer
+}
+
+// buffer is implemented by a Source which reports the elements waiting in its output, e.g. the Source returned by NewSource.
+type buffer interface {
+	Buffered() int
+	BufferSize() int
+}
+
+const (
+	edgeReceiving int32 = iota
+	edgeSending
+	edgeClosed
+)
+
+// edge relays the elements of a stage's output to its consumer.
+type edge struct {
+	from  *stageRun
+	to    string
+	typ   string
+	count atomic.Int64
+	// One of edgeReceiving, edgeSending or edgeClosed.
+	state atomic.Int32
+	size  int
+	// Return the count of elements buffered, set when the relay starts.
+	buffered func() int
+}
+
+// stagePipeline is the Pipeline given to a stage run by a Builder, recording the stage's errors and when it is done.
+type stagePipeline struct {
+	*pipeline
+	run   *run
+	stage *stageRun
+}
+
+func (p *stagePipeline) CancelWithError(err error) error {
+	p.run.lock.Lock()
+	p.stage.report.Err = errors.Join(p.stage.report.Err, err)
+	p.stage.lastErr = err
+	p.run.lock.Unlock()
+	return p.pipeline.CancelWithError(err)
+}
+
+func (p *stagePipeline) end() {
+	p.run.lock.Lock()
+	p.stage.report.End = time.Now()
+	p.run.lock.Unlock()
+}
+
+// Record the running workers of a WorkerGroup and the most it runs.
+func (p *stagePipeline) reportWorkers(workers func() int64, max int) {
+	p.run.lock.Lock()
+	p.stage.workers = workers
+	p.stage.report.Parallelism = max
+	p.run.lock.Unlock()
+}
+
+// workerReporter is implemented by a Pipeline which records the running workers of a WorkerGroup.
+type workerReporter interface {
+	reportWorkers(workers func() int64, max int)
+}
+
+/*
+Run validates the graph, then starts every stage in a new pipeline cancelled with ctx, and waits for them all to finish.
+
+Once every sink has returned the pipeline is cancelled, so stages still producing, e.g. upstream of a Limit, stop.
+Run then waits for every stage to close its outputs, which each stage in this package does once the pipeline is done.
+
+The returned error joins the errors the pipeline was cancelled with and the context error if ctx was done before the sinks finished.
+A builder can be run once.
+While it runs the pipeline is listed by Running.
+*/
+func (b *Builder) Run(ctx context.Context) (*Report, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	if !b.ran.CompareAndSwap(false, true) {
+		return nil, ErrAlreadyRun
+	}
+
+	p := WithCancel(ctx).WithDefaultBufferSize(b.bufferSize)
+	defer p.Cancel()
+	if b.logger != nil {
+		p.WithLogger(b.logger)
+	}
+	if b.clock != nil {
+		p.WithClock(b.clock)
+	}
+	logger := p.Logger().With("builder", b.name)
+
+	r := &run{name: b.name, pipeline: p, start: time.Now(), lock: &sync.Mutex{}, done: make(chan struct{})}
+	runs.add(r)
+	defer runs.remove(r)
+	b.current.Store(r)
+	defer close(r.done)
+
+	// The Source each output is relayed to, which is the input of its consumer.
+	relays := map[*output]any{}
+	edges := map[*output]*edge{}
+
+	sinks := sync.WaitGroup{}
+	relaying := sync.WaitGroup{}
+
+	for _, stage := range b.stages {
+		stageRun := &stageRun{report: &StageReport{Name: stage.name, Kind: stage.kind, Start: time.Now()}}
+		sp := &stagePipeline{p, r, stageRun}
+
+		inputs := make([]any, len(stage.inputs))
+		for i, input := range stage.inputs {
+			inputs[i] = relays[input]
+			stageRun.inputs = append(stageRun.inputs, edges[input])
+			stageRun.report.Inputs = append(stageRun.report.Inputs, input.stage.name)
+		}
+
+		r.lock.Lock()
+		r.stages = append(r.stages, stageRun)
+		r.lock.Unlock()
+
+		if stage.kind == KindSink {
+			sinks.Add(1)
+			go func() {
+				defer sinks.Done()
+				if err := protect(stage.name, nil, func() error { return stage.run(sp, inputs) }); err != nil {
+					sp.CancelWithError(err)
+				}
+				sp.end()
+			}()
+			continue
+		}
+
+		var outputs []any
+		err := protect(stage.name, nil, func() (err error) {
+			outputs, err = stage.start(sp, inputs)
+			return err
+		})
+		if err != nil {
+			// Stop the stages already started, their consumers will never start.
+			sp.CancelWithError(&StageError{stage.name, err})
+			sp.end()
+			break
+		}
+
+		r.lock.Lock()
+		for _, output := range outputs {
+			if buffer, ok := output.(buffer); ok {
+				stageRun.buffers = append(stageRun.buffers, buffer)
+			}
+		}
+		r.lock.Unlock()
+
+		open := atomic.Int32{}
+		open.Store(int32(len(outputs)))
+		for i, output := range stage.outputs {
+			e := &edge{from: stageRun, to: output.consumer.name, typ: output.typ, size: stage.bufferSize}
+			edges[output] = e
+
+			relaying.Add(1)
+			relays[output] = output.relay(p, outputs[i], e, func() {
+				defer relaying.Done()
+				if open.Add(-1) == 0 {
+					sp.end()
+				}
+			})
+
+			r.lock.Lock()
+			stageRun.outputs = append(stageRun.outputs, e)
+			r.edges = append(r.edges, e)
+			r.lock.Unlock()
+		}
+	}
+
+	logger.Debug("Started", "Stages", len(b.stages))
+
+	sinks.Wait()
+	ctxErr := ctx.Err()
+	drained := p.isDraining() && p.CTX().Err() == nil
+	p.Cancel()
+	relaying.Wait()
+
+	report := r.report()
+	report.End = time.Now()
+	report.Err = errors.Join(p.Error(), ctxErr)
+	report.Drained = drained
+
+	logger.Debug("Done", "Duration", report.Duration(), "Err", report.Err)
+
+	return report, report.Err
+}
+
+/*
+Shutdown drains a running Builder rather than dropping the elements in flight, as cancelling the context given to Run does.
+
+The sources stop producing, see the Pipeline Shutdown, and each stage finishes once its input is closed, so every element already produced reaches the sinks.
+Shutdown returns nil once Run has finished, the Report then has Drained set if no stage cancelled the pipeline.
+If ctx is done first the pipeline is cancelled, dropping the elements still in flight, and the context error is returned.
+
+A source stage which does not stop on Draining, e.g. one reading a channel, only stops once ctx is done.
+*/
+func (b *Builder) Shutdown(ctx context.Context) error {
+	r := b.current.Load()
+	if r == nil {
+		return ErrNotRunning
+	}
+
+	r.pipeline.drain()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		r.pipeline.Cancel()
+		return ctx.Err()
+	}
+}
+
+// Return the report of the run so far.
+func (r *run) report() *Report {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	report := &Report{Name: r.name, Pipeline: r.pipeline.ID(), Start: r.start}
+	for _, stage := range r.stages {
+		stageReport := *stage.report
+		report.Stages = append(report.Stages, &stageReport)
+	}
+	for _, e := range r.edges {
+		report.Edges = append(report.Edges, &EdgeReport{e.from.report.Name, e.to, e.typ, e.count.Load()})
+	}
+	return report
+}
+
+// Forward the source to a new Source with the edge's buffer size, counting the elements, and calling done once the source is closed.
+// Once the pipeline is done the source is drained, so the stage sending to it can finish.
+func relay[T any](p Pipeline, from Source[T], e *edge, done func()) Source[T] {
+	to := &source[T]{id: from.ID(), name: from.Name(), output: make(chan T, e.size), logger: from.Logger(), timedOut: &atomic.Int64{}}
+	e.buffered = func() int { return len(to.output) }
+
+	go func() {
+		defer func() {
+			close(to.output)
+			e.state.Store(edgeClosed)
+			for range from.Output() {
+			}
+			done()
+		}()
+
+		for {
+			select {
+			case t, ok := <-from.Output():
+				if !ok {
+					return
+				}
+				e.state.Store(edgeSending)
+				select {
+				case to.output <- t:
+					e.count.Add(1)
+					e.state.Store(edgeReceiving)
+				case <-p.Done():
+					return
+				}
+			case <-p.Done():
+				return
+			}
+		}
+	}()
+
+	return to
+}
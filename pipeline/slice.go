@@ -2,6 +2,7 @@ package pipeline
 
 import (
 	"sync/atomic"
+	"time"
 )
 
 type slice[T any] struct {
@@ -9,9 +10,9 @@ type slice[T any] struct {
 	Count atomic.Int64
 }
 
-func Slice[T any](p Pipeline, i []T) *slice[T] {
+func Slice[T any](p Pipeline, i []T, options ...SourceOption) *slice[T] {
 
-	source := &slice[T]{*NewSource[T](p, "Slice"), atomic.Int64{}}
+	source := &slice[T]{*NewSource[T](p, "Slice", options...), atomic.Int64{}}
 
 	go func() {
 		defer func() {
@@ -20,11 +21,15 @@ func Slice[T any](p Pipeline, i []T) *slice[T] {
 		}()
 
 		for _, t := range i {
+			start := time.Now()
 			select {
 			case source.Output() <- t:
+				source.metrics.Sent(start)
 				source.Count.Add(1)
 			case <-p.CTX().Done():
 				return
+			case <-p.Draining():
+				return
 			}
 		}
 	}()
@@ -33,6 +38,6 @@ func Slice[T any](p Pipeline, i []T) *slice[T] {
 }
 
 // Convenience function to return an empty []T.
-func EmptySlice[T any](p Pipeline) *slice[T] {
-	return Slice[T](p, []T{})
+func EmptySlice[T any](p Pipeline, options ...SourceOption) *slice[T] {
+	return Slice[T](p, []T{}, options...)
 }
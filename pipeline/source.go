@@ -0,0 +1,215 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"example.com/m/v2/logging"
+	"example.com/m/v2/metrics"
+	"github.com/google/uuid"
+)
+
+// Flow is a stage of a pipeline.
+type Flow interface {
+	ID() uuid.UUID
+	Name() string
+	Logger() *slog.Logger
+}
+
+// Source is the output of a stage, which the next stage takes as its input.
+// The stage closes the output when it is done.
+type Source[T any] interface {
+	Flow
+	Output() chan T
+}
+
+type source[T any] struct {
+	id     uuid.UUID
+	name   string
+	output chan T
+	logger *slog.Logger
+	// The timeout of each call to the stage's user function, 0 for none.
+	elementTimeout time.Duration
+	// The elements dropped as their call timed out.
+	timedOut *atomic.Int64
+	// The stage's metrics in the pipeline's registry, nil for a relay.
+	metrics *metrics.Stage
+}
+
+func (source *source[T]) ID() uuid.UUID {
+	return source.id
+}
+
+func (source *source[T]) Name() string {
+	return source.name
+}
+
+func (source *source[T]) Output() chan T {
+	return source.output
+}
+
+func (source *source[T]) Logger() *slog.Logger {
+	return source.logger
+}
+
+// Return the count of elements sent to the output and not yet received.
+func (source *source[T]) Buffered() int {
+	return len(source.output)
+}
+
+func (source *source[T]) BufferSize() int {
+	return cap(source.output)
+}
+
+// Return the count of elements dropped as their call to the stage's user function timed out, see WithElementTimeout.
+func (source *source[T]) TimedOut() int64 {
+	return source.timedOut.Load()
+}
+
+// Log the given key value pairs as the stage's metrics, with the output's buffer occupancy and timed out elements.
+// The counts and timings of each stage are also reported to the pipeline's metrics registry, see Pipeline.Metrics.
+func (source *source[T]) Metrics(args ...any) {
+	source.logger.Debug("Metrics", append(args, "Buffered", source.Buffered(), "BufferSize", source.BufferSize(), "TimedOut", source.TimedOut())...)
+}
+
+// SourceOption configures a stage, e.g. Mapper.
+type SourceOption func(*sourceOptions)
+
+type sourceOptions struct {
+	bufferSize     int
+	elementTimeout time.Duration
+}
+
+// Buffer the stage's output by size, so it can send up to size elements before they are received.
+func WithBufferSize(size int) SourceOption {
+	return func(options *sourceOptions) {
+		options.bufferSize = size
+	}
+}
+
+// Give each call to the stage's user function a context which times out after d, see MapperContext.
+// An element whose call fails once d has passed is dropped and counted, see TimedOut, rather than cancelling the pipeline.
+func WithElementTimeout(d time.Duration) SourceOption {
+	return func(options *sourceOptions) {
+		options.elementTimeout = d
+	}
+}
+
+// Return a new source for the named stage, logging with the stage name and ID.
+// The output is buffered by the pipeline's buffer size unless given WithBufferSize.
+// The stage must call FlowDone once it has closed the output, the pipeline counts it as open until then, see Shutdown.
+func NewSource[T any](p Pipeline, name string, options ...SourceOption) *source[T] {
+	o := sourceOptions{bufferSize: p.BufferSize()}
+	for _, option := range options {
+		option(&o)
+	}
+
+	if counter, ok := p.(flowCounter); ok {
+		counter.flowStarted()
+	}
+
+	id := uuid.New()
+	source := &source[T]{
+		id,
+		name,
+		make(chan T, o.bufferSize),
+		p.Logger().With(slog.String(logging.StageKey, name), slog.String(logging.StageIDKey, id.String())),
+		o.elementTimeout,
+		&atomic.Int64{},
+		p.Metrics().Stage(id.String(), name),
+	}
+	source.metrics.Buffer(source.Buffered, source.BufferSize())
+	return source
+}
+
+// sink is a stage which consumes its input without returning a Source, e.g. ForEach.
+// It is counted as open like a source until it calls FlowDone, so Shutdown waits for it to return.
+type sink struct {
+	id      uuid.UUID
+	name    string
+	logger  *slog.Logger
+	metrics *metrics.Stage
+}
+
+func newSink(p Pipeline, name string) *sink {
+	if counter, ok := p.(flowCounter); ok {
+		counter.flowStarted()
+	}
+
+	id := uuid.New()
+	return &sink{
+		id,
+		name,
+		p.Logger().With(slog.String(logging.StageKey, name), slog.String(logging.StageIDKey, id.String())),
+		p.Metrics().Stage(id.String(), name),
+	}
+}
+
+func (sink *sink) ID() uuid.UUID {
+	return sink.id
+}
+
+func (sink *sink) Name() string {
+	return sink.name
+}
+
+func (sink *sink) Logger() *slog.Logger {
+	return sink.logger
+}
+
+// Record an element received by the stage, where start is when the stage began waiting to receive.
+// The element is in flight until done is called.
+func (source *source[T]) received(start time.Time) {
+	source.metrics.Received(start)
+}
+
+// Record an element received by the stage as finished with, either sent or dropped.
+func (source *source[T]) done() {
+	source.metrics.Done()
+}
+
+// Send t to the output, recording it in the stage's metrics, returning false if the pipeline is done first.
+func (source *source[T]) send(p Pipeline, t T) bool {
+	start := time.Now()
+	select {
+	case source.output <- t:
+		source.metrics.Sent(start)
+		return true
+	case <-p.Done():
+		return false
+	}
+}
+
+// Call f for the given element with the pipeline's context, or a child context with the stage's element timeout.
+// A panic in f is returned as a PanicError.
+// If f fails once the element timeout has passed the element is counted as timed out, and false is returned with no error so the stage drops it.
+func (source *source[T]) call(p Pipeline, element any, f func(ctx context.Context) error) (bool, error) {
+	ctx := metrics.NewContext(p.CTX(), source.metrics)
+	start := time.Now()
+	if source.elementTimeout <= 0 {
+		err := protect(source.name, element, func() error { return f(ctx) })
+		source.metrics.Called(start, err)
+		return true, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, source.elementTimeout)
+	defer cancel()
+
+	if err := protect(source.name, element, func() error { return f(ctx) }); err != nil {
+		var panicErr *PanicError
+		if !errors.As(err, &panicErr) && errors.Is(ctx.Err(), context.DeadlineExceeded) && p.CTX().Err() == nil {
+			source.metrics.Called(start, nil)
+			source.metrics.TimedOut()
+			source.timedOut.Add(1)
+			source.logger.Warn("Element timed out", "Timeout", source.elementTimeout, "Err", err)
+			return false, nil
+		}
+		source.metrics.Called(start, err)
+		return true, err
+	}
+	source.metrics.Called(start, nil)
+	return true, nil
+}
@@ -1,31 +1,49 @@
 package pipeline
 
-import "github.com/google/uuid"
+import "context"
 
-func Supplier[T any](p pipeline, s func() (T, error)) chan T {
-	logger := Logger().With("Supplier", uuid.New())
-	logger.Debug("Begin")
+func Supplier[T any](p Pipeline, s func() (T, error), options ...SourceOption) *source[T] {
+	return SupplierContext(p, func(context.Context) (T, error) { return s() }, options...)
+}
 
-	output := make(chan T)
+// Supply elements like Supplier, calling s with the pipeline's context, or a child context if given WithElementTimeout.
+// A call which timed out is skipped.
+func SupplierContext[T any](p Pipeline, s func(ctx context.Context) (T, error), options ...SourceOption) *source[T] {
+	output := NewSource[T](p, "Supplier", options...)
+	logger := output.Logger()
+	logger.Debug("Begin")
 
 	count := 0
 
 	go func() {
 		defer func() {
-			close(output)
+			close(output.Output())
 			logger.Debug("End", "Count", count)
+			p.FlowDone(output)
 		}()
 
 		for {
-			t, err := s()
+			// Stop before calling s once draining, as a T returned by s is always sent.
+			select {
+			case <-p.Draining():
+				return
+			default:
+			}
+
+			var t T
+			called, err := output.call(p, nil, func(ctx context.Context) (err error) {
+				t, err = s(ctx)
+				return err
+			})
 			if err != nil {
 				p.CancelWithError(err)
 				return
 			}
+			if !called {
+				continue
+			}
 			count++
-			select {
-			case output <- t:
-			case <-p.ctx.Done():
+			if !output.send(p, t) {
 				return
 			}
 		}
@@ -1,10 +1,6 @@
 package pipeline
 
-import (
-	"fmt"
-	"sync"
-	"sync/atomic"
-)
+import "time"
 
 type tag[T any] struct {
 	index int
@@ -24,8 +20,8 @@ type Tag[T any] interface {
 	Value() T
 }
 
-func TagAdd[T any](p Pipeline, input Source[T]) *source[Tag[T]] {
-	output := NewSource[Tag[T]](p, "TagAdd")
+func TagAdd[T any](p Pipeline, input Source[T], options ...SourceOption) *source[Tag[T]] {
+	output := NewSource[Tag[T]](p, "TagAdd", options...)
 
 	go func() {
 		index := 0
@@ -33,19 +29,21 @@ func TagAdd[T any](p Pipeline, input Source[T]) *source[Tag[T]] {
 		defer func() {
 			close(output.Output())
 			output.Metrics("Index", index)
+			p.FlowDone(output)
 		}()
 
 		for {
+			start := time.Now()
 			select {
 			case t, ok := <-input.Output():
 				if !ok {
 					return
 				}
+				output.received(start)
 				index++
-				tag := &tag[T]{index, t}
-				select {
-				case output.Output() <- tag:
-				case <-p.Done():
+				sent := output.send(p, &tag[T]{index, t})
+				output.done()
+				if !sent {
 					return
 				}
 			case <-p.Done():
@@ -57,240 +55,15 @@ func TagAdd[T any](p Pipeline, input Source[T]) *source[Tag[T]] {
 	return output
 }
 
-type node[T any] struct {
-	tag  Tag[T]
-	next atomic.Pointer[node[T]]
+// Remove the tags added by TagAdd, sending the values in the order of their index, see Resequence.
+// The default options wait for a missing index until the input closes, then cancel the pipeline with resequence.ErrGap.
+func TagRemove[T any](p Pipeline, input Source[Tag[T]], options ...SourceOption) *source[T] {
+	return TagRemoveWith(p, input, ResequenceOptions(), options...)
 }
 
-func TagRemove[T any](p Pipeline, input Source[Tag[T]]) *source[T] {
-	output := NewSource[T](p, "TagRemove")
-
-	head := atomic.Pointer[node[T]]{}
-
-	addIndex := atomic.Int64{}
-	addIndex.Store(1)
-	removeIndex := atomic.Int64{}
-	removeIndex.Store(1)
-
-	// updateIndex := make(chan int)
-
-	walkNodes := func() {
-		cN := head.Load()
-		// output.Logger().Info("Walking nodes")
-		fmt.Println("Begin walking nodes")
-		for cN != nil {
-			StdOutConsumer[Tag[T]](p, cN.tag)
-			cN = cN.next.Load()
-		}
-		fmt.Println("End walking nodes")
-	}
-
-	wg := sync.WaitGroup{}
-	// eon := node[T]{}
-
-	removeNewHead := make(chan *node[T])
-
-	// Add
-	wg.Add(1)
-	go func() {
-		// l := output.Logger().WithGroup("Add")
-
-		index := 1
-
-		// pruneCount := 0
-
-		defer func() {
-			close(removeNewHead)
-
-			output.Metrics("AddCount", "Index", index)
-
-			wg.Done()
-
-			fmt.Println("ADD: OK")
-		}()
-
-		for {
-			select {
-			case t, ok := <-input.Output():
-				if !ok {
-					return
-				}
-
-				currentAddIndex := addIndex.Load()
-				currentRemoveIndex := removeIndex.Load()
-				fmt.Println("ADD: checking index", currentAddIndex, currentRemoveIndex)
-				if currentRemoveIndex > currentAddIndex {
-					cH := head.Load()
-					cN := cH
-					for cN != nil {
-						if cN.tag.Index() >= int(currentRemoveIndex) {
-							break
-						}
-						fmt.Println("ADD: removing node", cN)
-						cN = cN.next.Load()
-					}
-					if cN != cH {
-						fmt.Println("ADD: new head", cN, cN != nil)
-						head.Store(cN)
-					}
-					addIndex.Store(currentRemoveIndex)
-				}
-
-				fmt.Println("ADD: Tag received", "Tag", t)
-
-				cH := head.Load()
-				hUpdated := false
-
-				if cH == nil {
-					nH := node[T]{t, atomic.Pointer[node[T]]{}}
-					head.Store(&nH)
-					hUpdated = true
-				} else {
-					var pN *node[T] = nil
-					cN := cH
-					added := false
-					for !added {
-						if t.Index() < cN.tag.Index() {
-							if pN == nil {
-								nN := node[T]{t, atomic.Pointer[node[T]]{}}
-								nN.next.Store(cN)
-								head.Store(&nN)
-								hUpdated = true
-								added = true
-							} else {
-								nN := node[T]{t, atomic.Pointer[node[T]]{}}
-								nN.next.Store(pN.next.Load())
-								pN.next.Store(&nN)
-								added = true
-							}
-						} else {
-							pN = cN
-							cN = cN.next.Load()
-							if cN == nil {
-								nN := node[T]{t, atomic.Pointer[node[T]]{}}
-								pN.next.Store(&nN)
-								added = true
-							}
-						}
-					}
-				}
-
-				if hUpdated {
-					fmt.Println("ADD: send new head to remove")
-					select {
-					case removeNewHead <- head.Load():
-					case <-p.Done():
-						return
-					}
-				}
-
-			case <-p.Done():
-				return
-			}
-		}
-	}()
-
-	// Remove
-	wg.Add(1)
-	go func() {
-		index := 1
-
-		defer func() {
-			fmt.Println("REMOVE: closing")
-
-			output.Metrics("Index", index)
-
-			wg.Done()
-
-			fmt.Println("REMOVE: OK")
-
-		}()
-
-		for {
-			select {
-			case head, ok := <-removeNewHead:
-				if !ok {
-					fmt.Println("REMOVE: close new head")
-					return
-				}
-
-				fmt.Println("REMOVE: head", head)
-
-				// cI := index
-				fmt.Println("REMOVE: index", index)
-
-				cN := head
-				for cN != nil {
-					if cN.tag.Index() > index {
-						break
-					}
-					if cN.tag.Index() == index {
-						// fmt.Println("REMOVE: Output tag value", cN.tag)
-						select {
-						case output.Output() <- cN.tag.Value():
-							index++
-						case <-p.Done():
-							return
-						}
-					}
-					cN = cN.next.Load()
-				}
-				fmt.Println("REMOVE: index", index)
-				removeIndex.Store(int64(index))
-			case <-p.Done():
-				return
-			}
-		}
-	}()
-
-	// TODO: Do we want to close the output in the reaper?
-	// defer close(output)
-	// If we have an error we can p.CancelWithError(...)
-	go func() {
-		fmt.Println("REAPER: waiting")
-
-		defer func() {
-
-			close(output.output)
-
-		}()
-
-		wg.Wait()
-
-		currentHead := head.Load()
-		currentAddIndex := addIndex.Load()
-		currentRemoveIndex := removeIndex.Load()
-		fmt.Println("REAPER: sanity checking index", currentAddIndex, currentRemoveIndex, currentHead)
-		if currentRemoveIndex > currentAddIndex {
-			cH := head.Load()
-			cN := cH
-			for cN != nil {
-				if cN.tag.Index() >= int(currentRemoveIndex) {
-					break
-				}
-				fmt.Println("REAPER: removing node", cN)
-				cN = cN.next.Load()
-			}
-			if cN != cH {
-				fmt.Println("REAPER: new head", cN, cN != nil)
-				head.Store(cN)
-			}
-			addIndex.Store(currentRemoveIndex)
-		}
-		currentHead = head.Load()
-		currentAddIndex = addIndex.Load()
-		fmt.Println("REAPER: sanity checking index", currentAddIndex, currentRemoveIndex, currentHead)
-
-		if currentHead != nil {
-			fmt.Println("REAPER: inconsistent index before source closed", currentHead.tag.Index())
-		}
-
-		fmt.Println("REAPER: walk nodes")
-		walkNodes()
-
-		fmt.Println("REAPER: OK")
-
-	}()
-
-	return output
+// Remove the tags like TagRemove, with the given buffer limits and gap policy.
+func TagRemoveWith[T any](p Pipeline, input Source[Tag[T]], opts *resequenceOptions, options ...SourceOption) *source[T] {
+	index := func(t Tag[T]) int { return t.Index() }
+	value := func(t Tag[T]) T { return t.Value() }
+	return resequenceStage(p, "TagRemove", input, index, value, 1, func(i int) int { return i + 1 }, opts, options...)
 }
@@ -1,71 +1,66 @@
 package pipeline
 
 import (
+	"errors"
+	"slices"
 	"testing"
-	"time"
+
+	"example.com/m/v2/resequence"
 )
 
+func tags(indexes ...int) []Tag[int] {
+	result := []Tag[int]{}
+	for _, index := range indexes {
+		result = append(result, &tag[int]{index, index})
+	}
+	return result
+}
+
 func TestTag1(t *testing.T) {
 	p := NewPipeline()
 	defer p.Cancel()
 
-	slice := EmptySlice[Tag[int]](p)
-
-	// peek := Peek[Tag[int]](p, slice, f)
-
-	remove := TagRemove[int](p, slice)
-
-	<-ForEachStdOutV[int](p, remove).Output()
+	result, err := ToSlice[int](p, TagRemove[int](p, EmptySlice[Tag[int]](p)))
+	if err != nil || len(result.Value()) != 0 || p.Error() != nil {
+		t.Fatalf("result %v %v %v", result.Value(), err, p.Error())
+	}
 }
 
 func TestTag2(t *testing.T) {
 	p := NewPipeline()
 	defer p.Cancel()
 
-	slice := Slice[Tag[int]](p, []Tag[int]{&tag[int]{2, 2}, &tag[int]{3, 3}, &tag[int]{5, 5}, &tag[int]{9, 9}, &tag[int]{1, 1}, &tag[int]{7, 7}, &tag[int]{4, 4}, &tag[int]{8, 8}, &tag[int]{6, 6}})
-
-	// limit := Limit[int](p, sequence, 10)
+	slice := Slice[Tag[int]](p, tags(2, 3, 5, 9, 1, 7, 4, 8, 6))
 
-	// add := TagAdd[int](p, limit)
-
-	f := func(p Pipeline, t Tag[int]) error {
-		// fmt.Printf("Value [%v]\n", t)
-		time.Sleep(500 * time.Millisecond)
-		return nil
+	result, err := ToSlice[int](p, TagRemove[int](p, slice))
+	if err != nil || !slices.Equal(result.Value(), []int{1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Fatalf("result %v %v", result.Value(), err)
 	}
-
-	// mapper := Mapper[Tag[int]](p, add, f, MapperOpts{})
-
-	peek := Peek[Tag[int]](p, slice, f)
-
-	remove := TagRemove[int](p, peek)
-
-	<-ForEachStdOutV[int](p, remove).Output()
 }
 
 func TestTag3(t *testing.T) {
 	p := NewPipeline()
 	defer p.Cancel()
 
-	slice := Slice[Tag[int]](p, []Tag[int]{&tag[int]{2, 2}, &tag[int]{3, 3}, &tag[int]{5, 5}, &tag[int]{9, 9}, &tag[int]{1, 1}, &tag[int]{7, 7}, &tag[int]{4, 4}, &tag[int]{8, 8}})
+	// 6 never arrives.
+	slice := Slice[Tag[int]](p, tags(2, 3, 5, 9, 1, 7, 4, 8))
 
-	// limit := Limit[int](p, sequence, 10)
-
-	// add := TagAdd[int](p, limit)
-
-	f := func(p Pipeline, t Tag[int]) error {
-		// fmt.Printf("Value [%v]\n", t)
-		time.Sleep(500 * time.Millisecond)
-		return nil
+	ToSlice[int](p, TagRemove[int](p, slice))
+	if !errors.Is(p.Error(), resequence.ErrGap) {
+		t.Fatal(p.Error())
 	}
+}
 
-	// mapper := Mapper[Tag[int]](p, add, f, MapperOpts{})
-
-	peek := Peek[Tag[int]](p, slice, f)
-
-	remove := TagRemove[int](p, peek)
+func TestTagRoundTrip(t *testing.T) {
+	p := NewPipeline()
+	defer p.Cancel()
 
-	<-ForEachStdOutV[int](p, remove).Output()
+	data := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	add := TagAdd[int](p, Slice[int](p, data))
+	mapper := Mapper[Tag[int]](p, add, func(t Tag[int]) (Tag[int], error) { return t, nil }, *GroupOptions().ParallelWorkers())
 
-	time.Sleep(2 * time.Second)
+	result, err := ToSlice[int](p, TagRemove[int](p, mapper))
+	if err != nil || !slices.Equal(result.Value(), data) {
+		t.Fatalf("result %v %v", result.Value(), err)
+	}
 }
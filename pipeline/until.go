@@ -1,38 +1,48 @@
 package pipeline
 
-import "github.com/google/uuid"
+import (
+	"context"
+	"time"
+)
 
-func Until[T any](pipeline pipeline, input chan T, p func(T) (bool, error)) chan T {
-	logger := Logger().With("Until", uuid.New())
+func Until[T any](pipeline Pipeline, input Source[T], p func(T) (bool, error), options ...SourceOption) *source[T] {
+	output := NewSource[T](pipeline, "Until", options...)
+	logger := output.Logger()
 	logger.Debug("Begin")
 
-	output := make(chan T)
 	tCount := 0
 
 	go func() {
 		defer func() {
-			close(output)
+			close(output.Output())
 			logger.Debug("End", "TCount", tCount)
+			pipeline.FlowDone(output)
 		}()
 
 		for {
+			start := time.Now()
 			select {
-			case t, ok := <-input:
+			case t, ok := <-input.Output():
 				if !ok {
 					return
 				}
+				output.received(start)
 				tCount++
-				b, err := p(t)
-				if err != nil {
-					pipeline.CancelWithError(err)
+				b := false
+				_, err := output.call(pipeline, t, func(_ context.Context) (err error) {
+					b, err = p(t)
+					return err
+				})
+				if err != nil || b {
+					output.done()
+					if err != nil {
+						pipeline.CancelWithError(err)
+					}
 					return
 				}
-				if b {
-					return
-				}
-				select {
-				case output <- t:
-				case <-pipeline.Done():
+				sent := output.send(pipeline, t)
+				output.done()
+				if !sent {
 					return
 				}
 			case <-pipeline.Done():
@@ -44,11 +54,11 @@ func Until[T any](pipeline pipeline, input chan T, p func(T) (bool, error)) chan
 	return output
 }
 
-func Limit[T any](pipeline pipeline, input chan T, max int) chan T {
+func Limit[T any](pipeline Pipeline, input Source[T], max int, options ...SourceOption) *source[T] {
 	count := 0
 	p := func(t T) (bool, error) {
 		count++
 		return !(count <= max), nil
 	}
-	return Until[T](pipeline, input, p)
+	return Until[T](pipeline, input, p, options...)
 }
@@ -1,15 +1,16 @@
 /*
 Worker provides a way to process a channel.
 
-<-group[int](pipeline, Slice[int](pipeline, data), f, *GroupOptions().SequentialWorker())
+<-WorkerGroup[int](pipeline, Slice[int](pipeline, data), f, *GroupOptions().SequentialWorker())
 
-<-group[int](pipeline, Slice[int](pipeline, data), f, *GroupOptions().ParallelWorkers())
+<-WorkerGroup[int](pipeline, Slice[int](pipeline, data), f, *GroupOptions().ParallelWorkers())
 
-progress := group[int](pipeline, Slice[int](pipeline, data), f, *GroupOptions().SequentialWorker().WithProgress())
+progress := WorkerGroup[int](pipeline, Slice[int](pipeline, data), f, *GroupOptions().SequentialWorker().WithProgress())
 */
 package pipeline
 
 import (
+	"context"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -76,12 +77,18 @@ type groupProgress[T any] struct {
 /*
 Define a group of workers.
 Read the input channel calling consumer for each element.
-The group will end when the input is closed or the consumer returns an error.
+The group will end when the input is closed or the consumer returns an error, which cancels the pipeline.
 
 If WithProgress is true each worker will output each element processed (the output channel needs to be received from).
 Effectively a passthru.
 */
-func WorkerGroup[T any](pipeline Pipeline, input Source[T], c func(Pipeline, T) error, opts groupOptions) *source[groupProgress[T]] {
+func WorkerGroup[T any](pipeline Pipeline, input Source[T], c func(Pipeline, T) error, opts groupOptions, options ...SourceOption) *source[groupProgress[T]] {
+	return WorkerGroupContext(pipeline, input, func(_ context.Context, p Pipeline, t T) error { return c(p, t) }, opts, options...)
+}
+
+// Run workers like WorkerGroup, calling c with the pipeline's context, or a child context if given WithElementTimeout.
+// An element whose call timed out is not reported as progress.
+func WorkerGroupContext[T any](pipeline Pipeline, input Source[T], c func(context.Context, Pipeline, T) error, opts groupOptions, options ...SourceOption) *source[groupProgress[T]] {
 	// groupUUID := uuid.New()
 
 	// logger := Logger().With("group", groupUUID)
@@ -96,7 +103,11 @@ func WorkerGroup[T any](pipeline Pipeline, input Source[T], c func(Pipeline, T)
 
 	workerWaitGroup := sync.WaitGroup{}
 
-	workerGroup := NewSource[groupProgress[T]](pipeline, "WorkerGroup")
+	workerGroup := NewSource[groupProgress[T]](pipeline, "WorkerGroup", options...)
+
+	if reporter, ok := pipeline.(workerReporter); ok {
+		reporter.reportWorkers(workersRunning.Load, opts.MaxWorkers)
+	}
 
 	slice := func() {
 		sliceUUID := uuid.New()
@@ -113,7 +124,7 @@ func WorkerGroup[T any](pipeline Pipeline, input Source[T], c func(Pipeline, T)
 			logger.Debug("Metrics", "SliceInputCount", sliceInputCount)
 		}()
 
-		idleTimer := time.NewTimer(opts.IdleWorkerDuration)
+		idleTimer := pipeline.Clock().NewTimer(opts.IdleWorkerDuration)
 		for {
 			select {
 			case t, ok := <-sliceInput:
@@ -122,17 +133,18 @@ func WorkerGroup[T any](pipeline Pipeline, input Source[T], c func(Pipeline, T)
 				if !ok {
 					return
 				}
-				if err := c(pipeline, t); err != nil {
+				called, err := workerGroup.call(pipeline, t, func(ctx context.Context) error { return c(ctx, pipeline, t) })
+				if err != nil {
+					workerGroup.done()
+					pipeline.CancelWithError(err)
 					return
 				}
-				if opts.Progress {
-					select {
-					case workerGroup.Output() <- groupProgress[T]{workerGroup.ID(), sliceUUID, t}:
-					case <-pipeline.Done():
-						return
-					}
+				if called && opts.Progress && !workerGroup.send(pipeline, groupProgress[T]{workerGroup.ID(), sliceUUID, t}) {
+					workerGroup.done()
+					return
 				}
-			case <-idleTimer.C:
+				workerGroup.done()
+			case <-idleTimer.C():
 				logger.Debug("Idle duration reached")
 				return
 			case <-pipeline.Done():
@@ -140,7 +152,7 @@ func WorkerGroup[T any](pipeline Pipeline, input Source[T], c func(Pipeline, T)
 			}
 			//
 			if !idleTimer.Stop() {
-				<-idleTimer.C
+				<-idleTimer.C()
 			}
 			idleTimer.Reset(opts.IdleWorkerDuration)
 		}
@@ -158,33 +170,38 @@ func WorkerGroup[T any](pipeline Pipeline, input Source[T], c func(Pipeline, T)
 		}()
 
 		for {
+			start := time.Now()
 			select {
 			case t, ok := <-input.Output():
 				if !ok {
 					workerGroup.Logger().Debug("Input closed")
 					return
 				}
+				// Done once a worker has called c.
+				workerGroup.received(start)
 
 				select {
 				case sliceInput <- t:
 					sliceInputCount++
 				case <-pipeline.Done():
 					workerGroup.Logger().Debug("Pipeline done")
+					workerGroup.done()
 					return
 				default:
 					workerGroup.Logger().Debug("No slice available")
 					if int(workersRunning.Load()) < opts.MaxWorkers {
-						logger.Debug("New slice")
+						workerGroup.Logger().Debug("New slice")
 						workersCount.Add(1)
 						workersRunning.Add(1)
 						workerWaitGroup.Add(1)
 						go slice()
 					}
-					logger.Debug("Waiting on slice")
+					workerGroup.Logger().Debug("Waiting on slice")
 					select {
 					case sliceInput <- t:
 						sliceInputCount++
 					case <-pipeline.Done():
+						workerGroup.done()
 						return
 					}
 				}
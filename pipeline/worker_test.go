@@ -1,9 +1,13 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
+
+	"example.com/m/v2/clock"
+	"example.com/m/v2/tracing"
 )
 
 func TestWorker(t *testing.T) {
@@ -11,36 +15,106 @@ func TestWorker(t *testing.T) {
 
 	data := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
 
-	f := func(t int) error {
+	f := func(p Pipeline, t int) error {
 		fmt.Printf("%v\n", t)
 		time.Sleep(500 * time.Millisecond)
 		return nil
 	}
 
-	// <-group[int](pipeline, Slice[int](pipeline, data), f, *GroupOptions().SequentialWorker())
+	// <-WorkerGroup[int](pipeline, Slice[int](pipeline, data), f, *GroupOptions().SequentialWorker())
 
-	// <-group[int](pipeline, Slice[int](pipeline, data), f, *GroupOptions().ParallelWorkers())
+	// <-WorkerGroup[int](pipeline, Slice[int](pipeline, data), f, *GroupOptions().ParallelWorkers())
 
-	progress := group[int](pipeline, Slice[int](pipeline, data), f, *GroupOptions().SequentialWorker().WithProgress())
+	progress := WorkerGroup[int](pipeline, Slice[int](pipeline, data), f, *GroupOptions().SequentialWorker().WithProgress())
 
 	StdOutV[groupProgress[int]](pipeline, progress)
 
 	fmt.Printf("OK\n")
 }
 
+// workersPipeline records the running workers of a WorkerGroup.
+type workersPipeline struct {
+	*pipeline
+	workers func() int64
+}
+
+func (p *workersPipeline) reportWorkers(workers func() int64, _ int) {
+	p.workers = workers
+}
+
 func TestIdleWorker(t *testing.T) {
-	pipeline := Background()
+	fake := clock.NewFake(time.Unix(0, 0))
+	pipeline := &workersPipeline{pipeline: NewPipeline().WithClock(fake)}
 
-	data := []int{0, 1, 3}
+	input := NewSource[int](pipeline, "input")
+	progress := WorkerGroup[int](pipeline, input, func(p Pipeline, t int) error { return nil }, *GroupOptions().SequentialWorker().WithIdleWorkerDuration(time.Minute).WithProgress())
 
-	f := func(t int) error {
-		fmt.Printf("%v\n", t)
-		return nil
+	input.Output() <- 0
+	first := <-progress.Output()
+	input.Output() <- 1
+	second := <-progress.Output()
+
+	// Advance until the worker has been idle for a minute and exits.
+	for pipeline.workers() > 0 {
+		fake.Advance(time.Minute)
+		time.Sleep(time.Millisecond)
 	}
 
-	progress := group[int](pipeline, Throttle[int](pipeline, Slice[int](pipeline, data), 2*time.Second), f, *GroupOptions().SequentialWorker().WithIdleWorkerDuration(60 * time.Second).WithProgress())
+	input.Output() <- 3
+	third := <-progress.Output()
 
-	StdOutV[groupProgress[int]](pipeline, progress)
+	close(input.Output())
+	for range progress.Output() {
+	}
 
-	fmt.Printf("OK\n")
+	if first.worker != second.worker || third.worker == first.worker || third.t != 3 {
+		t.Fatalf("progress %v %v %v", first, second, third)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	start := time.Unix(0, 0)
+	fake := clock.NewFake(start)
+	pipeline := NewPipeline().WithClock(fake)
+
+	throttle := Throttle(pipeline, Slice(pipeline, []int{0, 1, 2}), 5*time.Minute)
+
+	for i := 0; i < 3; i++ {
+		fake.BlockUntil(1)
+		fake.Advance(5 * time.Minute)
+		if element := <-throttle.Output(); element != i {
+			t.Fatalf("element %d", element)
+		}
+	}
+	if _, ok := <-throttle.Output(); ok || fake.Since(start) != 15*time.Minute {
+		t.Fatalf("open %v elapsed %v", ok, fake.Since(start))
+	}
+}
+
+func TestWorkerGroupTracing(t *testing.T) {
+	p := NewPipeline()
+
+	exporter := tracing.NewMemoryExporter()
+	tracer := tracing.NewTracer(nil, exporter)
+
+	traced := Mapper(p, Slice(p, []int{1, 2, 3}), func(t int) (tracing.Traced[int], error) { return tracing.Start(tracer, t), nil }, *GroupOptions())
+	progress := WorkerGroupContext(p, traced, tracing.WorkerContext(tracer, "worker", func(ctx context.Context, p Pipeline, t int) error {
+		return nil
+	}), *GroupOptions().ParallelWorkers())
+
+	if err := Drop(p, progress); err != nil {
+		t.Fatal(err)
+	}
+
+	// A worker span and the element's root span for each element.
+	spans := exporter.Spans()
+	if len(spans) != 6 {
+		t.Fatalf("spans [%+v]", spans)
+	}
+	for _, span := range spans {
+		trace := exporter.Trace(span.TraceID)
+		if len(trace) != 2 || trace[0].Name != "worker" || trace[0].ParentID != trace[1].SpanID || trace[1].Outcome != tracing.OutcomeOK {
+			t.Fatalf("trace [%+v]", trace)
+		}
+	}
 }
@@ -0,0 +1,277 @@
+/*
+Resequence provides the bounded reorder buffer behind the resequencing stages, pipeline.Resequence and v3.NewSequenceRemove.
+
+Elements are keyed by a sequence, where the key after k is next(k), so keys need not be integers, e.g. a sequence of offsets or of names.
+The buffer holds the elements which arrived ahead of the expected key, and releases them in order once the expected key arrives.
+
+	r := resequence.New[int, string](1, func(k int) int { return k + 1 }, resequence.DefaultOptions())
+	ready, err := r.Add(2, "b") // [] nil
+	ready, err = r.Add(1, "a")  // [a b] nil
+*/
+package resequence
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Policy is what a resequencing stage does about a gap, a missing key holding back the elements buffered behind it.
+type Policy string
+
+const (
+	// Keep waiting for the missing key, failing if the buffer overflows or the input closes first.
+	Wait Policy = "wait"
+	// Skip the missing keys, releasing the elements buffered behind them, and drop them if they arrive later.
+	Skip Policy = "skip"
+	// Fail the stage with ErrGap.
+	Fail Policy = "fail"
+)
+
+var (
+	ErrGap      = errors.New("sequence gap")
+	ErrOverflow = errors.New("resequence buffer is full")
+)
+
+// Options configure a Resequencer.
+type Options struct {
+	// The most elements buffered behind a missing key.
+	MaxBuffered int
+	// The most missing keys skipped at once.
+	MaxGap int
+	// How long a stage waits for a missing key before applying the policy, 0 to wait until the buffer overflows or the input closes.
+	GapTimeout time.Duration
+	Policy     Policy
+}
+
+// Return the default options, buffering up to 1024 elements and waiting for a missing key.
+func DefaultOptions() Options {
+	return Options{MaxBuffered: 1024, MaxGap: 1024, Policy: Wait}
+}
+
+// Stats counts the elements through a Resequencer.
+type Stats struct {
+	// The elements released in order, and those which were buffered before their release.
+	Released  int64
+	Reordered int64
+	// The elements buffered now, and the most buffered at once.
+	Depth    int64
+	MaxDepth int64
+	// The gaps skipped, and the keys missing in them.
+	Gaps    int64
+	Skipped int64
+	// The elements dropped as they arrived after their key was skipped or released.
+	Late int64
+	// The elements dropped as an element with the same key was already buffered.
+	Duplicates int64
+}
+
+func (stats Stats) String() string {
+	return fmt.Sprintf("released %d reordered %d depth %d max depth %d gaps %d skipped %d late %d duplicates %d",
+		stats.Released, stats.Reordered, stats.Depth, stats.MaxDepth, stats.Gaps, stats.Skipped, stats.Late, stats.Duplicates)
+}
+
+// Resequencer is a reorder buffer, it is not safe for concurrent use.
+type Resequencer[K comparable, T any] struct {
+	expected K
+	next     func(K) K
+	buffer   map[K]T
+	opts     Options
+	// The last MaxBuffered+MaxGap keys skipped or released, oldest first, to drop elements arriving late.
+	done    []K
+	doneSet map[K]struct{}
+	stats   Stats
+}
+
+// Return a new resequencer expecting first.
+func New[K comparable, T any](first K, next func(K) K, opts Options) *Resequencer[K, T] {
+	return &Resequencer[K, T]{
+		expected: first,
+		next:     next,
+		buffer:   map[K]T{},
+		opts:     opts,
+		doneSet:  map[K]struct{}{},
+	}
+}
+
+// Return the key of the next element to release.
+func (r *Resequencer[K, T]) Expected() K {
+	return r.expected
+}
+
+// Return the count of elements buffered.
+func (r *Resequencer[K, T]) Len() int {
+	return len(r.buffer)
+}
+
+func (r *Resequencer[K, T]) Stats() Stats {
+	return r.stats
+}
+
+/*
+Add the element with key k, returning the elements now ready in order.
+
+An element with the expected key is released along with the elements buffered behind it.
+An element arriving after its key was released or skipped, or with the key of a buffered element, is dropped and counted.
+As keys are only compared for equality, a key is known to be late for the MaxBuffered+MaxGap keys following it, an element arriving later still is buffered as if early.
+If the buffer is full the gap is skipped with the Skip policy, otherwise ErrOverflow is returned and the element is not added.
+When k falls in the gap only the keys before k are skipped, and k is released with the elements buffered behind it.
+*/
+func (r *Resequencer[K, T]) Add(k K, t T) ([]T, error) {
+	if _, ok := r.doneSet[k]; ok {
+		r.stats.Late++
+		return nil, nil
+	}
+	if _, ok := r.buffer[k]; ok {
+		r.stats.Duplicates++
+		return nil, nil
+	}
+
+	if k != r.expected {
+		if len(r.buffer) >= r.opts.MaxBuffered {
+			if r.opts.Policy != Skip {
+				return nil, fmt.Errorf("%w: %d elements waiting for %v", ErrOverflow, len(r.buffer), r.expected)
+			}
+			if skipped, ok := r.inGap(k); ok {
+				r.skip(skipped)
+				ready := []T{t}
+				r.release()
+				r.stats.Released++
+				return append(ready, r.flush()...), nil
+			}
+			// Skipping releases at least one element, making room.
+			ready, err := r.Skip()
+			if err != nil {
+				return ready, err
+			}
+			more, err := r.Add(k, t)
+			return append(ready, more...), err
+		}
+		r.buffer[k] = t
+		r.stats.Reordered++
+		r.depth()
+		return nil, nil
+	}
+
+	ready := []T{t}
+	r.release()
+	r.stats.Released++
+	return append(ready, r.flush()...), nil
+}
+
+/*
+Skip the gap before the nearest buffered key, returning the elements now ready in order.
+
+The missing keys are followed with next for up to MaxGap keys, ErrGap is returned if no buffered key is found.
+Nothing is skipped if the buffer is empty.
+*/
+func (r *Resequencer[K, T]) Skip() ([]T, error) {
+	if len(r.buffer) == 0 {
+		return nil, nil
+	}
+
+	k := r.expected
+	for skipped := 1; skipped <= r.opts.MaxGap; skipped++ {
+		k = r.next(k)
+		if _, ok := r.buffer[k]; !ok {
+			continue
+		}
+
+		r.skip(skipped)
+		return r.flush(), nil
+	}
+	return nil, fmt.Errorf("%w: no element within %d keys of %v", ErrGap, r.opts.MaxGap, r.expected)
+}
+
+// Apply the policy once the gap timeout has passed, returning the elements now ready in order.
+// Skip skips the gap, Fail returns ErrGap and Wait does nothing.
+func (r *Resequencer[K, T]) Timeout() ([]T, error) {
+	if len(r.buffer) == 0 {
+		return nil, nil
+	}
+	switch r.opts.Policy {
+	case Skip:
+		return r.Skip()
+	case Fail:
+		return nil, fmt.Errorf("%w: waited %v for %v with %d elements buffered", ErrGap, r.opts.GapTimeout, r.expected, len(r.buffer))
+	}
+	return nil, nil
+}
+
+// Release what is left once the input is closed, returning the elements ready in order.
+// With the Skip policy every gap is skipped, otherwise ErrGap is returned if any element is still buffered.
+func (r *Resequencer[K, T]) Close() ([]T, error) {
+	if r.opts.Policy != Skip {
+		if len(r.buffer) > 0 {
+			return nil, fmt.Errorf("%w: input closed with %d elements waiting for %v", ErrGap, len(r.buffer), r.expected)
+		}
+		return nil, nil
+	}
+
+	ready := []T{}
+	for len(r.buffer) > 0 {
+		more, err := r.Skip()
+		ready = append(ready, more...)
+		if err != nil {
+			return ready, err
+		}
+	}
+	return ready, nil
+}
+
+// Return how many missing keys come before k, if k is within MaxGap keys of the expected key and before the nearest buffered key.
+func (r *Resequencer[K, T]) inGap(k K) (int, bool) {
+	key := r.expected
+	for skipped := 1; skipped <= r.opts.MaxGap; skipped++ {
+		if key = r.next(key); key == k {
+			return skipped, true
+		}
+		if _, ok := r.buffer[key]; ok {
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// Skip the given count of missing keys as a gap.
+func (r *Resequencer[K, T]) skip(skipped int) {
+	for i := 0; i < skipped; i++ {
+		r.release()
+	}
+	r.stats.Gaps++
+	r.stats.Skipped += int64(skipped)
+}
+
+// Move past the expected key, remembering it to drop an element arriving late.
+func (r *Resequencer[K, T]) release() {
+	r.done = append(r.done, r.expected)
+	r.doneSet[r.expected] = struct{}{}
+	// Remember as many keys as could be buffered or skipped at once, so an element is dropped if it arrives while the buffer could still hold it.
+	if len(r.done) > r.opts.MaxBuffered+r.opts.MaxGap {
+		delete(r.doneSet, r.done[0])
+		r.done = r.done[1:]
+	}
+	r.expected = r.next(r.expected)
+}
+
+// Release the buffered elements which are now in order.
+func (r *Resequencer[K, T]) flush() []T {
+	ready := []T{}
+	for {
+		t, ok := r.buffer[r.expected]
+		if !ok {
+			break
+		}
+		delete(r.buffer, r.expected)
+		ready = append(ready, t)
+		r.release()
+		r.stats.Released++
+	}
+	r.depth()
+	return ready
+}
+
+func (r *Resequencer[K, T]) depth() {
+	r.stats.Depth = int64(len(r.buffer))
+	r.stats.MaxDepth = max(r.stats.MaxDepth, r.stats.Depth)
+}
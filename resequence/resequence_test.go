@@ -0,0 +1,145 @@
+package resequence
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func increment(k int) int {
+	return k + 1
+}
+
+// Add each key with itself as the element, returning the elements released.
+func add(t *testing.T, r *Resequencer[int, int], keys ...int) []int {
+	released := []int{}
+	for _, k := range keys {
+		ready, err := r.Add(k, k)
+		if err != nil {
+			t.Fatalf("add %d: %v", k, err)
+		}
+		released = append(released, ready...)
+	}
+	return released
+}
+
+func TestResequence(t *testing.T) {
+	r := New[int, int](1, increment, DefaultOptions())
+
+	if released := add(t, r, 2, 3, 5, 9, 1, 7, 4, 8, 6); !slices.Equal(released, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Fatalf("released %v", released)
+	}
+	if stats := r.Stats(); stats.Released != 9 || stats.Reordered != 6 || stats.MaxDepth != 4 || stats.Depth != 0 || r.Expected() != 10 {
+		t.Fatalf("stats %v expected %d", stats, r.Expected())
+	}
+}
+
+func TestResequenceKeys(t *testing.T) {
+	// Keys need only a successor, here each key is the next letter.
+	r := New[string, int]("a", func(k string) string { return string(rune(k[0] + 1)) }, DefaultOptions())
+
+	released := []int{}
+	for i, k := range []string{"c", "a", "b"} {
+		ready, _ := r.Add(k, i)
+		released = append(released, ready...)
+	}
+	if !slices.Equal(released, []int{1, 2, 0}) {
+		t.Fatalf("released %v", released)
+	}
+}
+
+func TestResequenceSkip(t *testing.T) {
+	r := New[int, int](1, increment, DefaultOptions())
+
+	if released := add(t, r, 1, 4, 5, 7); !slices.Equal(released, []int{1}) {
+		t.Fatalf("released %v", released)
+	}
+
+	released, err := r.Skip()
+	if err != nil || !slices.Equal(released, []int{4, 5}) {
+		t.Fatalf("skip %v %v", released, err)
+	}
+	released, err = r.Skip()
+	if err != nil || !slices.Equal(released, []int{7}) {
+		t.Fatalf("skip %v %v", released, err)
+	}
+	if released, err := r.Skip(); err != nil || len(released) != 0 {
+		t.Fatalf("skip empty %v %v", released, err)
+	}
+
+	// The skipped keys are dropped when they arrive late, as is a key already released.
+	if released := add(t, r, 2, 3, 5, 8); !slices.Equal(released, []int{8}) {
+		t.Fatalf("late %v", released)
+	}
+	if stats := r.Stats(); stats.Gaps != 2 || stats.Skipped != 3 || stats.Late != 3 || stats.Released != 5 {
+		t.Fatalf("stats %v", stats)
+	}
+}
+
+func TestResequenceOverflowInGap(t *testing.T) {
+	r := New[int, int](1, increment, Options{MaxBuffered: 2, MaxGap: 2, Policy: Skip})
+
+	// Only 1 is missing once 2 arrives with the buffer full.
+	if released := add(t, r, 3, 4, 2); !slices.Equal(released, []int{2, 3, 4}) {
+		t.Fatalf("released %v", released)
+	}
+	if stats := r.Stats(); stats.Gaps != 1 || stats.Skipped != 1 || stats.Late != 0 || r.Expected() != 5 {
+		t.Fatalf("stats %v expected %d", stats, r.Expected())
+	}
+}
+
+func TestResequenceLimits(t *testing.T) {
+	r := New[int, int](1, increment, Options{MaxBuffered: 2, MaxGap: 2})
+
+	add(t, r, 3, 3)
+	if r.Stats().Duplicates != 1 {
+		t.Fatalf("stats %v", r.Stats())
+	}
+
+	add(t, r, 5)
+	if _, err := r.Add(6, 6); !errors.Is(err, ErrOverflow) || r.Len() != 2 {
+		t.Fatalf("overflow %v", err)
+	}
+
+	// 3 is within two keys of 1.
+	if released, err := r.Skip(); err != nil || !slices.Equal(released, []int{3}) {
+		t.Fatalf("skip %v %v", released, err)
+	}
+	// 4 is not.
+	r = New[int, int](1, increment, Options{MaxBuffered: 2, MaxGap: 2})
+	add(t, r, 4)
+	if _, err := r.Skip(); !errors.Is(err, ErrGap) {
+		t.Fatalf("gap %v", err)
+	}
+}
+
+func TestResequencePolicies(t *testing.T) {
+	skip := New[int, int](1, increment, Options{MaxBuffered: 2, MaxGap: 2, Policy: Skip})
+	// Overflowing skips the gap to make room.
+	if released := add(t, skip, 1, 3, 4, 5); !slices.Equal(released, []int{1, 3, 4, 5}) {
+		t.Fatalf("overflow %v", released)
+	}
+	add(t, skip, 7)
+	if released, err := skip.Timeout(); err != nil || !slices.Equal(released, []int{7}) {
+		t.Fatalf("timeout %v %v", released, err)
+	}
+	add(t, skip, 9, 11)
+	if released, err := skip.Close(); err != nil || !slices.Equal(released, []int{9, 11}) {
+		t.Fatalf("close %v %v", released, err)
+	}
+
+	wait := New[int, int](1, increment, Options{MaxBuffered: 2, MaxGap: 2, Policy: Wait})
+	add(t, wait, 2)
+	if released, err := wait.Timeout(); err != nil || len(released) != 0 {
+		t.Fatalf("wait %v %v", released, err)
+	}
+	if _, err := wait.Close(); !errors.Is(err, ErrGap) {
+		t.Fatalf("close %v", err)
+	}
+
+	fail := New[int, int](1, increment, Options{MaxBuffered: 2, MaxGap: 2, Policy: Fail})
+	add(t, fail, 2)
+	if _, err := fail.Timeout(); !errors.Is(err, ErrGap) {
+		t.Fatalf("fail %v", err)
+	}
+}
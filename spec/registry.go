@@ -0,0 +1,227 @@
+package spec
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	v3 "example.com/m/v2/v3"
+)
+
+// Type names the elements flowing between stages so connections can be checked before a pipeline is built.
+type Type string
+
+const (
+	// No input or output, for sources and sinks.
+	TypeNone Type = ""
+	// Accepts any input.
+	TypeAny Type = "any"
+	// Outputs the same type as the input.
+	TypeSame Type = "same"
+	// A string, e.g. a line.
+	TypeString Type = "string"
+	// A decoded JSON value, map[string]any, []any, string, float64, bool or nil.
+	TypeJSON Type = "json"
+	// A []any.
+	TypeBatch Type = "batch"
+)
+
+// Return the type name, "none" for TypeNone.
+func (t Type) String() string {
+	if t == TypeNone {
+		return "none"
+	}
+	return string(t)
+}
+
+// Return true if an output of type out can be connected to an input of type in.
+func (in Type) Accepts(out Type) bool {
+	return in == TypeAny || in == out || (in == TypeJSON && out == TypeBatch)
+}
+
+// ParamKind is the type of a stage parameter.
+type ParamKind string
+
+const (
+	ParamString   ParamKind = "string"
+	ParamInt      ParamKind = "int"
+	ParamFloat    ParamKind = "float"
+	ParamBool     ParamKind = "bool"
+	ParamDuration ParamKind = "duration"
+)
+
+// Param describes a stage parameter.
+type Param struct {
+	Name     string
+	Kind     ParamKind
+	Required bool
+	// Used when the parameter is not given and is not required, nil for no default.
+	Default any
+}
+
+// Params are the checked parameters passed to a stage factory.
+type Params map[string]any
+
+// Return the string parameter, "" if not defined.
+func (params Params) String(name string) string {
+	s, _ := params[name].(string)
+	return s
+}
+
+func (params Params) Int(name string) int {
+	i, _ := params[name].(int)
+	return i
+}
+
+func (params Params) Float(name string) float64 {
+	f, _ := params[name].(float64)
+	return f
+}
+
+func (params Params) Bool(name string) bool {
+	b, _ := params[name].(bool)
+	return b
+}
+
+func (params Params) Duration(name string) time.Duration {
+	d, _ := params[name].(time.Duration)
+	return d
+}
+
+// Return true if the parameter was given or has a default.
+func (params Params) Has(name string) bool {
+	_, ok := params[name]
+	return ok
+}
+
+// Env is the environment a pipeline is built in.
+type Env struct {
+	Pipeline v3.Pipeline
+	// Used by stages reading or writing "-".
+	Stdin  io.Reader
+	Stdout io.Writer
+}
+
+// Factory creates a stage.
+// Sources are passed a nil in, sinks return a Source[int] which outputs the count of elements consumed.
+type Factory struct {
+	Name   string
+	Help   string
+	In     Type
+	Out    Type
+	Params []Param
+	New    func(env Env, params Params, in v3.Source[any]) (v3.Source[any], error)
+}
+
+func (factory Factory) IsSource() bool {
+	return factory.In == TypeNone
+}
+
+func (factory Factory) IsSink() bool {
+	return factory.Out == TypeNone
+}
+
+// Check the given raw parameters, returning typed params with defaults applied.
+func (factory Factory) params(raw map[string]any) (Params, error) {
+	params := Params{}
+
+	known := map[string]Param{}
+	for _, param := range factory.Params {
+		known[param.Name] = param
+	}
+	for name := range raw {
+		if _, ok := known[name]; !ok {
+			return nil, fmt.Errorf("unknown parameter %q", name)
+		}
+	}
+
+	for _, param := range factory.Params {
+		v, ok := raw[param.Name]
+		if !ok {
+			if param.Required {
+				return nil, fmt.Errorf("missing required parameter %q", param.Name)
+			}
+			if param.Default != nil {
+				params[param.Name] = param.Default
+			}
+			continue
+		}
+
+		t, err := convertParam(param.Kind, v)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: %w", param.Name, err)
+		}
+		params[param.Name] = t
+	}
+
+	return params, nil
+}
+
+// Convert a decoded JSON value to the given kind.
+func convertParam(kind ParamKind, v any) (any, error) {
+	switch kind {
+	case ParamString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case ParamInt:
+		if f, ok := v.(float64); ok && f == float64(int(f)) {
+			return int(f), nil
+		}
+	case ParamFloat:
+		if f, ok := v.(float64); ok {
+			return f, nil
+		}
+	case ParamBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case ParamDuration:
+		if s, ok := v.(string); ok {
+			return time.ParseDuration(s)
+		}
+	default:
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+	return nil, fmt.Errorf("expected %s, got %v", kind, v)
+}
+
+// Registry holds the stage factories available to specs, by name.
+type Registry struct {
+	factories map[string]Factory
+}
+
+// Register the given factory, replacing any factory with the same name.
+func (registry *Registry) Register(factory Factory) {
+	registry.factories[factory.Name] = factory
+}
+
+func (registry *Registry) Lookup(name string) (Factory, bool) {
+	factory, ok := registry.factories[name]
+	return factory, ok
+}
+
+// Return the registered factories ordered by name.
+func (registry *Registry) Factories() []Factory {
+	factories := make([]Factory, 0, len(registry.factories))
+	for _, factory := range registry.factories {
+		factories = append(factories, factory)
+	}
+	sort.Slice(factories, func(i, j int) bool { return factories[i].Name < factories[j].Name })
+	return factories
+}
+
+// Return an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{map[string]Factory{}}
+}
+
+// Return a registry holding the built in stages.
+func DefaultRegistry() *Registry {
+	registry := NewRegistry()
+	for _, factory := range builtins() {
+		registry.Register(factory)
+	}
+	return registry
+}
@@ -0,0 +1,306 @@
+/*
+Spec builds v3 pipelines from declarative JSON specs, so a pipeline's shape can change without recompiling.
+
+A spec lists stages, each naming a stage type from a Registry, its parameters and the stage it takes its input from.
+
+	{
+		"name": "errors",
+		"stages": [
+			{"id": "read", "type": "lines", "params": {"path": "app.log"}},
+			{"id": "parse", "type": "json-decode", "input": "read"},
+			{"id": "errors", "type": "filter", "input": "parse", "params": {"field": "level", "equals": "error"}},
+			{"id": "write", "type": "jsonl-sink", "input": "errors"}
+		]
+	}
+
+Plan checks a spec against a registry, reporting every unknown stage type, bad parameter, type mismatch and unconnected output, before anything is started.
+*/
+package spec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	v3 "example.com/m/v2/v3"
+)
+
+// Spec describes a pipeline.
+type Spec struct {
+	Name   string      `json:"name"`
+	Stages []StageSpec `json:"stages"`
+}
+
+// StageSpec describes a stage and the stage its input is connected to.
+type StageSpec struct {
+	ID     string         `json:"id"`
+	Type   string         `json:"type"`
+	Input  string         `json:"input,omitempty"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// Read a spec from the given JSON, unknown fields are an error.
+func Load(r io.Reader) (*Spec, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	spec := &Spec{}
+	if err := decoder.Decode(spec); err != nil {
+		return nil, fmt.Errorf("spec: %w", err)
+	}
+	return spec, nil
+}
+
+// Read a spec from the given JSON file.
+func LoadFile(path string) (*Spec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+// StageError is a problem with a stage in a spec.
+type StageError struct {
+	ID  string
+	Err error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %q: %v", e.ID, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	ErrUnknownStage       = errors.New("unknown stage type")
+	ErrTypeMismatch       = errors.New("type mismatch")
+	ErrUnconnectedOutput  = errors.New("output is not connected")
+	ErrUnconnectedInput   = errors.New("input is not connected")
+	ErrInputAlreadyUsed   = errors.New("input is already connected to another stage")
+	ErrCycle              = errors.New("stages form a cycle")
+	ErrDuplicateStage     = errors.New("duplicate stage id")
+	ErrUnknownInput       = errors.New("unknown input stage")
+	ErrUnexpectedInput    = errors.New("source stage cannot have an input")
+	ErrNoStages           = errors.New("no stages")
+	ErrInvalidParameters  = errors.New("invalid parameters")
+	ErrMissingStageFields = errors.New("stage requires an id and a type")
+)
+
+// PlannedStage is a checked stage, ready to be built.
+type PlannedStage struct {
+	StageSpec
+	Factory Factory
+	Params  Params
+	// The resolved input and output types.
+	In  Type
+	Out Type
+}
+
+// Plan is a checked spec, with stages ordered so each stage follows its input.
+type Plan struct {
+	Name   string
+	Stages []*PlannedStage
+}
+
+// Check the spec against the given registry, returning a plan or every problem found.
+func (spec *Spec) Plan(registry *Registry) (*Plan, error) {
+	if len(spec.Stages) == 0 {
+		return nil, ErrNoStages
+	}
+
+	errs := []error{}
+	fail := func(id string, err error) {
+		errs = append(errs, &StageError{id, err})
+	}
+
+	stages := map[string]*PlannedStage{}
+	ordered := []*PlannedStage{}
+	for i, stageSpec := range spec.Stages {
+		if stageSpec.ID == "" || stageSpec.Type == "" {
+			fail(fmt.Sprintf("#%d", i), ErrMissingStageFields)
+			continue
+		}
+		if _, ok := stages[stageSpec.ID]; ok {
+			fail(stageSpec.ID, ErrDuplicateStage)
+			continue
+		}
+
+		factory, ok := registry.Lookup(stageSpec.Type)
+		if !ok {
+			fail(stageSpec.ID, fmt.Errorf("%w %q", ErrUnknownStage, stageSpec.Type))
+			continue
+		}
+
+		params, err := factory.params(stageSpec.Params)
+		if err != nil {
+			fail(stageSpec.ID, fmt.Errorf("%w: %w", ErrInvalidParameters, err))
+			continue
+		}
+
+		stage := &PlannedStage{stageSpec, factory, params, factory.In, factory.Out}
+		stages[stageSpec.ID] = stage
+		ordered = append(ordered, stage)
+	}
+
+	// Check the connections.
+	consumers := map[string]string{}
+	for _, stage := range ordered {
+		if stage.Factory.IsSource() {
+			if stage.Input != "" {
+				fail(stage.ID, ErrUnexpectedInput)
+			}
+			continue
+		}
+		if stage.Input == "" {
+			fail(stage.ID, ErrUnconnectedInput)
+			continue
+		}
+		if _, ok := stages[stage.Input]; !ok {
+			if !containsID(spec.Stages, stage.Input) {
+				fail(stage.ID, fmt.Errorf("%w %q", ErrUnknownInput, stage.Input))
+			}
+			continue
+		}
+		if consumer, ok := consumers[stage.Input]; ok {
+			fail(stage.ID, fmt.Errorf("%w %q: %q", ErrInputAlreadyUsed, stage.Input, consumer))
+			continue
+		}
+		consumers[stage.Input] = stage.ID
+	}
+
+	// Order the stages so each follows its input, resolving the types as we go.
+	plan := &Plan{spec.Name, []*PlannedStage{}}
+	done := map[string]bool{}
+	visiting := map[string]bool{}
+	var visit func(stage *PlannedStage) bool
+	visit = func(stage *PlannedStage) bool {
+		if done[stage.ID] {
+			return true
+		}
+		if visiting[stage.ID] {
+			fail(stage.ID, ErrCycle)
+			return false
+		}
+		visiting[stage.ID] = true
+		defer delete(visiting, stage.ID)
+
+		if input, ok := stages[stage.Input]; ok && !stage.Factory.IsSource() {
+			if !visit(input) {
+				return false
+			}
+			if input.Out == TypeNone {
+				fail(stage.ID, fmt.Errorf("%w: input %q is a sink", ErrTypeMismatch, input.ID))
+			} else if !stage.In.Accepts(input.Out) {
+				fail(stage.ID, fmt.Errorf("%w: %s input %q outputs %s", ErrTypeMismatch, stage.In, input.ID, input.Out))
+			}
+			if stage.Out == TypeSame {
+				stage.Out = input.Out
+			}
+		}
+
+		done[stage.ID] = true
+		plan.Stages = append(plan.Stages, stage)
+		return true
+	}
+	for _, stage := range ordered {
+		visit(stage)
+	}
+
+	for _, stage := range ordered {
+		if !stage.Factory.IsSink() {
+			if _, ok := consumers[stage.ID]; !ok {
+				fail(stage.ID, ErrUnconnectedOutput)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return plan, nil
+}
+
+// Check the spec against the given registry.
+func (spec *Spec) Validate(registry *Registry) error {
+	_, err := spec.Plan(registry)
+	return err
+}
+
+// Built is a running pipeline built from a plan.
+type Built struct {
+	Pipeline v3.Pipeline
+	// The sink counts by stage ID.
+	sinks map[string]v3.Source[any]
+}
+
+// Wait for every sink to finish, returning the count of elements each sink consumed and the pipeline error.
+func (built *Built) Wait() (map[string]int, error) {
+	counts := map[string]int{}
+	for id, sink := range built.sinks {
+		if count, ok := v3.WaitForTerminal(sink).Value.(int); ok {
+			counts[id] = count
+		}
+	}
+	return counts, built.Pipeline.Error()
+}
+
+// Build and start each stage of the plan in the given environment.
+// If a stage cannot be built the pipeline is closed with the error.
+func (plan *Plan) Build(env Env) (*Built, error) {
+	if env.Pipeline == nil {
+		env.Pipeline = v3.NewPipeline()
+	}
+	if env.Stdin == nil {
+		env.Stdin = os.Stdin
+	}
+	if env.Stdout == nil {
+		env.Stdout = os.Stdout
+	}
+
+	built := &Built{env.Pipeline, map[string]v3.Source[any]{}}
+
+	outs := map[string]v3.Source[any]{}
+	for _, stage := range plan.Stages {
+		out, err := stage.Factory.New(env, stage.Params, outs[stage.Input])
+		if err != nil {
+			return nil, env.Pipeline.CloseWithError(&StageError{stage.ID, err})
+		}
+		if stage.Factory.IsSink() {
+			built.sinks[stage.ID] = out
+		} else {
+			outs[stage.ID] = out
+		}
+	}
+
+	return built, nil
+}
+
+// Return the plan as text, one stage per line with its input, e.g. "parse json-decode <- read".
+func (plan *Plan) String() string {
+	b := strings.Builder{}
+	for _, stage := range plan.Stages {
+		fmt.Fprintf(&b, "%s %s", stage.ID, stage.Type)
+		if stage.Input != "" {
+			fmt.Fprintf(&b, " <- %s", stage.Input)
+		}
+		fmt.Fprintf(&b, " [%s -> %s]\n", stage.In, stage.Out)
+	}
+	return b.String()
+}
+
+func containsID(stages []StageSpec, id string) bool {
+	for _, stage := range stages {
+		if stage.ID == id {
+			return true
+		}
+	}
+	return false
+}
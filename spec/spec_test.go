@@ -0,0 +1,111 @@
+package spec
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const errorsSpec = `{
+	"name": "errors",
+	"stages": [
+		{"id": "read", "type": "lines"},
+		{"id": "parse", "type": "json-decode", "input": "read"},
+		{"id": "errors", "type": "filter", "input": "parse", "params": {"field": "level", "equals": "error"}},
+		{"id": "message", "type": "map", "input": "errors", "params": {"field": "msg"}},
+		{"id": "batch", "type": "batch", "input": "message", "params": {"size": 2}},
+		{"id": "write", "type": "jsonl-sink", "input": "batch"}
+	]
+}`
+
+func TestBuild(t *testing.T) {
+	spec, err := Load(strings.NewReader(errorsSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := spec.Plan(DefaultRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdin := strings.NewReader(`{"level":"info","msg":"a"}
+{"level":"error","msg":"b"}
+{"level":"error","msg":"c"}
+{"level":"error","msg":"d"}
+`)
+	stdout := &bytes.Buffer{}
+
+	built, err := plan.Build(Env{Stdin: stdin, Stdout: stdout})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := built.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["write"] != 2 {
+		t.Fatalf("counts [%v]", counts)
+	}
+	if stdout.String() != "[\"b\",\"c\"]\n[\"d\"]\n" {
+		t.Fatalf("stdout [%v]", stdout.String())
+	}
+}
+
+func TestBuildDecodeError(t *testing.T) {
+	spec, _ := Load(strings.NewReader(errorsSpec))
+	plan, _ := spec.Plan(DefaultRegistry())
+
+	built, _ := plan.Build(Env{Stdin: strings.NewReader("not json\n"), Stdout: &bytes.Buffer{}})
+
+	if _, err := built.Wait(); err == nil || !strings.Contains(err.Error(), "json-decode") {
+		t.Fatalf("error [%v]", err)
+	}
+}
+
+func TestPlanErrors(t *testing.T) {
+	spec, err := Load(strings.NewReader(`{
+		"stages": [
+			{"id": "read", "type": "lines"},
+			{"id": "unknown", "type": "nope", "input": "read"},
+			{"id": "mismatch", "type": "map", "input": "other", "params": {"field": "a"}},
+			{"id": "other", "type": "lines"},
+			{"id": "dangling", "type": "lines"},
+			{"id": "bad", "type": "batch", "input": "mismatch", "params": {"size": "ten"}}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = spec.Validate(DefaultRegistry())
+	for _, expected := range []error{ErrUnknownStage, ErrTypeMismatch, ErrUnconnectedOutput, ErrInvalidParameters} {
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected [%v] in [%v]", expected, err)
+		}
+	}
+	for _, expected := range []string{`stage "unknown": unknown stage type "nope"`, `stage "mismatch": type mismatch: json input "other" outputs string`, `stage "dangling": output is not connected`} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected [%v] in [%v]", expected, err)
+		}
+	}
+}
+
+func TestPlanCycle(t *testing.T) {
+	spec := &Spec{Stages: []StageSpec{
+		{ID: "a", Type: "limit", Input: "b", Params: map[string]any{"n": 1.0}},
+		{ID: "b", Type: "limit", Input: "a", Params: map[string]any{"n": 1.0}},
+	}}
+
+	if err := spec.Validate(DefaultRegistry()); !errors.Is(err, ErrCycle) {
+		t.Fatalf("error [%v]", err)
+	}
+}
+
+func TestLoadUnknownField(t *testing.T) {
+	if _, err := Load(strings.NewReader(`{"stages": [], "stagez": []}`)); err == nil {
+		t.Fatal("unknown field")
+	}
+}
@@ -0,0 +1,278 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	v3 "example.com/m/v2/v3"
+)
+
+// The built in stages.
+func builtins() []Factory {
+	return []Factory{
+		{
+			Name:   "lines",
+			Help:   "Read each line of a file, or stdin if the path is \"-\".",
+			In:     TypeNone,
+			Out:    TypeString,
+			Params: []Param{{"path", ParamString, false, "-"}},
+			New: func(env Env, params Params, _ v3.Source[any]) (v3.Source[any], error) {
+				r, err := openInput(env, params.String("path"))
+				if err != nil {
+					return nil, err
+				}
+				out := toAny[string](env, v3.NewLineSource(env.Pipeline, r))
+				closeOnControl(out, r)
+				return out, nil
+			},
+		},
+		{
+			Name: "json-decode",
+			Help: "Decode each string as JSON.",
+			In:   TypeString,
+			Out:  TypeJSON,
+			New: func(env Env, _ Params, in v3.Source[any]) (v3.Source[any], error) {
+				return mapper(env, in, func(t any) (any, bool, error) {
+					var v any
+					if err := json.Unmarshal([]byte(t.(string)), &v); err != nil {
+						return nil, false, fmt.Errorf("json-decode [%s]: %w", t, err)
+					}
+					return v, true, nil
+				}), nil
+			},
+		},
+		{
+			Name: "json-encode",
+			Help: "Encode each element as a JSON string.",
+			In:   TypeAny,
+			Out:  TypeString,
+			New: func(env Env, _ Params, in v3.Source[any]) (v3.Source[any], error) {
+				return mapper(env, in, func(t any) (any, bool, error) {
+					b, err := json.Marshal(t)
+					if err != nil {
+						return nil, false, err
+					}
+					return string(b), true, nil
+				}), nil
+			},
+		},
+		{
+			Name: "filter",
+			Help: "Keep elements whose value, or the value of a dotted JSON field, equals or contains a string, or is defined if neither is given.",
+			In:   TypeAny,
+			Out:  TypeSame,
+			Params: []Param{
+				{"field", ParamString, false, nil},
+				{"equals", ParamString, false, nil},
+				{"contains", ParamString, false, nil},
+				{"not", ParamBool, false, false},
+			},
+			New: func(env Env, params Params, in v3.Source[any]) (v3.Source[any], error) {
+				field := params.String("field")
+				return mapper(env, in, func(t any) (any, bool, error) {
+					v, ok := t, true
+					if field != "" {
+						v, ok = lookup(t, field)
+					}
+					permit := ok && v != nil
+					if permit && params.Has("equals") {
+						permit = fmt.Sprint(v) == params.String("equals")
+					}
+					if permit && params.Has("contains") {
+						permit = strings.Contains(fmt.Sprint(v), params.String("contains"))
+					}
+					return t, permit != params.Bool("not"), nil
+				}), nil
+			},
+		},
+		{
+			Name:   "map",
+			Help:   "Replace each JSON element with the value of a dotted field, dropping elements without the field.",
+			In:     TypeJSON,
+			Out:    TypeJSON,
+			Params: []Param{{"field", ParamString, true, nil}},
+			New: func(env Env, params Params, in v3.Source[any]) (v3.Source[any], error) {
+				field := params.String("field")
+				return mapper(env, in, func(t any) (any, bool, error) {
+					v, ok := lookup(t, field)
+					return v, ok, nil
+				}), nil
+			},
+		},
+		{
+			Name:   "limit",
+			Help:   "Pass at most n elements.",
+			In:     TypeAny,
+			Out:    TypeSame,
+			Params: []Param{{"n", ParamInt, true, nil}},
+			New: func(env Env, params Params, in v3.Source[any]) (v3.Source[any], error) {
+				if params.Int("n") < 0 {
+					return nil, fmt.Errorf("limit n %d < 0", params.Int("n"))
+				}
+				return limit(env, in, params.Int("n")), nil
+			},
+		},
+		{
+			Name:   "batch",
+			Help:   "Group elements into batches of size, the last batch may be smaller.",
+			In:     TypeAny,
+			Out:    TypeBatch,
+			Params: []Param{{"size", ParamInt, true, nil}},
+			New: func(env Env, params Params, in v3.Source[any]) (v3.Source[any], error) {
+				if params.Int("size") < 1 {
+					return nil, fmt.Errorf("batch size %d < 1", params.Int("size"))
+				}
+				return batch(env, in, params.Int("size")), nil
+			},
+		},
+		{
+			Name:   "jsonl-sink",
+			Help:   "Write each element as a line of JSON to a file, or stdout if the path is \"-\".",
+			In:     TypeAny,
+			Out:    TypeNone,
+			Params: []Param{{"path", ParamString, false, "-"}},
+			New: func(env Env, params Params, in v3.Source[any]) (v3.Source[any], error) {
+				w, err := openOutput(env, params.String("path"))
+				if err != nil {
+					return nil, err
+				}
+				encoder := json.NewEncoder(w)
+				out := toAny[int](env, v3.NewForEachTerminal(env.Pipeline, in, func(t any) error {
+					return encoder.Encode(t)
+				}))
+				closeOnControl(out, w)
+				return out, nil
+			},
+		},
+		{
+			Name:   "lines-sink",
+			Help:   "Write each element as a line of text to a file, or stdout if the path is \"-\".",
+			In:     TypeAny,
+			Out:    TypeNone,
+			Params: []Param{{"path", ParamString, false, "-"}},
+			New: func(env Env, params Params, in v3.Source[any]) (v3.Source[any], error) {
+				w, err := openOutput(env, params.String("path"))
+				if err != nil {
+					return nil, err
+				}
+				out := toAny[int](env, v3.NewForEachTerminal(env.Pipeline, in, func(t any) error {
+					_, err := fmt.Fprintln(w, t)
+					return err
+				}))
+				closeOnControl(out, w)
+				return out, nil
+			},
+		},
+	}
+}
+
+// Return the given source as a Source[any].
+func toAny[T any](env Env, in v3.Source[T]) v3.Source[any] {
+	return v3.NewMapperIntermediate(env.Pipeline, in, func(t T) (any, bool, error) { return t, true, nil })
+}
+
+// Return a mapper which closes the pipeline with any error returned by f.
+func mapper(env Env, in v3.Source[any], f func(any) (any, bool, error)) v3.Source[any] {
+	return v3.NewMapperIntermediate(env.Pipeline, in, func(t any) (any, bool, error) {
+		r, ok, err := f(t)
+		if err != nil {
+			return nil, false, env.Pipeline.CloseWithError(err)
+		}
+		return r, ok, nil
+	})
+}
+
+func limit(env Env, in v3.Source[any], n int) v3.Source[any] {
+	count := 0
+	return mapper(env, in, func(t any) (any, bool, error) {
+		count++
+		return t, count <= n, nil
+	})
+}
+
+func batch(env Env, in v3.Source[any], size int) v3.Source[any] {
+	out := v3.NewSource[any](env.Pipeline, 0)
+
+	go func() {
+		defer out.Close()
+
+		b := make([]any, 0, size)
+		send := func() bool {
+			select {
+			case out.Out() <- b:
+				b = make([]any, 0, size)
+				return true
+			case <-out.Control():
+				return false
+			case <-env.Pipeline.Control():
+				return false
+			}
+		}
+
+		for {
+			select {
+			case t, ok := <-in.Out():
+				if !ok {
+					if len(b) > 0 {
+						send()
+					}
+					return
+				}
+				b = append(b, t)
+				if len(b) == size && !send() {
+					return
+				}
+			case <-out.Control():
+				return
+			case <-env.Pipeline.Control():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Return the value of the given dotted field of a decoded JSON object.
+func lookup(t any, field string) (any, bool) {
+	v := t
+	for _, name := range strings.Split(field, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func openInput(env Env, path string) (io.Reader, error) {
+	if path == "-" {
+		return env.Stdin, nil
+	}
+	return os.Open(path)
+}
+
+func openOutput(env Env, path string) (io.Writer, error) {
+	if path == "-" {
+		return env.Stdout, nil
+	}
+	return os.Create(path)
+}
+
+// Close c, if it is a file, once the given source is closed.
+func closeOnControl(source v3.Source[any], c any) {
+	f, ok := c.(*os.File)
+	if !ok || f == os.Stdin || f == os.Stdout {
+		return
+	}
+	go func() {
+		<-source.Control()
+		f.Close()
+	}()
+}
@@ -1,27 +1,22 @@
-package main
+package stream
 
 import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"os"
 	"sync"
 
+	"example.com/m/v2/logging"
 	"github.com/google/uuid"
 	"golang.org/x/exp/constraints"
 )
 
 // We use slog for logging, https://betterstack.com/community/guides/logging/logging-in-go/#getting-started-with-slog
 
-var logger slog.Logger
+var logger *slog.Logger
 
 func init() {
-	handlerOptions := &slog.HandlerOptions{
-		// AddSource: true,
-		Level: slog.LevelDebug,
-	}
-
-	logger = *slog.New(slog.NewTextHandler(os.Stdout, handlerOptions))
+	logger = logging.NewDefault()
 }
 
 // Optional
@@ -386,12 +381,13 @@ func NewPeek[T any](stream Stream, source Source[T], consumer func(T) error) *pe
 	}
 }
 
+// Return a new peek intermediate which logs each T with the stream's logger.
 func NewPeekToStdOut[T any](stream Stream, source Source[T]) *peekIntermediate[T] {
 	return NewPeek(
 		stream,
 		source,
 		func(t T) error {
-			fmt.Printf("%v\n", t)
+			stream.Logger().Info("peek", slog.Any("t", t))
 			return nil
 		},
 	)
@@ -458,7 +454,7 @@ func (terminal *terminal[T, R]) Result() chan optional[R] {
 func (terminal *terminal[T, R]) SendResult(result optional[R]) error {
 	select {
 	case terminal.result <- result:
-		fmt.Printf("terminal send result [%v]\n", result)
+		terminal.logger.Debug("sent result", slog.Any("result", result))
 	case <-terminal.control.Control():
 		return errors.New("Terminal control closed")
 	case <-terminal.stream.Control():
@@ -571,9 +567,10 @@ func NewIgnoreResultTerminal[T any](stream Stream, in Source[T], consumer func(T
 	return &forEach[T, struct{}]{*newTerminal[T, struct{}](stream, in, finally), consumer}
 }
 
+// Return a new for each terminal which logs each T with the stream's logger.
 func NewConsumeToStdOut[T any](stream Stream, in Source[T]) *forEach[T, struct{}] {
 	consumer := func(t T) error {
-		fmt.Printf("%v\n", t)
+		stream.Logger().Info("consumed", slog.Any("t", t))
 		return nil
 	}
 
@@ -584,13 +581,12 @@ func NewCount[T any](stream Stream, in Source[T]) *forEach[T, int] {
 	count := 0
 	consumer := func(_ T) error {
 		count++
-		fmt.Printf("consumer count %v\n", count)
 		return nil
 	}
 
 	var forEach *forEach[T, int]
 	finally := func() error {
-		fmt.Printf("Count finally %v\n", count)
+		forEach.logger.Debug("counted", slog.Int("Count", count))
 		return forEach.SendResult(NewOptional(count))
 	}
 	forEach = NewForEach[T, int](stream, in, consumer, finally)
@@ -1,20 +1,17 @@
 package stream
 
-import (
-	"fmt"
-)
+import "log/slog"
 
 func NewCount[T any](stream Stream, in Source[T]) *forEach[T, int] {
 	count := 0
 	consumer := func(_ T) error {
 		count++
-		fmt.Printf("consumer count %v\n", count)
 		return nil
 	}
 
 	var forEach *forEach[T, int]
 	finally := func() error {
-		fmt.Printf("Count finally %v\n", count)
+		forEach.logger.Debug("finally", slog.Int("count", count))
 		return forEach.SendResult(NewOptional(count))
 	}
 	forEach = NewForEach[T, int](stream, in, consumer, finally)
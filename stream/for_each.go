@@ -3,6 +3,7 @@ package stream
 import (
 	"log/slog"
 
+	"example.com/m/v2/logging"
 	"github.com/google/uuid"
 )
 
@@ -14,10 +15,8 @@ type forEach[T, R any] struct {
 func (forEach *forEach[T, R]) Start() error {
 	go func() {
 		logger := forEach.logger.With(
-			slog.Group(
-				"ForEach",
-				slog.String("UUID", uuid.New().String()),
-			),
+			slog.String(logging.StageKey, "ForEach"),
+			slog.String(logging.StageIDKey, uuid.New().String()),
 		)
 
 		defer func() {
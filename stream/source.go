@@ -4,6 +4,7 @@ import (
 	"log/slog"
 	"sync"
 
+	"example.com/m/v2/logging"
 	"github.com/google/uuid"
 )
 
@@ -54,10 +55,8 @@ func newSource[T any](stream Stream) source[T] {
 		stream,
 		newControl(),
 		stream.Logger().With(
-			slog.Group(
-				"Source",
-				slog.String("UUID", uuid.New().String()),
-			),
+			slog.String(logging.StageKey, "Source"),
+			slog.String(logging.StageIDKey, uuid.New().String()),
 		),
 		make(chan T),
 		&sync.Once{},
@@ -2,20 +2,15 @@ package stream
 
 import (
 	"log/slog"
-	"os"
 
+	"example.com/m/v2/logging"
 	"github.com/google/uuid"
 )
 
-var logger slog.Logger
+var logger *slog.Logger
 
 func init() {
-	handlerOptions := &slog.HandlerOptions{
-		AddSource: true,
-		Level:     slog.LevelDebug,
-	}
-
-	logger = *slog.New(slog.NewTextHandler(os.Stdout, handlerOptions))
+	logger = logging.NewDefault()
 }
 
 type Stream interface {
@@ -32,14 +27,22 @@ func (stream *stream) Logger() *slog.Logger {
 	return stream.logger
 }
 
-func NewStream() *stream {
-	return &stream{
-		newControl(),
-		logger.With(
-			slog.Group(
-				"Stream",
-				slog.String("UUID", uuid.New().String()),
-			),
-		),
+// StreamOption configures a stream created by NewStream.
+type StreamOption func(*stream)
+
+// Use the given logger for the stream, its sources and terminals, rather than the package logger.
+func WithLogger(logger *slog.Logger) StreamOption {
+	return func(stream *stream) {
+		stream.logger = logger
 	}
 }
+
+func NewStream(options ...StreamOption) *stream {
+	stream := &stream{newControl(), logger}
+	for _, option := range options {
+		option(stream)
+	}
+	stream.logger = stream.logger.With(slog.String(logging.PipelineKey, uuid.New().String()))
+
+	return stream
+}
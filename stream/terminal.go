@@ -2,10 +2,10 @@ package stream
 
 import (
 	"errors"
-	"fmt"
 	"log/slog"
 	"sync"
 
+	"example.com/m/v2/logging"
 	"github.com/google/uuid"
 )
 
@@ -59,7 +59,7 @@ func (terminal *terminal[T, R]) Result() chan optional[R] {
 func (terminal *terminal[T, R]) SendResult(result optional[R]) error {
 	select {
 	case terminal.result <- result:
-		fmt.Printf("terminal send result [%v]\n", result)
+		terminal.logger.Debug("sent result", slog.Any("result", result))
 	case <-terminal.control.Control():
 		return errors.New("Terminal control closed")
 	case <-terminal.stream.Control():
@@ -73,10 +73,8 @@ func newTerminal[T, R any](stream Stream, source Source[T], finally TerminalFina
 		stream,
 		newControl(),
 		stream.Logger().With(
-			slog.Group(
-				"Terminal",
-				slog.String("UUID", uuid.New().String()),
-			),
+			slog.String(logging.StageKey, "Terminal"),
+			slog.String(logging.StageIDKey, uuid.New().String()),
 		),
 		source,
 		finally,
@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// MemoryExporter keeps every span in memory, for tests.
+type MemoryExporter struct {
+	lock  *sync.Mutex
+	spans []Span
+}
+
+func (exporter *MemoryExporter) Export(span Span) error {
+	exporter.lock.Lock()
+	defer exporter.lock.Unlock()
+
+	exporter.spans = append(exporter.spans, span)
+	return nil
+}
+
+func (exporter *MemoryExporter) Close() error {
+	return nil
+}
+
+// Return a copy of the spans exported so far.
+func (exporter *MemoryExporter) Spans() []Span {
+	exporter.lock.Lock()
+	defer exporter.lock.Unlock()
+
+	return append([]Span{}, exporter.spans...)
+}
+
+// Return the spans exported so far for the given trace.
+func (exporter *MemoryExporter) Trace(traceID string) []Span {
+	spans := []Span{}
+	for _, span := range exporter.Spans() {
+		if span.TraceID == traceID {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{&sync.Mutex{}, []Span{}}
+}
+
+// JSONLinesExporter writes each span as a line of JSON.
+type JSONLinesExporter struct {
+	lock    *sync.Mutex
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	closer  io.Closer
+}
+
+func (exporter *JSONLinesExporter) Export(span Span) error {
+	exporter.lock.Lock()
+	defer exporter.lock.Unlock()
+
+	return exporter.encoder.Encode(span)
+}
+
+// Flush any buffered spans and close the underlying writer if it is an io.Closer.
+func (exporter *JSONLinesExporter) Close() error {
+	exporter.lock.Lock()
+	defer exporter.lock.Unlock()
+
+	if err := exporter.writer.Flush(); err != nil {
+		return err
+	}
+	if exporter.closer != nil {
+		return exporter.closer.Close()
+	}
+	return nil
+}
+
+// Return an exporter writing to the given writer.
+func NewJSONLinesExporter(w io.Writer) *JSONLinesExporter {
+	writer := bufio.NewWriter(w)
+	closer, _ := w.(io.Closer)
+	return &JSONLinesExporter{&sync.Mutex{}, writer, json.NewEncoder(writer), closer}
+}
+
+// Return an exporter appending to the given file, which is created if needed.
+func NewJSONLinesFileExporter(path string) (*JSONLinesExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLinesExporter(f), nil
+}
@@ -0,0 +1,276 @@
+/*
+Tracing provides optional per element tracing.
+
+Each element is wrapped in a Traced[T] carrying its trace context, the wrappers in this package adapt the user function of a stage to record a span for each call.
+A span is recorded for every stage the element passes through and a root span for the element as a whole, which ends when the element is consumed, filtered or fails.
+
+	traced := Start(tracer, t)
+	mapper := Map(tracer, "Mapper", f)
+	consumer := Consumer(tracer, "Sink", c)
+	worker := Worker(tracer, "Worker", w)
+
+Spans are only recorded for elements the tracer's sampler selects, so tracing can be left on with a low sample ratio.
+*/
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+const (
+	OutcomeOK       = "ok"
+	OutcomeError    = "error"
+	OutcomeFiltered = "filtered"
+)
+
+// Span records the time an element spent in a stage and the outcome.
+type Span struct {
+	TraceID  string        `json:"trace_id"`
+	SpanID   string        `json:"span_id"`
+	ParentID string        `json:"parent_id,omitempty"`
+	Name     string        `json:"name"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration"`
+	Outcome  string        `json:"outcome"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Context is the trace context carried by an element, it identifies the element's root span.
+type Context struct {
+	TraceID string
+	SpanID  string
+	Sampled bool
+	Start   time.Time
+}
+
+// Traced wraps an element with its trace context.
+type Traced[T any] struct {
+	Context Context
+	Value   T
+}
+
+// Sampler decides if an element is traced.
+type Sampler func() bool
+
+func AlwaysSample() bool {
+	return true
+}
+
+func NeverSample() bool {
+	return false
+}
+
+// Return a sampler which traces the given ratio of elements, between 0 and 1.
+func RatioSampler(ratio float64) Sampler {
+	return func() bool {
+		return rand.Float64() < ratio
+	}
+}
+
+// SpanExporter receives each recorded span, it must be safe for concurrent use.
+type SpanExporter interface {
+	Export(span Span) error
+	Close() error
+}
+
+// Tracer records spans for sampled elements and passes them to an exporter.
+type Tracer struct {
+	sampler  Sampler
+	exporter SpanExporter
+	// The first export error.
+	err     error
+	errLock *sync.Mutex
+}
+
+// Return the first error returned by the exporter, otherwise nil.
+func (tracer *Tracer) Error() error {
+	tracer.errLock.Lock()
+	defer tracer.errLock.Unlock()
+
+	return tracer.err
+}
+
+// Close the exporter, returning the first export error if there was one.
+func (tracer *Tracer) Close() error {
+	if err := tracer.exporter.Close(); err != nil {
+		return err
+	}
+	return tracer.Error()
+}
+
+func (tracer *Tracer) export(span Span) {
+	if err := tracer.exporter.Export(span); err != nil {
+		tracer.errLock.Lock()
+		if tracer.err == nil {
+			tracer.err = err
+		}
+		tracer.errLock.Unlock()
+	}
+}
+
+// Record a span for the given context, started at start and ending now.
+func (tracer *Tracer) record(context Context, spanID string, parentID string, name string, start time.Time, err error, outcome string) {
+	if !context.Sampled {
+		return
+	}
+
+	end := time.Now()
+	span := Span{
+		TraceID:  context.TraceID,
+		SpanID:   spanID,
+		ParentID: parentID,
+		Name:     name,
+		Start:    start,
+		End:      end,
+		Duration: end.Sub(start),
+		Outcome:  outcome,
+	}
+	if err != nil {
+		span.Outcome = OutcomeError
+		span.Error = err.Error()
+	}
+	tracer.export(span)
+}
+
+// Record a child span of the given context.
+func (tracer *Tracer) span(context Context, name string, start time.Time, err error, outcome string) {
+	if !context.Sampled {
+		return
+	}
+	tracer.record(context, newSpanID(), context.SpanID, name, start, err, outcome)
+}
+
+// End the root span of the given context.
+func (tracer *Tracer) end(context Context, err error, outcome string) {
+	tracer.record(context, context.SpanID, "", "element", context.Start, err, outcome)
+}
+
+// Return a new tracer using the given sampler and exporter, a nil sampler samples every element.
+func NewTracer(sampler Sampler, exporter SpanExporter) *Tracer {
+	if sampler == nil {
+		sampler = AlwaysSample
+	}
+	return &Tracer{sampler, exporter, nil, &sync.Mutex{}}
+}
+
+// Start a trace for the given element.
+func Start[T any](tracer *Tracer, t T) Traced[T] {
+	context := Context{Sampled: tracer.sampler(), Start: time.Now()}
+	if context.Sampled {
+		context.TraceID = newTraceID()
+		context.SpanID = newSpanID()
+	}
+	return Traced[T]{context, t}
+}
+
+// End the trace for the given element, use when an element leaves a pipeline without passing through a wrapped consumer.
+func End[T any](tracer *Tracer, t Traced[T], err error) {
+	tracer.end(t.Context, err, OutcomeOK)
+}
+
+// Wrap a mapper so a span is recorded for each call, the trace context is carried to R.
+// An error ends the element's trace.
+func Map[T, R any](tracer *Tracer, name string, f func(T) (R, error)) func(Traced[T]) (Traced[R], error) {
+	return func(t Traced[T]) (Traced[R], error) {
+		start := time.Now()
+		r, err := f(t.Value)
+		tracer.span(t.Context, name, start, err, OutcomeOK)
+		if err != nil {
+			tracer.end(t.Context, err, OutcomeError)
+		}
+		return Traced[R]{t.Context, r}, err
+	}
+}
+
+// Wrap a mapper which may drop T, returning false, so a span is recorded for each call.
+// A dropped T or an error ends the element's trace.
+func MapOK[T, R any](tracer *Tracer, name string, f func(T) (R, bool, error)) func(Traced[T]) (Traced[R], bool, error) {
+	return func(t Traced[T]) (Traced[R], bool, error) {
+		start := time.Now()
+		r, ok, err := f(t.Value)
+		outcome := OutcomeOK
+		if !ok {
+			outcome = OutcomeFiltered
+		}
+		tracer.span(t.Context, name, start, err, outcome)
+		if err != nil || !ok {
+			tracer.end(t.Context, err, outcome)
+		}
+		return Traced[R]{t.Context, r}, ok, err
+	}
+}
+
+// Wrap a predicate so a span is recorded for each call.
+// A T which is not permitted or an error ends the element's trace.
+func Filter[T any](tracer *Tracer, name string, predicate func(T) (bool, error)) func(Traced[T]) (bool, error) {
+	return func(t Traced[T]) (bool, error) {
+		start := time.Now()
+		permit, err := predicate(t.Value)
+		outcome := OutcomeOK
+		if !permit {
+			outcome = OutcomeFiltered
+		}
+		tracer.span(t.Context, name, start, err, outcome)
+		if err != nil || !permit {
+			tracer.end(t.Context, err, outcome)
+		}
+		return permit, err
+	}
+}
+
+// Wrap a peek consumer, which passes T on, so a span is recorded for each call.
+// An error ends the element's trace.
+func Peek[T any](tracer *Tracer, name string, consumer func(T) error) func(Traced[T]) error {
+	return func(t Traced[T]) error {
+		start := time.Now()
+		err := consumer(t.Value)
+		tracer.span(t.Context, name, start, err, OutcomeOK)
+		if err != nil {
+			tracer.end(t.Context, err, OutcomeError)
+		}
+		return err
+	}
+}
+
+// Wrap a sink consumer so a span is recorded for each call, ending the element's trace, use Worker for a worker.
+func Consumer[T any](tracer *Tracer, name string, consumer func(T) error) func(Traced[T]) error {
+	return func(t Traced[T]) error {
+		start := time.Now()
+		err := consumer(t.Value)
+		tracer.span(t.Context, name, start, err, OutcomeOK)
+		tracer.end(t.Context, err, OutcomeOK)
+		return err
+	}
+}
+
+// Wrap a worker consumer, e.g. of the pipeline package's WorkerGroup, so a span is recorded for each call, ending the element's trace.
+// P is the pipeline passed to the worker.
+func Worker[P, T any](tracer *Tracer, name string, worker func(P, T) error) func(P, Traced[T]) error {
+	return func(p P, t Traced[T]) error {
+		start := time.Now()
+		err := worker(p, t.Value)
+		tracer.span(t.Context, name, start, err, OutcomeOK)
+		tracer.end(t.Context, err, OutcomeOK)
+		return err
+	}
+}
+
+// Wrap a worker consumer taking a context, e.g. of WorkerGroupContext, like Worker.
+func WorkerContext[P, T any](tracer *Tracer, name string, worker func(context.Context, P, T) error) func(context.Context, P, Traced[T]) error {
+	return func(ctx context.Context, p P, t Traced[T]) error {
+		return Worker(tracer, name, func(p P, t T) error { return worker(ctx, p, t) })(p, t)
+	}
+}
+
+func newTraceID() string {
+	return fmt.Sprintf("%016x%016x", rand.Uint64(), rand.Uint64())
+}
+
+func newSpanID() string {
+	return fmt.Sprintf("%016x", rand.Uint64())
+}
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	exporter := NewMemoryExporter()
+	tracer := NewTracer(nil, exporter)
+
+	double := Map(tracer, "double", func(i int) (int, error) { return i * 2, nil })
+	even := Filter(tracer, "even", func(i int) (bool, error) { return i%4 == 0, nil })
+	sink := Consumer(tracer, "sink", func(i int) error {
+		if i == 8 {
+			return errors.New("eight")
+		}
+		return nil
+	})
+
+	traces := []string{}
+	for i := 1; i <= 4; i++ {
+		traced, _ := double(Start(tracer, i))
+		traces = append(traces, traced.Context.TraceID)
+		if permit, _ := even(traced); permit {
+			sink(traced)
+		}
+	}
+
+	// 1 and 3 are filtered.
+	for _, i := range []int{0, 2} {
+		spans := exporter.Trace(traces[i])
+		if len(spans) != 3 || spans[1].Outcome != OutcomeFiltered || spans[2].Name != "element" || spans[2].Outcome != OutcomeFiltered {
+			t.Fatalf("spans [%+v]", spans)
+		}
+	}
+
+	// 2 is consumed.
+	spans := exporter.Trace(traces[1])
+	if len(spans) != 4 || spans[2].Name != "sink" || spans[3].Outcome != OutcomeOK || spans[0].ParentID != spans[3].SpanID {
+		t.Fatalf("spans [%+v]", spans)
+	}
+
+	// 4 fails in the sink.
+	spans = exporter.Trace(traces[3])
+	if len(spans) != 4 || spans[2].Outcome != OutcomeError || spans[3].Error != "eight" {
+		t.Fatalf("spans [%+v]", spans)
+	}
+}
+
+func TestWorker(t *testing.T) {
+	exporter := NewMemoryExporter()
+	tracer := NewTracer(nil, exporter)
+
+	worker := Worker(tracer, "worker", func(p string, i int) error {
+		if i == 2 {
+			return errors.New(p)
+		}
+		return nil
+	})
+
+	for i := 1; i <= 2; i++ {
+		traced := Start(tracer, i)
+		worker("two", traced)
+
+		spans := exporter.Trace(traced.Context.TraceID)
+		if len(spans) != 2 || spans[0].Name != "worker" || spans[1].Name != "element" || (i == 2) != (spans[1].Error == "two") {
+			t.Fatalf("spans [%+v]", spans)
+		}
+	}
+}
+
+func TestNeverSample(t *testing.T) {
+	exporter := NewMemoryExporter()
+	tracer := NewTracer(NeverSample, exporter)
+
+	Consumer(tracer, "sink", func(i int) error { return nil })(Start(tracer, 1))
+
+	if len(exporter.Spans()) != 0 {
+		t.Fatalf("spans [%+v]", exporter.Spans())
+	}
+}
+
+func TestJSONLinesFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+
+	exporter, err := NewJSONLinesFileExporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := NewTracer(RatioSampler(1), exporter)
+
+	End(tracer, Start(tracer, 1), nil)
+	End(tracer, Start(tracer, 2), nil)
+
+	if err := tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		span := Span{}
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatal(err)
+		}
+		count++
+	}
+	if count != 2 {
+		t.Fatalf("count [%v]", count)
+	}
+}
@@ -0,0 +1,374 @@
+package v3
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Checkpointed wraps a T output by a resumable source.
+// Ack must be called once T has been fully processed, including when T is dropped by a filter, otherwise the committed offset cannot advance past it.
+type Checkpointed[T any] interface {
+	T() T
+	Offset() int64
+	Ack()
+}
+
+type checkpointed[T any] struct {
+	t       T
+	offset  int64
+	tracker *offsetTracker
+}
+
+func (checkpointed *checkpointed[T]) T() T {
+	return checkpointed.t
+}
+
+func (checkpointed *checkpointed[T]) Offset() int64 {
+	return checkpointed.offset
+}
+
+func (checkpointed *checkpointed[T]) Ack() {
+	checkpointed.tracker.ack(checkpointed.offset)
+}
+
+// Track the offsets in flight for a source.
+// The committed offset is the offset of the oldest unacknowledged T, so T's acknowledged out of order are not skipped on a restart.
+type offsetTracker struct {
+	lock *sync.Mutex
+	// Offsets output and not yet committed, in output order.
+	pending []int64
+	acked   map[int64]bool
+	// The offset following the last T output.
+	next int64
+}
+
+func (tracker *offsetTracker) output(offset int64, next int64) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	tracker.pending = append(tracker.pending, offset)
+	tracker.next = next
+}
+
+func (tracker *offsetTracker) ack(offset int64) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	tracker.acked[offset] = true
+	for len(tracker.pending) > 0 && tracker.acked[tracker.pending[0]] {
+		delete(tracker.acked, tracker.pending[0])
+		tracker.pending = tracker.pending[1:]
+	}
+}
+
+func (tracker *offsetTracker) committed() int64 {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	if len(tracker.pending) > 0 {
+		return tracker.pending[0]
+	}
+	return tracker.next
+}
+
+func (tracker *offsetTracker) inFlight() int {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	return len(tracker.pending)
+}
+
+func newOffsetTracker(offset int64) *offsetTracker {
+	return &offsetTracker{&sync.Mutex{}, []int64{}, map[int64]bool{}, offset}
+}
+
+// Checkpoint records the committed offset of named resumable sources in a file.
+// The file is written periodically once started and when closed, using a rename so a crash never leaves a partial file.
+type Checkpoint struct {
+	*control
+	path     string
+	lock     *sync.Mutex
+	offsets  map[string]int64
+	trackers map[string]*offsetTracker
+	logger   *slog.Logger
+	// Closed when the goroutine started by Start returns, nil if not started.
+	done chan struct{}
+}
+
+type checkpointFile struct {
+	Offsets map[string]int64 `json:"offsets"`
+}
+
+// Return the offset to resume the named source from, 0 if there is no checkpoint.
+func (checkpoint *Checkpoint) Offset(name string) int64 {
+	checkpoint.lock.Lock()
+	defer checkpoint.lock.Unlock()
+
+	return checkpoint.offsets[name]
+}
+
+// Return the number of T's output by the named source which have not been acknowledged.
+func (checkpoint *Checkpoint) InFlight(name string) int {
+	checkpoint.lock.Lock()
+	tracker, ok := checkpoint.trackers[name]
+	checkpoint.lock.Unlock()
+
+	if !ok {
+		return 0
+	}
+	return tracker.inFlight()
+}
+
+func (checkpoint *Checkpoint) track(name string) *offsetTracker {
+	checkpoint.lock.Lock()
+	defer checkpoint.lock.Unlock()
+
+	tracker := newOffsetTracker(checkpoint.offsets[name])
+	checkpoint.trackers[name] = tracker
+	return tracker
+}
+
+// Write the committed offsets to the checkpoint file.
+// The offsets are written to a temporary file in the same directory which is then renamed.
+func (checkpoint *Checkpoint) Save() error {
+	checkpoint.lock.Lock()
+	defer checkpoint.lock.Unlock()
+
+	for name, tracker := range checkpoint.trackers {
+		checkpoint.offsets[name] = tracker.committed()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(checkpoint.path), filepath.Base(checkpoint.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(checkpointFile{checkpoint.offsets}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), checkpoint.path); err != nil {
+		return err
+	}
+
+	checkpoint.logger.Debug("Saved", slog.Any("offsets", checkpoint.offsets))
+	return nil
+}
+
+// Save the checkpoint every interval until the checkpoint or the given pipeline is closed.
+// A failed save closes the pipeline with the error.
+func (checkpoint *Checkpoint) Start(pipeline Pipeline, interval time.Duration) {
+	checkpoint.done = make(chan struct{})
+
+	go func() {
+		defer close(checkpoint.done)
+
+		ticker := pipeline.Clock().NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C():
+				if err := checkpoint.Save(); err != nil {
+					pipeline.CloseWithError(err)
+					return
+				}
+			case <-checkpoint.Control():
+				return
+			case <-pipeline.Control():
+				return
+			}
+		}
+	}()
+}
+
+// Stop saving periodically and save the final committed offsets.
+// Call once the pipeline has completed or been closed.
+func (checkpoint *Checkpoint) Close() error {
+	checkpoint.control.Close()
+
+	if checkpoint.done != nil {
+		<-checkpoint.done
+	}
+
+	return checkpoint.Save()
+}
+
+// Return a checkpoint for the given file, loading the offsets if the file exists.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{
+		control:  NewControl(),
+		path:     path,
+		lock:     &sync.Mutex{},
+		offsets:  map[string]int64{},
+		trackers: map[string]*offsetTracker{},
+		logger:   Logger().WithGroup("Checkpoint").With(slog.String("path", path)),
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		checkpoint.logger.Debug("No checkpoint")
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	file := checkpointFile{}
+	if err := json.NewDecoder(f).Decode(&file); err != nil {
+		return nil, err
+	}
+	for name, offset := range file.Offsets {
+		checkpoint.offsets[name] = offset
+	}
+
+	checkpoint.logger.Debug("Loaded", slog.Any("offsets", checkpoint.offsets))
+	return checkpoint, nil
+}
+
+// Return a new resumable source which outputs the given []T from the named checkpoint offset, the offset is the index of T.
+func NewCheckpointSliceSource[T any](pipeline Pipeline, checkpoint *Checkpoint, name string, in []T, options ...SourceOption) Source[Checkpointed[T]] {
+	out := newSource[Checkpointed[T]](pipeline, options)
+
+	logger := NewSourceLogger(out, "CheckpointSliceSource").With(slog.String("name", name))
+
+	tracker := checkpoint.track(name)
+	from := checkpoint.Offset(name)
+
+	logger.Debug("Created", slog.Int("count", len(in)), slog.Int64("from", from))
+
+	go func() {
+		defer func() {
+			logger.Debug("Closing out")
+			out.Close()
+		}()
+
+		for i := from; i < int64(len(in)); i++ {
+			tracker.output(i, i+1)
+
+			select {
+			case out.Out() <- &checkpointed[T]{in[i], i, tracker}:
+			case <-out.Control():
+				return
+			case <-pipeline.Control():
+				return
+			case <-pipeline.Draining():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Return a new resumable source which outputs each line read from the given reader from the named checkpoint offset, the offset is the byte offset of the line.
+func NewCheckpointLineSource(pipeline Pipeline, checkpoint *Checkpoint, name string, in io.ReadSeeker, options ...SourceOption) Source[Checkpointed[string]] {
+	out := newSource[Checkpointed[string]](pipeline, options)
+
+	logger := NewSourceLogger(out, "CheckpointLineSource").With(slog.String("name", name))
+
+	tracker := checkpoint.track(name)
+	from := checkpoint.Offset(name)
+
+	logger.Debug("Created", slog.Int64("from", from))
+
+	go func() {
+		defer func() {
+			logger.Debug("Closing out")
+			out.Close()
+		}()
+
+		if _, err := in.Seek(from, io.SeekStart); err != nil {
+			pipeline.CloseWithError(err)
+			return
+		}
+
+		reader := bufio.NewReader(in)
+		offset := from
+		for {
+			line, err := reader.ReadString('\n')
+			if len(line) > 0 {
+				next := offset + int64(len(line))
+				tracker.output(offset, next)
+
+				select {
+				case out.Out() <- &checkpointed[string]{trimLineEnding(line), offset, tracker}:
+				case <-out.Control():
+					return
+				case <-pipeline.Control():
+					return
+				case <-pipeline.Draining():
+					return
+				}
+
+				offset = next
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				pipeline.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Return a new resumable source which outputs each line of the given file from the named checkpoint offset.
+func NewCheckpointFileSource(pipeline Pipeline, checkpoint *Checkpoint, name string, path string, options ...SourceOption) Source[Checkpointed[string]] {
+	f, err := os.Open(path)
+	if err != nil {
+		pipeline.CloseWithError(err)
+		out := newSource[Checkpointed[string]](pipeline, options)
+		out.Close()
+		return out
+	}
+
+	out := NewCheckpointLineSource(pipeline, checkpoint, name, f, options...)
+
+	go func() {
+		<-out.Control()
+		f.Close()
+	}()
+
+	return out
+}
+
+// Consume each in Checkpointed[T] using the given consumer, acknowledging T once consumed, returning a count >=0.
+func NewAckForEachTerminal[T any](pipeline Pipeline, in Source[Checkpointed[T]], consumer func(T) error, options ...SourceOption) Source[int] {
+	return NewForEachTerminal(pipeline, in, func(t Checkpointed[T]) error {
+		if err := consumer(t.T()); err != nil {
+			return err
+		}
+		t.Ack()
+		return nil
+	}, options...)
+}
+
+func trimLineEnding(line string) string {
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		line = line[:len(line)-1]
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+	}
+	return line
+}
@@ -0,0 +1,108 @@
+package v3
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOffsetTrackerOutOfOrder(t *testing.T) {
+	tracker := newOffsetTracker(0)
+
+	for i := int64(0); i < 4; i++ {
+		tracker.output(i, i+1)
+	}
+
+	tracker.ack(1)
+	tracker.ack(2)
+	if c := tracker.committed(); c != 0 {
+		t.Fatalf("committed [%v]", c)
+	}
+
+	tracker.ack(0)
+	if c := tracker.committed(); c != 3 {
+		t.Fatalf("committed [%v]", c)
+	}
+
+	tracker.ack(3)
+	if c := tracker.committed(); c != 4 {
+		t.Fatalf("committed [%v]", c)
+	}
+}
+
+func TestCheckpointSliceSourceResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	// Fail part way through, acknowledging 0 to 4.
+	checkpoint, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pipeline := NewPipeline()
+	source := NewCheckpointSliceSource(pipeline, checkpoint, "slice", slice09)
+	WaitForTerminal(NewAckForEachTerminal(pipeline, source, func(t int) error {
+		if t == 5 {
+			return pipeline.CloseWithError(errors.New("failed"))
+		}
+		return nil
+	}))
+	if err := checkpoint.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restart from 5.
+	checkpoint, err = LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset := checkpoint.Offset("slice"); offset != 5 {
+		t.Fatalf("offset [%v]", offset)
+	}
+
+	pipeline = NewPipeline()
+	result := []int{}
+	source = NewCheckpointSliceSource(pipeline, checkpoint, "slice", slice09)
+	WaitForTerminal(NewAckForEachTerminal(pipeline, source, func(t int) error { result = append(result, t); return nil }))
+	if err := checkpoint.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result) != 5 || result[0] != 5 {
+		t.Fatalf("result [%v]", result)
+	}
+	if checkpoint.InFlight("slice") != 0 {
+		t.Fatalf("in flight [%v]", checkpoint.InFlight("slice"))
+	}
+}
+
+func TestCheckpointFileSourceResume(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "checkpoint.json")
+	file := filepath.Join(dir, "lines.txt")
+	if err := os.WriteFile(file, []byte(strings.Join(ajSlice, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint, _ := LoadCheckpoint(path)
+	checkpoint.offsets["file"] = 6 // Start of "d".
+
+	pipeline := NewPipeline()
+	result := []string{}
+	source := NewCheckpointFileSource(pipeline, checkpoint, "file", file)
+	WaitForTerminal(NewAckForEachTerminal(pipeline, source, func(t string) error { result = append(result, t); return nil }))
+	if err := checkpoint.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(result, "") != "defghij" {
+		t.Fatalf("result [%v]", result)
+	}
+
+	checkpoint, _ = LoadCheckpoint(path)
+	if offset := checkpoint.Offset("file"); offset != 20 {
+		t.Fatalf("offset [%v]", offset)
+	}
+}
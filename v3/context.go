@@ -0,0 +1,38 @@
+package v3
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"example.com/m/v2/metrics"
+)
+
+// Call f for the given element with the pipeline's context, or a child context with the source's element timeout, recording the call in metrics.
+// If f panics the pipeline is closed with a PanicError, which is returned.
+// If f fails once the element timeout has passed the element is recorded as timed out rather than as an error, and false is returned with no error so the caller drops it.
+func (source *source[T]) call(metrics *metrics.Stage, element any, f func(ctx context.Context) error) (bool, error) {
+	ctx := source.pipeline.Context()
+	if source.elementTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, source.elementTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := protect(metrics.Name(), element, func() error { return f(ctx) })
+
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		metrics.Called(start, err)
+		source.pipeline.CloseWithError(err)
+		return true, err
+	}
+	if err != nil && source.elementTimeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) && source.pipeline.Context().Err() == nil {
+		metrics.Called(start, nil)
+		metrics.TimedOut()
+		return false, nil
+	}
+	metrics.Called(start, err)
+	return true, err
+}
@@ -4,16 +4,14 @@ import (
 	"fmt"
 	"log/slog"
 	"time"
-
-	"github.com/google/uuid"
 )
 
 // Return a new source T which will timeout if a T is not received within the given timeout.
 // The given timeout effects the time waiting to receive T on the in channel, it does not included any other time taken.
-func NewReceiveTimeout[T any](pipeline *pipeline, in Source[T], timeout time.Duration) *source[T] {
-	source := NewSource[T](pipeline, 0)
+func NewReceiveTimeout[T any](pipeline *pipeline, in Source[T], timeout time.Duration, options ...SourceOption) *source[T] {
+	source := newSource[T](pipeline, options)
 
-	logger := pipeline.Logger().With(slog.String("ReceiveTimeout", uuid.NewString()))
+	logger := NewSourceLogger[T](source, "ReceiveTimeout")
 
 	go func() {
 		defer func() {
@@ -24,8 +22,10 @@ func NewReceiveTimeout[T any](pipeline *pipeline, in Source[T], timeout time.Dur
 		count := 0
 
 		for true {
+			timer := pipeline.Clock().NewTimer(timeout)
 			select {
 			case t, ok := <-in.Out():
+				timer.Stop()
 				if !ok {
 					logger.Debug("in closed")
 					return
@@ -42,12 +42,14 @@ func NewReceiveTimeout[T any](pipeline *pipeline, in Source[T], timeout time.Dur
 				}
 
 				count++
-			case <-time.After(timeout):
+			case <-timer.C():
 				logger.Debug("timeout waiting to receive t from in")
 				return
 			case <-source.Control():
+				timer.Stop()
 				return
 			case <-pipeline.Control():
+				timer.Stop()
 				return
 			}
 		}
@@ -59,10 +61,10 @@ func NewReceiveTimeout[T any](pipeline *pipeline, in Source[T], timeout time.Dur
 
 // Return a new source T which will timeout if a T is not sent within the given timeout duration.
 // The given timeout effects the time waiting to send T on the out channel, it does not included any other time taken.
-func NewSendTimeout[T any](pipeline *pipeline, in Source[T], timeout time.Duration) *source[T] {
-	source := NewSource[T](pipeline, 0)
+func NewSendTimeout[T any](pipeline *pipeline, in Source[T], timeout time.Duration, options ...SourceOption) *source[T] {
+	source := newSource[T](pipeline, options)
 
-	logger := pipeline.Logger().With(slog.String("ReceiveTimeout", uuid.NewString()))
+	logger := NewSourceLogger[T](source, "SendTimeout")
 
 	go func() {
 		defer func() {
@@ -81,15 +83,19 @@ func NewSendTimeout[T any](pipeline *pipeline, in Source[T], timeout time.Durati
 				}
 				logger.Debug("received T from in", slog.Any("t", t))
 
+				timer := pipeline.Clock().NewTimer(timeout)
 				select {
 				case source.out <- t:
+					timer.Stop()
 					logger.Debug("sent to out")
-				case <-time.After(timeout):
+				case <-timer.C():
 					logger.Debug("timeout waiting to send T to out")
 					return
 				case <-source.Control():
+					timer.Stop()
 					return
 				case <-pipeline.Control():
+					timer.Stop()
 					return
 				}
 
@@ -107,16 +113,17 @@ func NewSendTimeout[T any](pipeline *pipeline, in Source[T], timeout time.Durati
 }
 
 // Return a new source T which will run for the given duration.
-func NewPeriodIntermediate[T any](pipeline *pipeline, in Source[T], timeout time.Duration) *source[T] {
-	source := NewSource[T](pipeline, 0)
+func NewPeriodIntermediate[T any](pipeline *pipeline, in Source[T], timeout time.Duration, options ...SourceOption) *source[T] {
+	source := newSource[T](pipeline, options)
 
-	logger := pipeline.Logger().With(slog.String("PeriodIntermediate", uuid.NewString()))
+	logger := NewSourceLogger[T](source, "PeriodIntermediate")
 
 	go func() {
-		period := time.After(timeout)
+		period := pipeline.Clock().NewTimer(timeout)
 		count := 0
 
 		defer func() {
+			period.Stop()
 			logger.Debug("closing source", slog.Int("count", count))
 			source.Close()
 		}()
@@ -133,7 +140,7 @@ func NewPeriodIntermediate[T any](pipeline *pipeline, in Source[T], timeout time
 				select {
 				case source.out <- t:
 					logger.Debug("sent T to out")
-				case <-period:
+				case <-period.C():
 					logger.Debug("timeout waiting to send T to out")
 					return
 				case <-source.Control():
@@ -143,7 +150,7 @@ func NewPeriodIntermediate[T any](pipeline *pipeline, in Source[T], timeout time
 				}
 
 				count++
-			case <-period:
+			case <-period.C():
 				logger.Debug("timeout waiting to receive T from in")
 				return
 			case <-source.Control():
@@ -0,0 +1,330 @@
+package v3
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Maximum length of a line read from a command's stdout or stderr.
+const ExecMaxLineBytes = 1 << 20
+
+// A started command.
+// The command is killed if the given controls are closed before it exits.
+type execProcess struct {
+	cmd    *exec.Cmd
+	logger *slog.Logger
+	// Closed once the process has exited and stderr has been drained.
+	exited chan struct{}
+	// Set if the process was killed because a control closed.
+	killed atomic.Bool
+	stderr *sync.WaitGroup
+}
+
+// Wait for the command to exit, returning an error if it failed.
+// A command killed because a control closed does not return an error.
+func (process *execProcess) Wait() error {
+	process.stderr.Wait()
+	err := process.cmd.Wait()
+	close(process.exited)
+
+	if process.killed.Load() {
+		process.logger.Debug("Killed")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("exec [%s]: %w", process.cmd, err)
+	}
+
+	process.logger.Debug("Exited")
+	return nil
+}
+
+// Start the given command, logging each stderr line to the given logger.
+// Stdin and stdout should be set up by the caller before calling.
+func startExec(cmd *exec.Cmd, logger *slog.Logger, controls ...Control) (*execProcess, error) {
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	process := &execProcess{cmd, logger.With(slog.String("cmd", cmd.String())), make(chan struct{}), atomic.Bool{}, &sync.WaitGroup{}}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("exec [%s]: %w", cmd, err)
+	}
+	process.logger.Debug("Started", slog.Int("pid", cmd.Process.Pid))
+
+	process.stderr.Add(1)
+	go func() {
+		defer process.stderr.Done()
+
+		scanner := bufio.NewScanner(stderr)
+		scanner.Buffer(nil, ExecMaxLineBytes)
+		for scanner.Scan() {
+			process.logger.Info("Stderr", slog.String("line", scanner.Text()))
+		}
+	}()
+
+	for _, control := range controls {
+		go func(control Control) {
+			select {
+			case <-control.Control():
+				process.killed.Store(true)
+				process.cmd.Process.Kill()
+			case <-process.exited:
+			}
+		}(control)
+	}
+
+	return process, nil
+}
+
+// Return a new source which runs the given command and outputs each line written to its stdout.
+// A non zero exit closes the pipeline with an error, the command is killed if the pipeline is closed first.
+func NewExecSource(pipeline Pipeline, cmd *exec.Cmd, options ...SourceOption) *source[string] {
+	out := newSource[string](pipeline, options)
+
+	logger := NewSourceLogger(out, "ExecSource")
+
+	go func() {
+		count := 0
+
+		defer func() {
+			logger.Debug("Closing out", slog.Int("count", count))
+			out.Close()
+		}()
+
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			pipeline.CloseWithError(err)
+			return
+		}
+
+		process, err := startExec(cmd, logger, out, pipeline)
+		if err != nil {
+			pipeline.CloseWithError(err)
+			return
+		}
+
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(nil, ExecMaxLineBytes)
+
+		// Stop scanning once a control closes, the command is killed.
+		scan := func() {
+			for scanner.Scan() {
+				select {
+				case out.Out() <- scanner.Text():
+					count++
+				case <-out.Control():
+					return
+				case <-pipeline.Control():
+					return
+				}
+			}
+		}
+
+		scan()
+
+		if err := process.Wait(); err != nil {
+			pipeline.CloseWithError(err)
+			return
+		}
+		if err := scanner.Err(); err != nil && !process.killed.Load() {
+			pipeline.CloseWithError(err)
+		}
+	}()
+
+	logger.Debug("Returning", slog.String("cmd", cmd.String()))
+	return out
+}
+
+// Return a new terminal which writes each in T as a line to the given command's stdin, returning a count.
+// Each T is formatted with the given function, if nil T is formatted using %v.
+// The command's stdin is closed when in is closed, a non zero exit closes the pipeline with an error.
+func NewExecSink[T any](pipeline Pipeline, in Source[T], cmd *exec.Cmd, format func(T) (string, error), options ...SourceOption) Source[int] {
+	if format == nil {
+		format = func(t T) (string, error) { return fmt.Sprintf("%v", t), nil }
+	}
+
+	out := newSource[int](pipeline, options)
+
+	logger := NewSourceLogger(out, "ExecSink")
+
+	go func() {
+		count := 0
+
+		defer func() {
+			logger.Debug("Sending count", slog.Int("count", count))
+
+			select {
+			case out.Out() <- count:
+			case <-out.Control():
+			case <-pipeline.Control():
+			}
+
+			out.Close()
+		}()
+
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			pipeline.CloseWithError(err)
+			return
+		}
+
+		process, err := startExec(cmd, logger, out, pipeline)
+		if err != nil {
+			pipeline.CloseWithError(err)
+			return
+		}
+
+		writer := bufio.NewWriter(stdin)
+
+		consume := func() error {
+			for {
+				select {
+				case t, ok := <-in.Out():
+					if !ok {
+						return writer.Flush()
+					}
+
+					var line string
+					err := protect("ExecSink", t, func() (err error) {
+						line, err = format(t)
+						return err
+					})
+					if err != nil {
+						return err
+					}
+					if _, err := writer.WriteString(line + "\n"); err != nil {
+						return err
+					}
+
+					count++
+				case <-out.Control():
+					return nil
+				case <-pipeline.Control():
+					return nil
+				}
+			}
+		}
+
+		err = consume()
+		stdin.Close()
+
+		if err := process.Wait(); err != nil {
+			pipeline.CloseWithError(err)
+			return
+		}
+		if err != nil && !process.killed.Load() {
+			pipeline.CloseWithError(err)
+		}
+	}()
+
+	return out
+}
+
+// Return a new intermediate which maps each in T to an R using a long lived co-process, Hadoop streaming style.
+// Each T is written to the command's stdin as a line of JSON and one line of JSON is read from its stdout as the R.
+// The command's stdin is closed when in is closed, a non zero exit or a missing response closes the pipeline with an error.
+func NewExecMapper[T, R any](pipeline Pipeline, in Source[T], cmd *exec.Cmd, options ...SourceOption) *source[R] {
+	out := newSource[R](pipeline, options)
+
+	logger := NewSourceLogger(out, "ExecMapper")
+
+	go func() {
+		count := 0
+
+		defer func() {
+			logger.Debug("Closing out", slog.Int("count", count))
+			out.Close()
+		}()
+
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			pipeline.CloseWithError(err)
+			return
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			pipeline.CloseWithError(err)
+			return
+		}
+
+		process, err := startExec(cmd, logger, out, pipeline)
+		if err != nil {
+			pipeline.CloseWithError(err)
+			return
+		}
+
+		encoder := json.NewEncoder(stdin)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(nil, ExecMaxLineBytes)
+
+		exchange := func(t T) (R, error) {
+			var r R
+			if err := encoder.Encode(t); err != nil {
+				return r, err
+			}
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return r, err
+				}
+				return r, io.ErrUnexpectedEOF
+			}
+			if err := json.Unmarshal([]byte(strings.TrimSpace(scanner.Text())), &r); err != nil {
+				return r, fmt.Errorf("exec [%s] response [%s]: %w", cmd, scanner.Text(), err)
+			}
+			return r, nil
+		}
+
+		consume := func() error {
+			for {
+				select {
+				case t, ok := <-in.Out():
+					if !ok {
+						return nil
+					}
+
+					r, err := exchange(t)
+					if err != nil {
+						return err
+					}
+
+					select {
+					case out.Out() <- r:
+						count++
+					case <-out.Control():
+						return nil
+					case <-pipeline.Control():
+						return nil
+					}
+				case <-out.Control():
+					return nil
+				case <-pipeline.Control():
+					return nil
+				}
+			}
+		}
+
+		// Close the pipeline on an error before draining, killing a command which would otherwise keep its stdout open.
+		if err := consume(); err != nil && !process.killed.Load() {
+			pipeline.CloseWithError(err)
+		}
+		stdin.Close()
+		// Drain any unexpected output so the command is not blocked writing.
+		io.Copy(io.Discard, stdout)
+
+		if err := process.Wait(); err != nil {
+			pipeline.CloseWithError(err)
+		}
+	}()
+
+	return out
+}
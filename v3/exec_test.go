@@ -0,0 +1,116 @@
+package v3
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecSource(t *testing.T) {
+	pipeline := NewPipeline()
+
+	source := NewExecSource(pipeline, exec.Command("sh", "-c", "printf 'a\\nb\\nc\\n'; echo warning >&2"))
+
+	result := []string{}
+	forEach := NewForEachTerminal(pipeline, source, func(t string) error { result = append(result, t); return nil })
+
+	if count := WaitForTerminal(forEach).Value; count != 3 {
+		t.Fatalf("count [%v]", count)
+	}
+	if len(result) != 3 || result[0] != "a" || result[2] != "c" {
+		t.Fatalf("result [%v]", result)
+	}
+	if err := pipeline.Error(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExecSourceExitCode(t *testing.T) {
+	pipeline := NewPipeline()
+
+	source := NewExecSource(pipeline, exec.Command("sh", "-c", "echo a; exit 3"))
+
+	WaitForTerminal(NewCountTerminal[string](pipeline, source))
+
+	exitError := &exec.ExitError{}
+	if !errors.As(pipeline.Error(), &exitError) || exitError.ExitCode() != 3 {
+		t.Fatalf("error [%v]", pipeline.Error())
+	}
+}
+
+func TestExecSourceKilled(t *testing.T) {
+	pipeline := NewPipeline()
+
+	source := NewExecSource(pipeline, exec.Command("sleep", "30"))
+
+	time.AfterFunc(100*time.Millisecond, func() { pipeline.Close() })
+
+	select {
+	case <-source.Control():
+	case <-time.After(5 * time.Second):
+		t.Fatal("command not killed")
+	}
+	if err := pipeline.Error(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExecSink(t *testing.T) {
+	pipeline := NewPipeline()
+
+	slice := NewSliceSource(pipeline, slice09)
+
+	sink := NewExecSink(pipeline, slice, exec.Command("sh", "-c", "test $(wc -l) -eq 10"), nil)
+
+	if count := WaitForTerminal(sink).Value; count != 10 {
+		t.Fatalf("count [%v]", count)
+	}
+	if err := pipeline.Error(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExecMapper(t *testing.T) {
+	pipeline := NewPipeline()
+
+	slice := NewSliceSource(pipeline, slice09)
+
+	// Echo each request as the response.
+	mapper := NewExecMapper[int, int](pipeline, slice, exec.Command("sh", "-c", "while read -r l; do echo \"$l\"; done"))
+
+	sum := 0
+	forEach := NewForEachTerminal[int](pipeline, mapper, func(t int) error { sum += t; return nil })
+
+	if count := WaitForTerminal(forEach).Value; count != 10 || sum != 45 {
+		t.Fatalf("count [%v] sum [%v]", count, sum)
+	}
+	if err := pipeline.Error(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExecMapperBadResponse(t *testing.T) {
+	pipeline := NewPipeline()
+
+	slice := NewSliceSource(pipeline, slice09)
+
+	// Answer the first request with a line which is not JSON, then hang without closing stdout.
+	mapper := NewExecMapper[int, int](pipeline, slice, exec.Command("sh", "-c", "read -r l; echo bad; exec sleep 30"))
+
+	done := make(chan struct{})
+	go func() {
+		WaitForTerminal(NewCountTerminal[int](pipeline, mapper))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("command not killed")
+	}
+	if err := pipeline.Error(); err == nil || !strings.Contains(err.Error(), "response [bad]") {
+		t.Fatalf("error [%v]", err)
+	}
+}
@@ -0,0 +1,230 @@
+package v3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrNilSource is the error NewFlatMapIntermediate closes the pipeline with when f returns a nil source without an error.
+var ErrNilSource = errors.New("nil inner source")
+
+// FlatMapMode is how NewFlatMapIntermediate consumes its inner sources.
+type FlatMapMode int
+
+const (
+	// Consume the inner sources one after another, in the order of their T's.
+	FlatMapConcat FlatMapMode = iota
+	// Consume up to the concurrency limit of inner sources at once, sending R's as they arrive.
+	FlatMapMerge
+	// Consume the latest inner source, cancelling the previous one when a new T arrives.
+	FlatMapSwitch
+)
+
+func (mode FlatMapMode) String() string {
+	switch mode {
+	case FlatMapConcat:
+		return "concat"
+	case FlatMapMerge:
+		return "merge"
+	case FlatMapSwitch:
+		return "switch"
+	}
+	return "unknown"
+}
+
+/*
+Return a new intermediate which maps each T to an inner source with f, and sends the R's of the inner sources as given by the mode.
+The concurrency limits the inner sources consumed at once with FlatMapMerge, 0 for no limit, the other modes consume one at a time.
+
+f should create the inner source in the given pipeline, which is closed when the inner source is cancelled, by FlatMapSwitch or when the pipeline is closed.
+An inner source created in another pipeline is drained once cancelled, until it closes.
+The inner sources are counted as open by the pipeline, so Shutdown waits for them to close.
+If f returns an error, or a nil source, the pipeline is closed with the error, wrapping ErrNilSource for a nil source.
+*/
+func NewFlatMapIntermediate[T, R any](pipeline Pipeline, in Source[T], f func(Pipeline, T) (Source[R], error), mode FlatMapMode, concurrency int, options ...SourceOption) *source[R] {
+	out := newSource[R](pipeline, options)
+
+	logger := NewSourceLogger(out, "FlatMapIntermediate")
+	metrics := NewSourceMetrics(out, "FlatMapIntermediate")
+
+	logger.Debug("Created", slog.Any("Source", in), slog.String("mode", mode.String()), slog.Int("concurrency", concurrency))
+
+	if mode != FlatMapMerge {
+		concurrency = 1
+	}
+
+	// Send the R's of the inner source until it closes or its pipeline is closed.
+	forward := func(inner *innerPipeline, source Source[R]) {
+		defer func() {
+			inner.Close()
+			metrics.Done()
+			// Unblock a source which does not watch its pipeline, without holding up the next inner source.
+			go func() {
+				for {
+					select {
+					case _, ok := <-source.Out():
+						if !ok {
+							return
+						}
+					case <-pipeline.Control():
+						return
+					}
+				}
+			}()
+		}()
+
+		for {
+			select {
+			case r, ok := <-source.Out():
+				if !ok {
+					return
+				}
+				start := time.Now()
+				select {
+				case out.Out() <- r:
+					metrics.Sent(start)
+				case <-inner.Control():
+					return
+				case <-out.Control():
+					return
+				}
+			case <-inner.Control():
+				return
+			case <-out.Control():
+				return
+			}
+		}
+	}
+
+	go func() {
+		wg := sync.WaitGroup{}
+		// A slot for each inner source consumed at once, nil for no limit.
+		var slots chan struct{}
+		if concurrency > 0 {
+			slots = make(chan struct{}, concurrency)
+		}
+		// The pipeline of the latest inner source, cancelled by the next with FlatMapSwitch.
+		var latest *innerPipeline
+
+		defer func() {
+			wg.Wait()
+			out.Close()
+		}()
+
+		for {
+			start := time.Now()
+			select {
+			case t, ok := <-in.Out():
+				if !ok {
+					logger.Debug("In out closed")
+					return
+				}
+				metrics.Received(start)
+
+				// The slot is free once the previous inner source has stopped, so none of its R's follow the next.
+				if mode == FlatMapSwitch && latest != nil {
+					latest.Close()
+				}
+				if slots != nil {
+					select {
+					case slots <- struct{}{}:
+					case <-out.Control():
+						metrics.Done()
+						return
+					case <-pipeline.Control():
+						metrics.Done()
+						return
+					}
+				}
+
+				inner := newInnerPipeline(pipeline)
+				var source Source[R]
+				_, err := out.call(metrics, t, func(_ context.Context) (err error) {
+					source, err = f(inner, t)
+					return err
+				})
+				if err == nil && source == nil {
+					err = ErrNilSource
+				}
+				if err != nil {
+					logger.Warn("Error mapping t", slog.Any("error", err), slog.Any("t", t))
+					inner.Close()
+					metrics.Done()
+					pipeline.CloseWithError(fmt.Errorf("FlatMap: %w", err))
+					return
+				}
+				latest = inner
+
+				wg.Add(1)
+				go func() {
+					defer func() {
+						if slots != nil {
+							<-slots
+						}
+						wg.Done()
+					}()
+					forward(inner, source)
+				}()
+			case <-out.Control():
+				return
+			case <-pipeline.Control():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// innerPipeline is the pipeline of an inner source of NewFlatMapIntermediate, closed when the inner source is cancelled or its parent is closed.
+// An error closes the parent, and the sources created in it are counted by the parent.
+type innerPipeline struct {
+	Pipeline
+	control *control
+	ctx     context.Context
+	cancel  context.CancelFunc
+	sources *openSources
+}
+
+func newInnerPipeline(parent Pipeline) *innerPipeline {
+	inner := &innerPipeline{Pipeline: parent, control: NewControl()}
+	inner.ctx, inner.cancel = context.WithCancel(parent.Context())
+	if counter, ok := parent.(sourceCounter); ok {
+		inner.sources = counter.openSources()
+	} else {
+		inner.sources = &openSources{&sync.Mutex{}, 0, make(chan struct{})}
+	}
+
+	go func() {
+		select {
+		case <-parent.Control():
+			inner.Close()
+		case <-inner.Control():
+		}
+	}()
+
+	return inner
+}
+
+func (inner *innerPipeline) Control() <-chan struct{} {
+	return inner.control.Control()
+}
+
+// Close the inner pipeline, cancelling its context, without closing its parent.
+func (inner *innerPipeline) Close() error {
+	inner.cancel()
+	return inner.control.Close()
+}
+
+func (inner *innerPipeline) Context() context.Context {
+	return inner.ctx
+}
+
+// Count the inner sources with the parent's, see Shutdown.
+func (inner *innerPipeline) openSources() *openSources {
+	return inner.sources
+}
@@ -0,0 +1,210 @@
+package v3
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Return a source in the pipeline which sends t until the pipeline is closed, then calls done.
+func repeat(pipeline Pipeline, t int, done func()) Source[int] {
+	source := NewSource[int](pipeline, 0)
+	go func() {
+		defer func() {
+			source.Close()
+			done()
+		}()
+		for {
+			select {
+			case source.Out() <- t:
+			case <-pipeline.Control():
+				return
+			}
+		}
+	}()
+	return source
+}
+
+func TestFlatMapConcat(t *testing.T) {
+	pipeline := NewPipeline()
+
+	pages := NewFlatMapIntermediate(pipeline, NewSliceSource(pipeline, slice0To3), func(inner Pipeline, t int) (Source[int], error) {
+		return NewSliceSource(inner, []int{t * 10, t*10 + 1}), nil
+	}, FlatMapConcat, 0)
+
+	received := []int{}
+	WaitForTerminal(NewForEachTerminal(pipeline, pages, func(t int) error {
+		received = append(received, t)
+		return nil
+	}))
+	if !slices.Equal(received, []int{0, 1, 10, 11, 20, 21, 30, 31}) {
+		t.Fatalf("received %v", received)
+	}
+}
+
+func TestFlatMapMerge(t *testing.T) {
+	pipeline := NewPipeline()
+
+	running := atomic.Int64{}
+	maxRunning := atomic.Int64{}
+
+	pages := NewFlatMapIntermediate(pipeline, NewSliceSource(pipeline, slice09), func(inner Pipeline, t int) (Source[int], error) {
+		source := NewSource[int](inner, 0)
+		go func() {
+			defer source.Close()
+			n := running.Add(1)
+			defer running.Add(-1)
+			for max := maxRunning.Load(); n > max && !maxRunning.CompareAndSwap(max, n); max = maxRunning.Load() {
+			}
+			for i := 0; i < 3; i++ {
+				time.Sleep(time.Millisecond)
+				source.Out() <- t
+			}
+		}()
+		return source, nil
+	}, FlatMapMerge, 2)
+
+	received := []int{}
+	WaitForTerminal(NewForEachTerminal(pipeline, pages, func(t int) error {
+		received = append(received, t)
+		return nil
+	}))
+	slices.Sort(received)
+	if len(received) != 30 || received[0] != 0 || received[29] != 9 || maxRunning.Load() > 2 {
+		t.Fatalf("received %v running %d", received, maxRunning.Load())
+	}
+}
+
+func TestFlatMapSwitch(t *testing.T) {
+	pipeline := NewPipeline()
+
+	closed := make(chan int, 2)
+	in := NewSource[int](pipeline, 0)
+	latest := NewFlatMapIntermediate(pipeline, in, func(inner Pipeline, t int) (Source[int], error) {
+		return repeat(inner, t, func() { closed <- t }), nil
+	}, FlatMapSwitch, 0)
+
+	in.Out() <- 1
+	if t1 := <-latest.Out(); t1 != 1 {
+		t.Fatalf("t [%v]", t1)
+	}
+
+	// The inner source of 1 is cancelled before the inner source of 2 is consumed.
+	in.Out() <- 2
+	if c := <-closed; c != 1 {
+		t.Fatalf("closed [%v]", c)
+	}
+	for t2 := <-latest.Out(); t2 != 2; t2 = <-latest.Out() {
+	}
+	for i := 0; i < 10; i++ {
+		if t2 := <-latest.Out(); t2 != 2 {
+			t.Fatalf("t [%v]", t2)
+		}
+	}
+
+	// Closing the pipeline cancels the inner source of 2.
+	pipeline.Close()
+	if c := <-closed; c != 2 {
+		t.Fatalf("closed [%v]", c)
+	}
+	in.Close()
+}
+
+func TestFlatMapClose(t *testing.T) {
+	pipeline := NewPipeline()
+
+	wg := sync.WaitGroup{}
+	wg.Add(4)
+	merged := NewFlatMapIntermediate(pipeline, NewSliceSource(pipeline, slice0To3), func(inner Pipeline, t int) (Source[int], error) {
+		return repeat(inner, t, wg.Done), nil
+	}, FlatMapMerge, 0)
+
+	// Every inner source is consumed at once.
+	seen := map[int]bool{}
+	for len(seen) < 4 {
+		seen[<-merged.Out()] = true
+	}
+
+	pipeline.Close()
+	wg.Wait()
+	for range merged.Out() {
+	}
+}
+
+func TestFlatMapError(t *testing.T) {
+	pipeline := NewPipeline()
+
+	errPage := errors.New("page")
+	pages := NewFlatMapIntermediate(pipeline, NewSliceSource(pipeline, slice09), func(inner Pipeline, t int) (Source[int], error) {
+		if t == 2 {
+			return nil, errPage
+		}
+		return NewSliceSource(inner, []int{t}), nil
+	}, FlatMapConcat, 0)
+
+	result := WaitForTerminal(NewForEachTerminal(pipeline, pages, func(t int) error { return nil }))
+	if result.Reason != ReasonFailed || !errors.Is(result.Err, errPage) || !strings.HasPrefix(result.Err.Error(), "FlatMap: ") {
+		t.Fatalf("result [%v]", result)
+	}
+}
+
+func TestFlatMapNilSource(t *testing.T) {
+	pipeline := NewPipeline()
+
+	pages := NewFlatMapIntermediate(pipeline, NewSliceSource(pipeline, slice09), func(inner Pipeline, t int) (Source[int], error) {
+		return nil, nil
+	}, FlatMapConcat, 0)
+
+	result := WaitForTerminal(NewForEachTerminal(pipeline, pages, func(t int) error { return nil }))
+	if result.Reason != ReasonFailed || !errors.Is(result.Err, ErrNilSource) {
+		t.Fatalf("result [%v]", result)
+	}
+}
+
+func TestFlatMapShutdown(t *testing.T) {
+	pipeline := NewPipeline()
+
+	// The first inner source ignores its pipeline, so it stays open once cancelled by the second.
+	release := make(chan struct{})
+	in := NewSource[int](pipeline, 0)
+	latest := NewFlatMapIntermediate(pipeline, in, func(inner Pipeline, t int) (Source[int], error) {
+		if t == 1 {
+			source := NewSource[int](inner, 0)
+			go func() {
+				<-release
+				source.Close()
+			}()
+			return source, nil
+		}
+		return NewSliceSource(inner, []int{t}), nil
+	}, FlatMapSwitch, 0)
+	forEach := NewForEachTerminal(pipeline, latest, func(t int) error { return nil })
+
+	in.Out() <- 1
+	in.Out() <- 2
+	in.Close()
+	if result := WaitForTerminal(forEach); result.Reason != ReasonCompleted || result.Value != 1 {
+		t.Fatalf("result [%v]", result)
+	}
+
+	// Shutdown waits for the cancelled inner source.
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- pipeline.Shutdown(context.Background())
+	}()
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown with an inner source open [%v]", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+}
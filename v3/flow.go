@@ -1,6 +1,13 @@
 package v3
 
-import "log/slog"
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"example.com/m/v2/clock"
+	"example.com/m/v2/resequence"
+)
 
 type Sequence[S, T any] interface {
 	S() S
@@ -12,7 +19,12 @@ type sequence[S, T any] struct {
 	t T
 }
 
-func (sequence *sequence[S, T]) S() S {
+// Return T with its sequence key s.
+func NewSequence[S, T any](s S, t T) Sequence[S, T] {
+	return sequence[S, T]{s, t}
+}
+
+func (sequence sequence[S, T]) S() S {
 	return sequence.s
 }
 
@@ -21,73 +33,122 @@ func (sequence sequence[S, T]) T() T {
 }
 
 // Return a new intermediate which wraps T in a sequence.
-func NewSequenceIntermediate[S, T any](pipeline Pipeline, in Source[T], s func(t T) (sequence[S, T], bool, error)) *source[sequence[S, T]] {
-	return NewMapperIntermediate[T, sequence[S, T]](pipeline, in, s)
+func NewSequenceIntermediate[S, T any](pipeline Pipeline, in Source[T], s func(t T) (Sequence[S, T], bool, error), options ...SourceOption) *source[Sequence[S, T]] {
+	return NewMapperIntermediate[T, Sequence[S, T]](pipeline, in, s, options...)
 }
 
-func NewIntSequenceAddIntermediate[T any](pipeline *pipeline, in Source[T]) *source[sequence[int, T]] {
+// Return a new intermediate which wraps each T in a sequence counting from 1.
+func NewIntSequenceAddIntermediate[T any](pipeline Pipeline, in Source[T], options ...SourceOption) *source[Sequence[int, T]] {
 	i := 0
 
-	f := func(t T) (sequence[int, T], bool, error) {
+	f := func(t T) (Sequence[int, T], bool, error) {
 		i++
-		return sequence[int, T]{i, t}, true, nil
+		return NewSequence(i, t), true, nil
 	}
 
-	return NewSequenceIntermediate(pipeline, in, f)
+	return NewSequenceIntermediate(pipeline, in, f, options...)
 }
 
-type node[S, T any] struct {
-	s        Sequence[S, T]
-	previous *node[S, T]
-	next     *node[S, T]
+// Return a new intermediate which unwraps the sequences added by NewIntSequenceAddIntermediate in order, with the default resequence options.
+func NewIntSequenceRemove[T any](pipeline Pipeline, in Source[Sequence[int, T]], options ...SourceOption) *source[T] {
+	return NewSequenceRemove(pipeline, in, 1, func(s int) int { return s + 1 }, resequence.DefaultOptions(), options...)
 }
 
-const (
-	LESS = iota
-	EQUAL
-	GREATER
-)
+/*
+Return a new intermediate which unwraps each sequence, sending the T's in the order of their keys, starting with from and following next.
 
-func NewSequenceRemove[S, T any](pipeline *pipeline, in Source[Sequence[S, T]], from S, c func(S, S) (bool, error)) *source[T] {
-	out := NewSource[T](pipeline, 0)
+Sequences arriving early are buffered, the buffer depth is reported as the source's reorder depth.
+A missing key is handled by the policy of opts once the buffer is full, the gap timeout passes on the pipeline's clock, or in closes:
+with Wait and Fail the pipeline is closed with resequence.ErrOverflow or resequence.ErrGap, except Wait keeps waiting on the timeout, and Skip skips the gap.
+*/
+func NewSequenceRemove[S comparable, T any](pipeline Pipeline, in Source[Sequence[S, T]], from S, next func(S) S, opts resequence.Options, options ...SourceOption) *source[T] {
+	out := newSource[T](pipeline, options)
 
-	var head *node[S, T]
+	logger := NewSourceLogger(out, "SequenceRemove")
+	metrics := NewSourceMetrics(out, "SequenceRemove")
 
-	// h	nil
-	// h	node->nil
-	// h	node->node->nil
-	go func() {
-		select {
-		case t, ok := <-in.Out():
-			if !ok {
-				return
-			}
+	r := resequence.New[S, T](from, next, opts)
 
-			if head == nil {
-				// No
-				head = &node[S, T]{t, nil, nil}
-			} else {
-				cN := head
+	go func() {
+		// The gap timer runs while a T is buffered, restarting on progress.
+		var timer clock.Timer
+		var timeout <-chan time.Time
 
-				for {
-					// func c will return true if <, false if >, and error is equal.
-					b, err := c(cN.s.S(), t.S())
-					if err != nil {
-						return
-					}
+		stopTimer := func() {
+			if timer != nil {
+				timer.Stop()
+			}
+			timer, timeout = nil, nil
+		}
+		startTimer := func() {
+			stopTimer()
+			if opts.GapTimeout > 0 {
+				timer = pipeline.Clock().NewTimer(opts.GapTimeout)
+				timeout = timer.C()
+			}
+		}
 
-					if b {
+		defer func() {
+			stopTimer()
+			logger.Debug("Resequenced", slog.String("stats", r.Stats().String()))
+			out.Close()
+		}()
 
-					} else {
-						cN = cN.next
-					}
+		// Send the T's ready, then update the gap timer.
+		send := func(ready []T, err error) bool {
+			defer metrics.Reorder(r.Len())
+			for _, t := range ready {
+				start := time.Now()
+				select {
+				case out.Out() <- t:
+					metrics.Sent(start)
+				case <-out.Control():
+					return false
+				case <-pipeline.Control():
+					return false
 				}
 			}
+			if err != nil {
+				pipeline.CloseWithError(fmt.Errorf("SequenceRemove: %w", err))
+				return false
+			}
+			switch {
+			case r.Len() == 0:
+				stopTimer()
+			case len(ready) > 0 || timer == nil:
+				startTimer()
+			}
+			return true
+		}
 
-		case <-in.Control():
-			return
-		case <-pipeline.Control():
-			return
+		for {
+			start := time.Now()
+			select {
+			case s, ok := <-in.Out():
+				if !ok {
+					send(r.Close())
+					return
+				}
+				metrics.Received(start)
+				sent := send(r.Add(s.S(), s.T()))
+				metrics.Done()
+				if !sent {
+					return
+				}
+			case <-timeout:
+				timer, timeout = nil, nil
+				ready, err := r.Timeout()
+				if err == nil && len(ready) == 0 {
+					logger.Warn("Waiting for missing key", slog.Any("key", r.Expected()), slog.Int("buffered", r.Len()), slog.Duration("waited", opts.GapTimeout))
+				}
+				if !send(ready, err) {
+					return
+				}
+			case <-out.Control():
+				return
+			case <-pipeline.Control():
+				return
+			}
 		}
 	}()
 
@@ -99,37 +160,7 @@ func NewNestedSource[T any](pipeline Pipeline, in ...Source[T]) Source[Source[T]
 	return NewSliceSource(pipeline, in)
 }
 
-func NewNestedIntermediate[T any](pipeline Pipeline, in Source[Source[T]]) Source[T] {
-	out := NewSource[T](pipeline, 0)
-
-	logger := NewSourceLogger(out, "NestedIntermediate")
-	logger.Debug("Created", slog.Any("out", out))
-
-	f := func(t Source[T]) error {
-		logger.Debug("Consuming nested source", slog.Any("Source[T]", t))
-
-		forEach := NewForEachTerminal(pipeline, t, func(t T) error {
-			select {
-			case out.Out() <- t:
-			case <-out.Control():
-			case <-pipeline.Control():
-			}
-			return nil
-		})
-
-		terminal := WaitForTerminal[int](forEach)
-
-		logger.Debug("Consumed nested source", slog.Any("Source[T]", t), slog.Any("Terminal", terminal))
-		return nil
-	}
-
-	go func() {
-		defer func() {
-			out.Close()
-		}()
-
-		logger.Debug("Completed nested intermediate", slog.Any("Terminal", WaitForTerminal(NewForEachTerminal(pipeline, in, f))))
-	}()
-
-	return out
+// Return a new intermediate which sends the T's of each nested source in turn, see NewFlatMapIntermediate.
+func NewNestedIntermediate[T any](pipeline Pipeline, in Source[Source[T]], options ...SourceOption) Source[T] {
+	return NewFlatMapIntermediate(pipeline, in, func(_ Pipeline, t Source[T]) (Source[T], error) { return t, nil }, FlatMapConcat, 1, options...)
 }
@@ -1,8 +1,11 @@
 package v3
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 )
 
 func TStdOutConsumer[T any](t T) error {
@@ -11,11 +14,19 @@ func TStdOutConsumer[T any](t T) error {
 }
 
 // Consume each in T using the given consumer function, returning a count >=0.
-func NewForEachTerminal[T any](pipeline Pipeline, in Source[T], consumer func(T) error) Source[int] {
+// If the consumer returns an error the pipeline is closed with it, see WaitForTerminal.
+func NewForEachTerminal[T any](pipeline Pipeline, in Source[T], consumer func(T) error, options ...SourceOption) Source[int] {
+	return NewForEachTerminalContext(pipeline, in, func(_ context.Context, t T) error { return consumer(t) }, options...)
+}
+
+// Consume each in T like NewForEachTerminal, calling the consumer with the pipeline's context, or a child context if given WithElementTimeout.
+// A T whose call timed out is not counted.
+func NewForEachTerminalContext[T any](pipeline Pipeline, in Source[T], consumer func(context.Context, T) error, options ...SourceOption) Source[int] {
 	// The returned out which returns a count.
-	out := NewSource[int](pipeline, 0)
+	out := newSource[int](pipeline, options)
 
 	logger := NewSourceLogger(out, "ForEachTerminal")
+	metrics := NewSourceMetrics(out, "ForEachTerminal")
 
 	logger.Debug("Created", slog.Any("Source", in), slog.Any("consumer", consumer))
 
@@ -39,6 +50,7 @@ func NewForEachTerminal[T any](pipeline Pipeline, in Source[T], consumer func(T)
 		}()
 
 		for {
+			start := time.Now()
 			select {
 			// Read a T.
 			case t, ok := <-in.Out():
@@ -47,12 +59,20 @@ func NewForEachTerminal[T any](pipeline Pipeline, in Source[T], consumer func(T)
 					return
 				}
 				logger.Debug("Received t", slog.Any("t", t))
+				metrics.Received(start)
 
 				// Call the consumer and check the returned error.
-				if err := consumer(t); err != nil {
+				called, err := out.call(metrics, t, func(ctx context.Context) error { return consumer(ctx, t) })
+				metrics.Done()
+				if err != nil {
 					logger.Warn("Error consuming t", slog.Any("error", err), slog.Any("t", t))
+					out.Pipeline().CloseWithError(err)
 					return
 				}
+				if !called {
+					logger.Warn("Timed out consuming t", slog.Any("t", t))
+					continue
+				}
 
 				// Update count.
 				count++
@@ -72,18 +92,18 @@ func NewForEachTerminal[T any](pipeline Pipeline, in Source[T], consumer func(T)
 }
 
 // Consume the in whilst discarding the T's and return a count, AKA >/dev/null
-func NewNullTerminal[T any](pipeline *pipeline, in Source[T]) Source[int] {
-	return NewForEachTerminal[T](pipeline, in, func(_ T) error { return nil })
+func NewNullTerminal[T any](pipeline *pipeline, in Source[T], options ...SourceOption) Source[int] {
+	return NewForEachTerminal[T](pipeline, in, func(_ T) error { return nil }, options...)
 }
 
-func NewCountTerminal[T any](pipeline *pipeline, in Source[T]) Source[int] {
-	return NewNullTerminal[T](pipeline, in)
+func NewCountTerminal[T any](pipeline *pipeline, in Source[T], options ...SourceOption) Source[int] {
+	return NewNullTerminal[T](pipeline, in, options...)
 }
 
-func NewExtrenumTerminal[T any](pipeline *pipeline, in Source[T], extrenum func(T, T) (T, bool, error)) Source[*optional[T]] {
+func NewExtrenumTerminal[T any](pipeline *pipeline, in Source[T], extrenum func(T, T) (T, bool, error), options ...SourceOption) Source[*optional[T]] {
 	count := 0
 	var r T
-	source := NewSource[*optional[T]](pipeline, 0)
+	source := newSource[*optional[T]](pipeline, options)
 
 	go func() {
 		defer func() {
@@ -116,8 +136,17 @@ func NewExtrenumTerminal[T any](pipeline *pipeline, in Source[T], extrenum func(
 					continue
 				}
 
-				e, changed, err := extrenum(r, t)
+				var e T
+				var changed bool
+				err := protect("ExtrenumTerminal", t, func() (err error) {
+					e, changed, err = extrenum(r, t)
+					return err
+				})
 				if err != nil {
+					var panicErr *PanicError
+					if errors.As(err, &panicErr) {
+						source.Pipeline().CloseWithError(err)
+					}
 					return
 				}
 
@@ -0,0 +1,216 @@
+package v3
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Default maximum size of a request body accepted by a HTTPSource.
+	DefaultHTTPSourceMaxBytes = 10 << 20
+	// Default time a HTTPSource will wait for the pipeline to accept an element before replying 429.
+	DefaultHTTPSourceAcceptTimeout = 5 * time.Second
+)
+
+// HTTPSource is a source which is fed by POST requests, see ServeHTTP.
+type HTTPSource[T any] interface {
+	Source[T]
+	http.Handler
+}
+
+type httpSource[T any] struct {
+	*source[T]
+	acceptTimeout time.Duration
+	maxBytes      int64
+	logger        *slog.Logger
+	// Held for read whilst a request is sending to out, held for write to close out.
+	sending sync.RWMutex
+	closing chan struct{}
+	closed  *sync.Once
+}
+
+// Stop accepting requests and close the source.
+// In flight requests are answered with 503 before out is closed.
+func (source *httpSource[T]) Close() error {
+	source.closed.Do(func() {
+		close(source.closing)
+
+		source.sending.Lock()
+		defer source.sending.Unlock()
+
+		source.source.Close()
+	})
+
+	return nil
+}
+
+// Decode the POSTed body into T's and send them to out.
+//
+// A body with Content-Type application/json is either a single T or an array of T.
+// A body with Content-Type application/x-ndjson (or application/jsonl) is a T per line.
+//
+// Replies 202 when every T has been accepted, 429 when the pipeline did not accept a T within the accept timeout and 503 when the source is closed.
+// The number of accepted T's is returned in the X-Accepted-Count header.
+func (source *httpSource[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ts, err := source.decode(w, r)
+	if err != nil {
+		source.logger.Debug("Error decoding body", slog.Any("error", err))
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if errors.Is(err, errUnsupportedMediaType) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	accepted, status := source.send(ts)
+
+	source.logger.Debug("Request", slog.Int("count", len(ts)), slog.Int("accepted", accepted), slog.Int("status", status))
+
+	w.Header().Set("X-Accepted-Count", strconv.Itoa(accepted))
+	switch status {
+	case http.StatusAccepted:
+		w.WriteHeader(status)
+	case http.StatusTooManyRequests:
+		w.Header().Set("Retry-After", strconv.Itoa(int(source.acceptTimeout.Seconds())+1))
+		http.Error(w, "pipeline is applying backpressure", status)
+	default:
+		http.Error(w, "pipeline is shutting down", status)
+	}
+}
+
+var errUnsupportedMediaType = errors.New("unsupported media type")
+
+func (source *httpSource[T]) decode(w http.ResponseWriter, r *http.Request) ([]T, error) {
+	mediaType := "application/json"
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		m, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, err
+		}
+		mediaType = m
+	}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, source.maxBytes))
+
+	switch mediaType {
+	case "application/json":
+		raw := json.RawMessage{}
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, err
+		}
+		if decoder.More() {
+			return nil, errors.New("unexpected data after JSON value")
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			ts := []T{}
+			if err := json.Unmarshal(raw, &ts); err != nil {
+				return nil, err
+			}
+			return ts, nil
+		}
+		var t T
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return nil, err
+		}
+		return []T{t}, nil
+	case "application/x-ndjson", "application/jsonl", "application/json-lines":
+		ts := []T{}
+		for {
+			var t T
+			err := decoder.Decode(&t)
+			if err == io.EOF {
+				return ts, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			ts = append(ts, t)
+		}
+	default:
+		return nil, fmt.Errorf("%w %s", errUnsupportedMediaType, mediaType)
+	}
+}
+
+// Send the given T's to out, returning the count sent and the HTTP status.
+func (source *httpSource[T]) send(ts []T) (int, int) {
+	source.sending.RLock()
+	defer source.sending.RUnlock()
+
+	// Check before sending as out may already be closed.
+	select {
+	case <-source.closing:
+		return 0, http.StatusServiceUnavailable
+	default:
+	}
+
+	timer := source.pipeline.Clock().NewTimer(source.acceptTimeout)
+	defer timer.Stop()
+
+	for i, t := range ts {
+		select {
+		case source.out <- t:
+		case <-timer.C():
+			return i, http.StatusTooManyRequests
+		case <-source.closing:
+			return i, http.StatusServiceUnavailable
+		case <-source.pipeline.Control():
+			return i, http.StatusServiceUnavailable
+		}
+	}
+
+	return len(ts), http.StatusAccepted
+}
+
+// Return a new HTTP source with the given out buffer size.
+// If the pipeline does not accept a T within the accept timeout the request is rejected with 429, a timeout <= 0 uses DefaultHTTPSourceAcceptTimeout.
+// The source is closed when Close is called, the pipeline control is closed or the pipeline is shut down.
+func NewHTTPSource[T any](pipeline Pipeline, size int, acceptTimeout time.Duration) *httpSource[T] {
+	if acceptTimeout <= 0 {
+		acceptTimeout = DefaultHTTPSourceAcceptTimeout
+	}
+
+	out := &httpSource[T]{
+		source:        NewSource[T](pipeline, size),
+		acceptTimeout: acceptTimeout,
+		maxBytes:      DefaultHTTPSourceMaxBytes,
+		closing:       make(chan struct{}),
+		closed:        &sync.Once{},
+	}
+	out.logger = NewSourceLogger[T](out, "HTTPSource")
+
+	go func() {
+		select {
+		case <-out.closing:
+		case <-pipeline.Control():
+			out.logger.Debug("Pipeline control closed")
+			out.Close()
+		case <-pipeline.Draining():
+			out.logger.Debug("Pipeline draining")
+			out.Close()
+		}
+	}()
+
+	out.logger.Debug("Created", slog.Duration("acceptTimeout", acceptTimeout))
+	return out
+}
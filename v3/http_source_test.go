@@ -0,0 +1,81 @@
+package v3
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type httpSourceEvent struct {
+	ID int `json:"id"`
+}
+
+func postHTTPSource(handler http.Handler, contentType string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	request.Header.Set("Content-Type", contentType)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	return response
+}
+
+func TestHTTPSourceAccepted(t *testing.T) {
+	pipeline := NewPipeline()
+	defer pipeline.Close()
+
+	source := NewHTTPSource[httpSourceEvent](pipeline, 10, time.Second)
+
+	if r := postHTTPSource(source, "application/json", `{"id":1}`); r.Code != http.StatusAccepted {
+		t.Fatalf("json object status [%v]", r.Code)
+	}
+	if r := postHTTPSource(source, "application/json", `[{"id":2},{"id":3}]`); r.Code != http.StatusAccepted {
+		t.Fatalf("json array status [%v]", r.Code)
+	}
+	if r := postHTTPSource(source, "application/x-ndjson", "{\"id\":4}\n{\"id\":5}\n"); r.Code != http.StatusAccepted || r.Header().Get("X-Accepted-Count") != "2" {
+		t.Fatalf("ndjson status [%v] accepted [%v]", r.Code, r.Header().Get("X-Accepted-Count"))
+	}
+
+	source.Close()
+
+	ids := []int{}
+	for e := range source.Out() {
+		ids = append(ids, e.ID)
+	}
+	if len(ids) != 5 {
+		t.Fatalf("ids [%v]", ids)
+	}
+	for i, id := range ids {
+		if id != i+1 {
+			t.Fatalf("ids [%v]", ids)
+		}
+	}
+}
+
+func TestHTTPSourceRejected(t *testing.T) {
+	pipeline := NewPipeline()
+	defer pipeline.Close()
+
+	source := NewHTTPSource[httpSourceEvent](pipeline, 0, 10*time.Millisecond)
+
+	if r := postHTTPSource(source, "application/json", `{"id":`); r.Code != http.StatusBadRequest {
+		t.Fatalf("bad body status [%v]", r.Code)
+	}
+	if r := postHTTPSource(source, "text/plain", `{"id":1}`); r.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("text status [%v]", r.Code)
+	}
+
+	// Nothing is receiving so the pipeline is applying backpressure.
+	if r := postHTTPSource(source, "application/json", `{"id":1}`); r.Code != http.StatusTooManyRequests {
+		t.Fatalf("backpressure status [%v]", r.Code)
+	}
+
+	pipeline.Close()
+	if _, ok := <-source.Out(); ok {
+		t.Fatal("out not closed")
+	}
+
+	if r := postHTTPSource(source, "application/json", `{"id":1}`); r.Code != http.StatusServiceUnavailable {
+		t.Fatalf("closed status [%v]", r.Code)
+	}
+}
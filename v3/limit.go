@@ -1,7 +1,11 @@
 package v3
 
-func NewLimit[T any](pipeline *pipeline, in Source[T], max int) *source[T] {
-	source := NewSource[T](pipeline, 0)
+import "time"
+
+func NewLimit[T any](pipeline *pipeline, in Source[T], max int, options ...SourceOption) *source[T] {
+	source := newSource[T](pipeline, options)
+
+	metrics := NewSourceMetrics(source, "Limit")
 
 	go func() {
 		defer func() {
@@ -11,14 +15,19 @@ func NewLimit[T any](pipeline *pipeline, in Source[T], max int) *source[T] {
 		count := 0
 
 		for count < max {
+			start := time.Now()
 			select {
 			case t, ok := <-in.Out():
 				if !ok {
 					return
 				}
+				metrics.Received(start)
 
+				start = time.Now()
 				select {
 				case source.out <- t:
+					metrics.Sent(start)
+					metrics.Done()
 				case <-source.Control():
 					return
 				case <-pipeline.Control():
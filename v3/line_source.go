@@ -0,0 +1,53 @@
+package v3
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Maximum length of a line read by a line source.
+const LineSourceMaxBytes = 1 << 20
+
+// Return a new source which outputs each line read from the given reader, without the line ending.
+// A read error closes the pipeline with the error.
+func NewLineSource(pipeline Pipeline, in io.Reader, options ...SourceOption) *source[string] {
+	out := newSource[string](pipeline, options)
+
+	logger := NewSourceLogger(out, "LineSource")
+	metrics := NewSourceMetrics(out, "LineSource")
+
+	go func() {
+		count := 0
+
+		defer func() {
+			logger.Debug("Closing out", slog.Int("count", count))
+			out.Close()
+		}()
+
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(nil, LineSourceMaxBytes)
+		for scanner.Scan() {
+			start := time.Now()
+			select {
+			case out.Out() <- scanner.Text():
+				metrics.Sent(start)
+				count++
+			case <-out.Control():
+				return
+			case <-pipeline.Control():
+				return
+			case <-pipeline.Draining():
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			metrics.Error()
+			pipeline.CloseWithError(err)
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,47 @@
+package v3
+
+import "testing"
+
+func TestPipelineMetrics(t *testing.T) {
+	pipeline := NewPipeline()
+
+	slice := NewSliceSource(pipeline, slice09)
+
+	mapper := NewMapperIntermediate(pipeline, slice, func(t int) (int, bool, error) { return t, t%2 == 0, nil })
+
+	WaitForTerminal(NewForEachTerminal(pipeline, mapper, func(_ int) error { return nil }))
+
+	stages := map[string][2]int64{}
+	for _, stage := range pipeline.Metrics().Snapshot() {
+		stages[stage.Name] = [2]int64{stage.In, stage.Out}
+		if stage.InFlight != 0 {
+			t.Fatalf("stage [%+v]", stage)
+		}
+	}
+
+	if stages["SliceSource"] != [2]int64{0, 10} || stages["MapperIntermediate"] != [2]int64{10, 5} || stages["ForEachTerminal"] != [2]int64{5, 0} {
+		t.Fatalf("stages [%v]", stages)
+	}
+}
+
+func TestPipelineBufferMetrics(t *testing.T) {
+	pipeline := NewPipeline(WithDefaultBufferSize(4))
+
+	slice := NewSliceSource(pipeline, slice09, WithBufferSize(8))
+
+	mapper := NewMapperIntermediate(pipeline, slice, func(t int) (int, bool, error) { return t, true, nil })
+
+	WaitForTerminal(NewForEachTerminal(pipeline, mapper, func(_ int) error { return nil }))
+
+	stages := map[string][2]int64{}
+	for _, stage := range pipeline.Metrics().Snapshot() {
+		stages[stage.Name] = [2]int64{stage.BufferSize, stage.Buffered}
+		if stage.MaxBuffered > stage.BufferSize {
+			t.Fatalf("stage [%+v]", stage)
+		}
+	}
+
+	if stages["SliceSource"] != [2]int64{8, 0} || stages["MapperIntermediate"] != [2]int64{4, 0} {
+		t.Fatalf("stages [%v]", stages)
+	}
+}
@@ -0,0 +1,38 @@
+package v3
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the error a stage closes the pipeline with when its function panics.
+type PanicError struct {
+	Stage string
+	// The value recovered from the panic.
+	Value any
+	// The element being processed, nil if none.
+	Element any
+	Stack   []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %s with element %v: %v\n%s", e.Stage, e.Element, e.Value, e.Stack)
+}
+
+// Return the recovered value if it is an error.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// Call f, returning a PanicError if it panics.
+func protect(stage string, element any, f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{stage, r, element, debug.Stack()}
+		}
+	}()
+	return f()
+}
@@ -1,41 +1,237 @@
 package v3
 
 import (
+	"context"
 	"log/slog"
-	"os"
+	"sync"
 
+	"example.com/m/v2/clock"
+	"example.com/m/v2/logging"
+	"example.com/m/v2/metrics"
 	"github.com/google/uuid"
 )
 
 type Pipeline interface {
 	Control
 	Logger() *slog.Logger
+	// Close the pipeline with the given error, returning the error.
+	CloseWithError(err error) error
+	// Return the first error the pipeline was closed with, otherwise nil.
+	Error() error
+	// Return the metrics registry each source in the pipeline reports to.
+	Metrics() *metrics.Registry
+	// Return the buffer size of a source created without WithBufferSize.
+	BufferSize() int
+	// Return a channel which is closed once Shutdown is called, sources stop producing when it is closed.
+	Draining() <-chan struct{}
+	// Stop the sources and wait for every source to be closed, or close the pipeline if ctx is done first.
+	Shutdown(ctx context.Context) error
+	// Return a context which is cancelled when the pipeline is closed, passed to the user functions of the Context constructors, e.g. NewMapperIntermediateContext.
+	Context() context.Context
+	// Return the clock of the time based sources, e.g. NewReceiveTimeout.
+	Clock() clock.Clock
 }
 
 type pipeline struct {
 	*control
-	logger *slog.Logger
+	ctx     context.Context
+	cancel  context.CancelFunc
+	logger  *slog.Logger
+	err     error
+	errLock *sync.Mutex
+	metrics *metrics.Registry
+	// The default source buffer size.
+	bufferSize int
+	draining   chan struct{}
+	drainOnce  *sync.Once
+	sources    *openSources
+	clock      clock.Clock
 }
 
 func (pipeline *pipeline) Logger() *slog.Logger {
 	return pipeline.logger
 }
 
-func NewPipeline() *pipeline {
-	return &pipeline{
-		NewControl(),
-		Logger().With(slog.String("Pipeline", uuid.NewString()))}
+// Close the pipeline recording the given error.
+// Only the first error is recorded, we return the error passed in to allow the function to be used in a return.
+//
+//	if err != nil {
+//		return pipeline.CloseWithError(err)
+//	}
+func (pipeline *pipeline) CloseWithError(err error) error {
+	pipeline.errLock.Lock()
+	if pipeline.err == nil {
+		pipeline.err = err
+	}
+	pipeline.errLock.Unlock()
+
+	pipeline.Close()
+
+	return err
+}
+
+// Close the pipeline, cancelling its context.
+func (pipeline *pipeline) Close() error {
+	pipeline.cancel()
+	return pipeline.control.Close()
+}
+
+func (pipeline *pipeline) Context() context.Context {
+	return pipeline.ctx
+}
+
+func (pipeline *pipeline) Clock() clock.Clock {
+	return pipeline.clock
+}
+
+func (pipeline *pipeline) Error() error {
+	pipeline.errLock.Lock()
+	defer pipeline.errLock.Unlock()
+
+	return pipeline.err
+}
+
+func (pipeline *pipeline) Metrics() *metrics.Registry {
+	return pipeline.metrics
+}
+
+func (pipeline *pipeline) BufferSize() int {
+	return pipeline.bufferSize
+}
+
+func (pipeline *pipeline) Draining() <-chan struct{} {
+	return pipeline.draining
+}
+
+/*
+Shutdown drains the pipeline rather than dropping the elements in flight, as Close does.
+
+The sources stop producing and close, each intermediate and terminal then closes once it has consumed its input, so every element already produced reaches the terminals.
+Shutdown returns nil once every source created in the pipeline has been closed.
+If ctx is done first the pipeline is closed, dropping the elements still in flight, and the context error is returned.
+
+A source which does not watch Draining, e.g. one created with NewSource, is only closed by ctx.
+*/
+func (pipeline *pipeline) Shutdown(ctx context.Context) error {
+	pipeline.drainOnce.Do(func() {
+		pipeline.logger.Debug("Draining")
+		close(pipeline.draining)
+	})
+
+	if err := pipeline.sources.wait(ctx); err != nil {
+		pipeline.logger.Debug("Drain incomplete", slog.Int("open", pipeline.sources.count()), slog.Any("error", err))
+		pipeline.Close()
+		return err
+	}
+
+	pipeline.logger.Debug("Drained")
+	return nil
+}
+
+// openSources counts the sources of a pipeline which have not been closed.
+type openSources struct {
+	lock *sync.Mutex
+	open int
+	// Closed and replaced each time open falls to 0.
+	closed chan struct{}
+}
+
+func (sources *openSources) add(delta int) {
+	sources.lock.Lock()
+	defer sources.lock.Unlock()
+
+	sources.open += delta
+	if sources.open == 0 {
+		close(sources.closed)
+		sources.closed = make(chan struct{})
+	}
+}
+
+func (sources *openSources) count() int {
+	sources.lock.Lock()
+	defer sources.lock.Unlock()
+
+	return sources.open
+}
+
+// Wait until every source is closed or ctx is done.
+func (sources *openSources) wait(ctx context.Context) error {
+	for {
+		sources.lock.Lock()
+		open, closed := sources.open, sources.closed
+		sources.lock.Unlock()
+
+		if open == 0 {
+			return nil
+		}
+
+		select {
+		case <-closed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// sourceCounter is implemented by a Pipeline which counts its open sources for Shutdown.
+type sourceCounter interface {
+	openSources() *openSources
+}
+
+func (pipeline *pipeline) openSources() *openSources {
+	return pipeline.sources
+}
+
+// PipelineOption configures a pipeline created by NewPipeline.
+type PipelineOption func(*pipeline)
+
+// Use the given logger for the pipeline and its sources, rather than the package logger.
+func WithLogger(logger *slog.Logger) PipelineOption {
+	return func(pipeline *pipeline) {
+		pipeline.logger = logger
+	}
+}
+
+// Buffer the output of each source by size, unless the source is given WithBufferSize.
+func WithDefaultBufferSize(size int) PipelineOption {
+	return func(pipeline *pipeline) {
+		pipeline.bufferSize = size
+	}
+}
+
+// Use the given clock for the time based sources, rather than the real clock, e.g. a clock.Fake in a test.
+func WithClock(c clock.Clock) PipelineOption {
+	return func(pipeline *pipeline) {
+		pipeline.clock = c
+	}
+}
+
+func NewPipeline(options ...PipelineOption) *pipeline {
+	id := uuid.NewString()
+
+	pipeline := &pipeline{
+		control:   NewControl(),
+		logger:    Logger(),
+		errLock:   &sync.Mutex{},
+		metrics:   metrics.NewRegistry(id),
+		draining:  make(chan struct{}),
+		drainOnce: &sync.Once{},
+		sources:   &openSources{&sync.Mutex{}, 0, make(chan struct{})},
+		clock:     clock.Real(),
+	}
+	pipeline.ctx, pipeline.cancel = context.WithCancel(context.Background())
+	for _, option := range options {
+		option(pipeline)
+	}
+	pipeline.logger = pipeline.logger.With(slog.String(logging.PipelineKey, id))
+
+	return pipeline
 }
 
 var logger *slog.Logger
 
 func init() {
-	logger = slog.New(
-		slog.NewTextHandler(
-			os.Stderr,
-			&slog.HandlerOptions{Level: slog.LevelDebug},
-		),
-	)
+	logger = logging.NewDefault()
 }
 
 func Logger() *slog.Logger {
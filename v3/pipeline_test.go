@@ -1,10 +1,14 @@
 package v3
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
 
+	"example.com/m/v2/clock"
+	"example.com/m/v2/resequence"
 	"golang.org/x/exp/rand"
 )
 
@@ -32,7 +36,7 @@ func TestPipeline(t *testing.T) {
 
 	forEach := NewForEachTerminal[int](pipeline, slice, consumer)
 
-	fmt.Printf("%v\n", *WaitForTerminal[int](forEach).Result()[0].Get())
+	fmt.Printf("%v\n", WaitForTerminal[int](forEach).Value)
 }
 
 func TestSupplier(t *testing.T) {
@@ -44,47 +48,80 @@ func TestSupplier(t *testing.T) {
 
 	forEach := NewForEachTerminal[int](pipeline, limit, func(t int) error { fmt.Printf("for each %v\n", t); return nil })
 
-	fmt.Printf("%v\n", *WaitForTerminal[int](forEach).Result()[0].Get())
+	fmt.Printf("%v\n", WaitForTerminal[int](forEach).Value)
 }
 
 func TestTimeout(t *testing.T) {
-	pipeline := NewPipeline()
-
-	f := func() (int, error) {
-		s := rand.Intn(5)
-		fmt.Printf("sleeping [%v]\n", s)
-		time.Sleep(time.Second * time.Duration(s))
-		return s, nil
+	fake := clock.NewFake(time.Unix(0, 0))
+	pipeline := NewPipeline(WithClock(fake))
+
+	in := NewSource[int](pipeline, 0)
+	timeout := NewReceiveTimeout(pipeline, in, 2*time.Second)
+
+	// A T received within the timeout of the last is sent.
+	in.Out() <- 1
+	<-timeout.Out()
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+	in.Out() <- 2
+	if t2 := <-timeout.Out(); t2 != 2 {
+		t.Fatalf("t [%d]", t2)
 	}
 
-	supplier := NewSupplierSource[int](pipeline, f)
-
-	// slice := NewSliceSource(pipeline, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	fake.BlockUntil(1)
+	fake.Advance(2 * time.Second)
+	if _, ok := <-timeout.Out(); ok {
+		t.Fatal("not timed out")
+	}
+	in.Close()
+}
 
-	limit := NewLimit[int](pipeline, supplier, 10)
+func TestSendTimeout(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	pipeline := NewPipeline(WithClock(fake))
 
-	timeout := NewReceiveTimeout(pipeline, limit, time.Duration(time.Second*2))
+	in := NewSource[int](pipeline, 0)
+	timeout := NewSendTimeout(pipeline, in, time.Minute)
 
-	forEach := NewForEachTerminal[int](pipeline, timeout, func(t int) error { fmt.Printf("for each %v\n", t); return nil })
+	in.Out() <- 1
+	fake.BlockUntil(1)
+	fake.Advance(30 * time.Second)
+	if t1 := <-timeout.Out(); t1 != 1 {
+		t.Fatalf("t [%d]", t1)
+	}
 
-	fmt.Printf("count %v\n", *(WaitForTerminal[int](forEach).Result()[0].Get()))
+	// Nothing receives 2, so the send times out.
+	in.Out() <- 2
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+	<-timeout.Control()
+	if _, ok := <-timeout.Out(); ok {
+		t.Fatal("not timed out")
+	}
+	in.Close()
 }
 
 func TestPeriodIntermediate(t *testing.T) {
-	pipeline := NewPipeline()
-
-	f := func() (int, error) {
-		s := rand.Intn(9)
-		return s, nil
+	fake := clock.NewFake(time.Unix(0, 0))
+	pipeline := NewPipeline(WithClock(fake))
+
+	in := NewSource[int](pipeline, 0)
+	period := NewPeriodIntermediate(pipeline, in, 10*time.Minute)
+
+	// Ten minutes pass in virtual time, a T every minute until the period ends.
+	received := []int{}
+	for i := 0; i < 10; i++ {
+		in.Out() <- i
+		received = append(received, <-period.Out())
+		fake.Advance(time.Minute)
 	}
-
-	supplier := NewSupplierSource[int](pipeline, f)
-
-	timeout := NewPeriodIntermediate(pipeline, supplier, time.Duration(time.Second*1))
-
-	forEach := NewCountTerminal(pipeline, timeout)
-
-	fmt.Printf("count %v\n", *(WaitForTerminal[int](forEach).Result()[0].Get()))
+	if _, ok := <-period.Out(); ok {
+		t.Fatal("period not over")
+	}
+	if len(received) != 10 || received[9] != 9 {
+		t.Fatalf("received %v", received)
+	}
+	in.Close()
 }
 
 func TestFlowSequenceIntermediate(t *testing.T) {
@@ -99,6 +136,67 @@ func TestFlowSequenceIntermediate(t *testing.T) {
 	fmt.Printf("terminal [%v]\n", WaitForTerminal[int](forEach))
 }
 
+func TestFlowSequenceRemove(t *testing.T) {
+	pipeline := NewPipeline()
+
+	sequences := []Sequence[int, string]{}
+	for _, i := range []int{2, 3, 5, 9, 1, 7, 4, 8, 6, 10} {
+		sequences = append(sequences, NewSequence(i, ajSlice[i-1]))
+	}
+	remove := NewIntSequenceRemove(pipeline, NewSliceSource(pipeline, sequences))
+
+	received := []string{}
+	WaitForTerminal(NewForEachTerminal(pipeline, remove, func(t string) error {
+		received = append(received, t)
+		return nil
+	}))
+	if fmt.Sprint(received) != fmt.Sprint(ajSlice) || pipeline.Error() != nil {
+		t.Fatalf("received %v %v", received, pipeline.Error())
+	}
+
+	for _, stage := range pipeline.Metrics().Snapshot() {
+		if stage.Name == "SequenceRemove" && (stage.MaxReorderDepth != 4 || stage.ReorderDepth != 0) {
+			t.Fatalf("stage [%+v]", stage)
+		}
+	}
+}
+
+func TestFlowSequenceRemoveGap(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	pipeline := NewPipeline(WithClock(fake))
+
+	opts := resequence.DefaultOptions()
+	opts.GapTimeout = time.Minute
+	opts.Policy = resequence.Skip
+
+	in := NewSource[Sequence[int, int]](pipeline, 0)
+	skip := NewSequenceRemove(pipeline, in, 1, func(s int) int { return s + 1 }, opts)
+
+	// 1 is missing, it is skipped once a minute has passed.
+	in.Out() <- NewSequence(2, 2)
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+	if t2 := <-skip.Out(); t2 != 2 {
+		t.Fatalf("t [%v]", t2)
+	}
+	in.Close()
+	if _, ok := <-skip.Out(); ok || pipeline.Error() != nil {
+		t.Fatalf("open %v %v", ok, pipeline.Error())
+	}
+
+	// Without skipping the gap closes the pipeline once in is closed.
+	pipeline = NewPipeline()
+	in = NewSource[Sequence[int, int]](pipeline, 0)
+	remove := NewIntSequenceRemove(pipeline, in)
+	in.Out() <- NewSequence(2, 2)
+	in.Close()
+	for range remove.Out() {
+	}
+	if !errors.Is(pipeline.Error(), resequence.ErrGap) {
+		t.Fatal(pipeline.Error())
+	}
+}
+
 func TestMapIntermediate(t *testing.T) {
 	pipeline := NewPipeline()
 
@@ -126,5 +224,129 @@ func TestNested(t *testing.T) {
 
 	forEach := NewForEachTerminal[int](pipeline, nested, stdOutConsumer)
 
-	fmt.Printf("%v\n", *WaitForTerminal[int](forEach).Result()[0].Get())
+	fmt.Printf("%v\n", WaitForTerminal[int](forEach).Value)
+}
+
+func TestShutdown(t *testing.T) {
+	pipeline := NewPipeline()
+
+	i := 0
+	supplier := NewSupplierSource(pipeline, func() (int, error) { i++; return i, nil })
+
+	mapper := NewMapperIntermediate(pipeline, supplier, func(t int) (int, bool, error) { return t, true, nil }, WithBufferSize(4))
+
+	consumed := 0
+	forEach := NewForEachTerminal(pipeline, mapper, func(t int) error {
+		consumed++
+		if consumed == 10 {
+			go pipeline.Shutdown(context.Background())
+		}
+		return nil
+	})
+
+	terminal := WaitForTerminal(forEach)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := pipeline.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := terminal.Value; count != i || count < 10 {
+		t.Fatalf("consumed %d of %d", count, i)
+	}
+	select {
+	case <-pipeline.Control():
+		t.Fatal("closed")
+	default:
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	pipeline := NewPipeline()
+
+	slice := NewSliceSource(pipeline, slice09)
+
+	release := make(chan struct{})
+	forEach := NewForEachTerminal(pipeline, slice, func(t int) error {
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := pipeline.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err [%v]", err)
+	}
+
+	<-pipeline.Control()
+	close(release)
+	WaitForTerminal(forEach)
+}
+
+func TestMapperContext(t *testing.T) {
+	pipeline := NewPipeline()
+
+	slice := NewSliceSource(pipeline, slice09)
+
+	// Odd elements block until their call times out.
+	mapper := NewMapperIntermediateContext(pipeline, slice, func(ctx context.Context, t int) (int, bool, error) {
+		if t%2 == 1 {
+			<-ctx.Done()
+			return 0, false, ctx.Err()
+		}
+		return t, true, nil
+	}, WithElementTimeout(time.Millisecond))
+
+	forEach := NewForEachTerminalContext(pipeline, mapper, func(ctx context.Context, t int) error {
+		return ctx.Err()
+	})
+
+	if count := WaitForTerminal(forEach).Value; count != 5 {
+		t.Fatalf("count [%d]", count)
+	}
+
+	for _, stage := range pipeline.Metrics().Snapshot() {
+		if stage.Name == "MapperIntermediate" && (stage.TimedOut != 5 || stage.Errors != 0 || stage.Out != 5) {
+			t.Fatalf("stage [%+v]", stage)
+		}
+	}
+	if pipeline.Error() != nil {
+		t.Fatal(pipeline.Error())
+	}
+
+	pipeline.Close()
+	if pipeline.Context().Err() == nil {
+		t.Fatal("context not cancelled")
+	}
+}
+
+func TestMapperPanic(t *testing.T) {
+	pipeline := NewPipeline()
+
+	slice := NewSliceSource(pipeline, slice09)
+
+	mapper := NewMapperIntermediate(pipeline, slice, func(t int) (int, bool, error) {
+		if t == 5 {
+			panic("five")
+		}
+		return t, true, nil
+	})
+
+	forEach := NewForEachTerminal(pipeline, mapper, func(t int) error { return nil })
+	WaitForTerminal(forEach)
+
+	var panicErr *PanicError
+	if !errors.As(pipeline.Error(), &panicErr) {
+		t.Fatalf("err %v", pipeline.Error())
+	}
+	if panicErr.Stage != "MapperIntermediate" || panicErr.Element != 5 || panicErr.Value != "five" {
+		t.Fatalf("panic %+v", panicErr)
+	}
+
+	for _, stage := range pipeline.Metrics().Snapshot() {
+		if stage.Name == "MapperIntermediate" && stage.Errors != 1 {
+			t.Fatalf("stage [%+v]", stage)
+		}
+	}
 }
@@ -2,12 +2,14 @@ package v3
 
 import (
 	"log/slog"
+	"time"
 )
 
-func NewSliceSource[T any](pipeline Pipeline, in []T) Source[T] {
-	out := NewSource[T](pipeline, 0)
+func NewSliceSource[T any](pipeline Pipeline, in []T, options ...SourceOption) Source[T] {
+	out := newSource[T](pipeline, options)
 
 	logger := NewSourceLogger(out, "SliceSource")
+	metrics := NewSourceMetrics(out, "SliceSource")
 
 	logger.Debug("Created", slog.Int("count", len(in)))
 
@@ -20,14 +22,19 @@ func NewSliceSource[T any](pipeline Pipeline, in []T) Source[T] {
 		for i, t := range in {
 			logger.Debug("Iterator", slog.Int("i", i), slog.Any("t", t))
 
+			start := time.Now()
 			select {
 			case out.Out() <- t:
+				metrics.Sent(start)
 			case <-out.Control():
 				logger.Debug("Out control closed")
 				return
 			case <-pipeline.Control():
 				logger.Debug("Pipeline control closed")
 				return
+			case <-pipeline.Draining():
+				logger.Debug("Pipeline draining")
+				return
 			}
 		}
 	}()
@@ -5,6 +5,10 @@ import (
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"example.com/m/v2/logging"
+	"example.com/m/v2/metrics"
 )
 
 type Source[T any] interface {
@@ -20,6 +24,10 @@ type source[T any] struct {
 	pipeline Pipeline
 	out      chan T
 	outClose *sync.Once
+	// The open sources of the pipeline, if it counts them, otherwise nil.
+	sources *openSources
+	// The timeout of each call to the source's user function, 0 for none.
+	elementTimeout time.Duration
 }
 
 func (source *source[T]) ID() string {
@@ -40,14 +48,58 @@ func (source *source[T]) Close() error {
 		close(source.out)
 
 		source.control.Close()
+
+		if source.sources != nil {
+			source.sources.add(-1)
+		}
 	})
 
 	return nil
 }
 
+// SourceOption configures the source created by a constructor, e.g. NewMapperIntermediate.
+type SourceOption func(*sourceOptions)
+
+type sourceOptions struct {
+	bufferSize     int
+	elementTimeout time.Duration
+}
+
+// Buffer the source's output by size, so it can send up to size elements before they are received.
+func WithBufferSize(size int) SourceOption {
+	return func(options *sourceOptions) {
+		options.bufferSize = size
+	}
+}
+
+// Give each call to the source's user function a context which times out after d, see NewMapperIntermediateContext.
+// An element whose call fails once d has passed is dropped and recorded as timed out in the stage metrics, rather than failing the stage.
+func WithElementTimeout(d time.Duration) SourceOption {
+	return func(options *sourceOptions) {
+		options.elementTimeout = d
+	}
+}
+
+// Return a new source with the given options, buffered by the pipeline's default buffer size unless given WithBufferSize.
+func newSource[T any](pipeline Pipeline, options []SourceOption) *source[T] {
+	o := sourceOptions{bufferSize: pipeline.BufferSize()}
+	for _, option := range options {
+		option(&o)
+	}
+	source := NewSource[T](pipeline, o.bufferSize)
+	source.elementTimeout = o.elementTimeout
+	return source
+}
+
 // Return a new source.
+// The source is counted as open by the pipeline until it is closed, see Shutdown.
 func NewSource[T any](pipeline Pipeline, size int) *source[T] {
-	return &source[T]{NewControl(), NewSourceID(), pipeline, make(chan T, size), &sync.Once{}}
+	source := &source[T]{NewControl(), NewSourceID(), pipeline, make(chan T, size), &sync.Once{}, nil, 0}
+	if counter, ok := pipeline.(sourceCounter); ok {
+		source.sources = counter.openSources()
+		source.sources.add(1)
+	}
+	return source
 }
 
 var sourceID = atomic.Int64{}
@@ -58,6 +110,15 @@ func NewSourceID() string {
 	return strconv.Itoa(int(sourceID.Add(1)))
 }
 
-func NewSourceLogger[T any](source Source[T], group string) *slog.Logger {
-	return Logger().WithGroup(group).With(slog.String("ID", source.ID()))
+// Return the pipeline logger with the given stage name and the source ID.
+func NewSourceLogger[T any](source Source[T], stage string) *slog.Logger {
+	return source.Pipeline().Logger().With(slog.String(logging.StageKey, stage), slog.String(logging.StageIDKey, source.ID()))
+}
+
+// Return the metrics for the given source, registered with the source's pipeline.
+// The occupancy of the source's output buffer is sampled each time the stage sends.
+func NewSourceMetrics[T any](source Source[T], name string) *metrics.Stage {
+	stage := source.Pipeline().Metrics().Stage(source.ID(), name)
+	stage.Buffer(func() int { return len(source.Out()) }, cap(source.Out()))
+	return stage
 }
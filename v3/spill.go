@@ -0,0 +1,282 @@
+package v3
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// Default maximum size of a spill segment file before a new segment is started.
+const DefaultSpillSegmentBytes = 64 << 20
+
+// Encoder writes and reads T's to and from spill segment files.
+// Decode must return io.EOF when there are no more T's.
+type Encoder[T any] interface {
+	Encode(w io.Writer, t T) error
+	Decode(r *bufio.Reader) (T, error)
+}
+
+type jsonEncoder[T any] struct{}
+
+func (jsonEncoder[T]) Encode(w io.Writer, t T) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func (jsonEncoder[T]) Decode(r *bufio.Reader) (T, error) {
+	var t T
+	b, err := r.ReadBytes('\n')
+	if err != nil {
+		if err == io.EOF && len(b) > 0 {
+			return t, io.ErrUnexpectedEOF
+		}
+		return t, err
+	}
+	return t, json.Unmarshal(b, &t)
+}
+
+// Return an encoder which writes each T as a line of JSON.
+func NewJSONEncoder[T any]() Encoder[T] {
+	return jsonEncoder[T]{}
+}
+
+// Counts a writer's bytes.
+type countingWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.count += int64(n)
+	return n, err
+}
+
+type spillSegment struct {
+	path   string
+	file   *os.File
+	writer *bufio.Writer
+	bytes  *countingWriter
+	reader *bufio.Reader
+	count  int
+}
+
+// SpillMetrics is a snapshot of a spill intermediate.
+type SpillMetrics struct {
+	// T's buffered in memory.
+	MemoryCount int64
+	// T's buffered on disk.
+	DiskCount int64
+	// Bytes of the segment files on disk.
+	DiskBytes int64
+	// Segment files on disk.
+	Segments int64
+	// T's written to disk since the intermediate was created.
+	Spilled int64
+}
+
+type spill[T any] struct {
+	*source[T]
+	memoryCount atomic.Int64
+	diskCount   atomic.Int64
+	diskBytes   atomic.Int64
+	segments    atomic.Int64
+	spilled     atomic.Int64
+}
+
+func (spill *spill[T]) Metrics() SpillMetrics {
+	return SpillMetrics{
+		spill.memoryCount.Load(),
+		spill.diskCount.Load(),
+		spill.diskBytes.Load(),
+		spill.segments.Load(),
+		spill.spilled.Load(),
+	}
+}
+
+// Return a new intermediate which buffers up to memory T's in memory, appending any overflow to segment files in a temporary directory under dir.
+// T's are output in the order received, the in source is never blocked by out.
+// If dir is "" the default temporary directory is used, if encoder is nil T's are encoded as JSON.
+// Segment files are removed once replayed and the temporary directory is removed when the intermediate ends.
+func NewSpillIntermediate[T any](pipeline Pipeline, in Source[T], memory int, dir string, encoder Encoder[T], options ...SourceOption) *spill[T] {
+	if encoder == nil {
+		encoder = NewJSONEncoder[T]()
+	}
+	if memory < 1 {
+		memory = 1
+	}
+
+	out := &spill[T]{source: newSource[T](pipeline, options)}
+
+	logger := NewSourceLogger[T](out, "SpillIntermediate")
+
+	go func() {
+		buffer := []T{}
+		segments := []*spillSegment{}
+		segmentID := 0
+		inOpen := true
+
+		tmp, err := os.MkdirTemp(dir, "spill-")
+		if err != nil {
+			pipeline.CloseWithError(err)
+			out.Close()
+			return
+		}
+
+		defer func() {
+			for _, segment := range segments {
+				segment.file.Close()
+			}
+			os.RemoveAll(tmp)
+			out.diskBytes.Store(0)
+			out.segments.Store(0)
+
+			logger.Debug("Closing out", slog.Any("metrics", out.Metrics()))
+			out.Close()
+		}()
+
+		// Finish writing the given segment so it can be read.
+		seal := func(segment *spillSegment) error {
+			if segment.writer == nil {
+				return nil
+			}
+			if err := segment.writer.Flush(); err != nil {
+				return err
+			}
+			if _, err := segment.file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			segment.writer = nil
+			segment.reader = bufio.NewReader(segment.file)
+			return nil
+		}
+
+		write := func(t T) error {
+			var segment *spillSegment
+			if len(segments) > 0 {
+				segment = segments[len(segments)-1]
+			}
+			if segment == nil || segment.writer == nil || segment.bytes.count >= DefaultSpillSegmentBytes {
+				if segment != nil {
+					if err := seal(segment); err != nil {
+						return err
+					}
+				}
+				segmentID++
+				path := filepath.Join(tmp, fmt.Sprintf("%08d.segment", segmentID))
+				file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o600)
+				if err != nil {
+					return err
+				}
+				counter := &countingWriter{file, 0}
+				segment = &spillSegment{path, file, bufio.NewWriter(counter), counter, nil, 0}
+				segments = append(segments, segment)
+				out.segments.Add(1)
+				logger.Debug("New segment", slog.String("path", path))
+			}
+
+			before := segment.bytes.count + int64(segment.writer.Buffered())
+			if err := encoder.Encode(segment.writer, t); err != nil {
+				return err
+			}
+			out.diskBytes.Add(segment.bytes.count + int64(segment.writer.Buffered()) - before)
+			segment.count++
+			out.diskCount.Add(1)
+			out.spilled.Add(1)
+			return nil
+		}
+
+		push := func(t T) error {
+			if len(segments) == 0 && len(buffer) < memory {
+				buffer = append(buffer, t)
+				out.memoryCount.Add(1)
+				return nil
+			}
+			return write(t)
+		}
+
+		// Read up to memory T's from the oldest segment into the buffer, removing the segment once replayed.
+		refill := func() error {
+			segment := segments[0]
+			if err := seal(segment); err != nil {
+				return err
+			}
+			for len(buffer) < memory && segment.count > 0 {
+				t, err := encoder.Decode(segment.reader)
+				if err != nil {
+					return err
+				}
+				buffer = append(buffer, t)
+				segment.count--
+				out.memoryCount.Add(1)
+				out.diskCount.Add(-1)
+			}
+			if segment.count == 0 {
+				segment.file.Close()
+				if err := os.Remove(segment.path); err != nil {
+					return err
+				}
+				out.diskBytes.Add(-segment.bytes.count)
+				out.segments.Add(-1)
+				segments = segments[1:]
+				logger.Debug("Removed segment", slog.String("path", segment.path))
+			}
+			return nil
+		}
+
+		for {
+			if len(buffer) == 0 && len(segments) > 0 {
+				if err := refill(); err != nil {
+					pipeline.CloseWithError(err)
+					return
+				}
+			}
+
+			if !inOpen && len(buffer) == 0 {
+				return
+			}
+
+			var next T
+			var send chan T
+			if len(buffer) > 0 {
+				next = buffer[0]
+				send = out.Out()
+			}
+
+			var receive chan T
+			if inOpen {
+				receive = in.Out()
+			}
+
+			select {
+			case t, ok := <-receive:
+				if !ok {
+					inOpen = false
+					continue
+				}
+				if err := push(t); err != nil {
+					pipeline.CloseWithError(err)
+					return
+				}
+			case send <- next:
+				buffer = buffer[1:]
+				out.memoryCount.Add(-1)
+			case <-out.Control():
+				return
+			case <-pipeline.Control():
+				return
+			}
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,139 @@
+package v3
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSpillIntermediate(t *testing.T) {
+	pipeline := NewPipeline()
+
+	dir := t.TempDir()
+
+	in := make([]int, 1000)
+	for i := range in {
+		in[i] = i
+	}
+
+	slice := NewSliceSource(pipeline, in)
+
+	spill := NewSpillIntermediate[int](pipeline, slice, 10, dir, nil)
+
+	// Nothing is receiving from the spill so the slice is drained to disk.
+	waitForSpilled(t, spill, 990)
+
+	if metrics := spill.Metrics(); metrics.MemoryCount != 10 || metrics.DiskCount != 990 || metrics.DiskBytes == 0 || metrics.Segments != 1 {
+		t.Fatalf("metrics [%+v]", metrics)
+	}
+
+	// The consumer runs on the terminal's goroutine, so the first mismatch is checked once it is done.
+	next := 0
+	mismatch := -1
+	forEach := NewForEachTerminal[int](pipeline, spill, func(i int) error {
+		if i != next && mismatch < 0 {
+			mismatch = i
+		}
+		next++
+		return nil
+	})
+
+	if count := WaitForTerminal(forEach).Value; count != 1000 || mismatch >= 0 {
+		t.Fatalf("count [%v] first out of order [%v]", count, mismatch)
+	}
+	if err := pipeline.Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	if metrics := spill.Metrics(); metrics.DiskBytes != 0 || metrics.Segments != 0 || metrics.DiskCount != 0 {
+		t.Fatalf("metrics [%+v]", metrics)
+	}
+	checkSpillRemoved(t, dir)
+}
+
+// Wait until the spill has written n T's to disk.
+func waitForSpilled[T any](t *testing.T, spill *spill[T], n int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for spill.Metrics().Spilled < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("metrics [%+v]", spill.Metrics())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Fail the test if the spill left anything in dir.
+func checkSpillRemoved(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("entries [%v] [%v]", entries, err)
+	}
+}
+
+var errEncode = errors.New("encode")
+
+// failingEncoder fails to encode the T's from fail onwards.
+type failingEncoder struct {
+	Encoder[int]
+	fail int
+}
+
+func (encoder failingEncoder) Encode(w io.Writer, t int) error {
+	if t >= encoder.fail {
+		return errEncode
+	}
+	return encoder.Encoder.Encode(w, t)
+}
+
+func (encoder failingEncoder) Decode(r *bufio.Reader) (int, error) {
+	return encoder.Encoder.Decode(r)
+}
+
+func TestSpillIntermediateEncoderError(t *testing.T) {
+	pipeline := NewPipeline()
+
+	dir := t.TempDir()
+
+	spill := NewSpillIntermediate[int](pipeline, NewSliceSource(pipeline, slice09), 2, dir, failingEncoder{NewJSONEncoder[int](), 5})
+
+	// Nothing is receiving, so 2 to 4 are spilled and encoding 5 fails.
+	<-spill.Control()
+	if err := pipeline.Error(); !errors.Is(err, errEncode) {
+		t.Fatalf("error [%v]", err)
+	}
+	if metrics := spill.Metrics(); metrics.Spilled != 3 || metrics.Segments != 0 {
+		t.Fatalf("metrics [%+v]", metrics)
+	}
+	checkSpillRemoved(t, dir)
+}
+
+func TestSpillIntermediateCancelled(t *testing.T) {
+	pipeline := NewPipeline()
+
+	dir := t.TempDir()
+
+	in := NewSource[int](pipeline, 0)
+	defer in.Close()
+	spill := NewSpillIntermediate[int](pipeline, in, 2, dir, nil)
+
+	for i := 0; i < 10; i++ {
+		in.Out() <- i
+	}
+	waitForSpilled(t, spill, 8)
+
+	// Closing the pipeline mid-spill removes the segments.
+	pipeline.Close()
+	<-spill.Control()
+	if err := pipeline.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if metrics := spill.Metrics(); metrics.Segments != 0 || metrics.DiskBytes != 0 {
+		t.Fatalf("metrics [%+v]", metrics)
+	}
+	checkSpillRemoved(t, dir)
+}
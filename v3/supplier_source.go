@@ -1,7 +1,21 @@
 package v3
 
-func NewSupplierSource[T any](pipeline Pipeline, f func() (T, error)) *source[T] {
-	source := NewSource[T](pipeline, 0)
+import (
+	"context"
+	"time"
+)
+
+// Return a new source which outputs each T returned by f, until f returns an error.
+func NewSupplierSource[T any](pipeline Pipeline, f func() (T, error), options ...SourceOption) *source[T] {
+	return NewSupplierSourceContext(pipeline, func(context.Context) (T, error) { return f() }, options...)
+}
+
+// Return a new source like NewSupplierSource, calling f with the pipeline's context, or a child context if given WithElementTimeout.
+// A call which times out is skipped.
+func NewSupplierSourceContext[T any](pipeline Pipeline, f func(context.Context) (T, error), options ...SourceOption) *source[T] {
+	source := newSource[T](pipeline, options)
+
+	metrics := NewSourceMetrics(source, "SupplierSource")
 
 	go func() {
 		defer func() {
@@ -9,13 +23,29 @@ func NewSupplierSource[T any](pipeline Pipeline, f func() (T, error)) *source[T]
 		}()
 
 		for {
-			t, err := f()
+			// Stop before calling f once draining, as a T returned by f is always sent.
+			select {
+			case <-pipeline.Draining():
+				return
+			default:
+			}
+
+			var t T
+			called, err := source.call(metrics, nil, func(ctx context.Context) (err error) {
+				t, err = f(ctx)
+				return err
+			})
 			if err != nil {
 				return
 			}
+			if !called {
+				continue
+			}
 
+			start := time.Now()
 			select {
 			case source.out <- t:
+				metrics.Sent(start)
 			case <-source.Control():
 				return
 			case <-pipeline.Control():
@@ -1,62 +1,119 @@
 package v3
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"time"
+
+	"example.com/m/v2/logging"
 )
 
-type Terminal[T any] interface {
-	Result() []Optional[T]
-	Count() int
-}
+// Reason is why WaitForTerminal returned.
+type Reason string
+
+const (
+	// The source closed with the pipeline open.
+	ReasonCompleted Reason = "completed"
+	// The pipeline was closed without an error, or the context was cancelled, before the source closed.
+	ReasonCancelled Reason = "cancelled"
+	// The pipeline was closed with an error.
+	ReasonFailed Reason = "failed"
+	// The context passed its deadline before the source closed.
+	ReasonTimedOut Reason = "timed out"
+)
 
-type terminal[T any] struct {
-	result []Optional[T]
+// Result is the outcome of a terminal, returned by WaitForTerminal.
+type Result[R any] struct {
+	// The last R received, the zero R if none was received.
+	// A counting terminal such as NewForEachTerminal sends one R, the count of elements it consumed.
+	Value R
+	// The count of R's received from the terminal, not of the elements it consumed.
+	Received int
+	Reason   Reason
+	// The error the pipeline was closed with, or the context error, nil once completed.
+	Err   error
+	Start time.Time
+	End   time.Time
 }
 
-func (terminal *terminal[T]) Result() []Optional[T] {
-	return terminal.result
+// Return the value and whether one was received, rather than the zero R.
+func (result Result[R]) Get() (R, bool) {
+	return result.Value, result.Received > 0
 }
 
-func (terminal *terminal[T]) Count() int {
-	return len(terminal.result)
+func (result Result[R]) Duration() time.Duration {
+	return result.End.Sub(result.Start)
 }
 
-// func (terminal *terminal[T]) String() string {
-// 	r := strings.Builder{}
-// 	for i, e := range terminal.result {
-// 		r.WriteString(fmt.Sprintf("%d [%v]\n", i, e))
-// 	}
-// 	return r.String()
-// }
+func (result Result[R]) String() string {
+	s := fmt.Sprintf("%s received %d duration %v", result.Reason, result.Received, result.Duration())
+	if result.Received > 0 {
+		s += fmt.Sprintf(" value [%v]", result.Value)
+	}
+	if result.Err != nil {
+		s += fmt.Sprintf(" error: %v", result.Err)
+	}
+	return s
+}
 
-func NewTerminal[T any]() *terminal[T] {
-	return &terminal[T]{}
+// Block for the given terminal and return its Result.
+// This will receive on the Source[R], keeping the last R.
+// It will return when the Source[R] is closed or the Pipeline Control is closed.
+func WaitForTerminal[R any](source Source[R]) Result[R] {
+	return WaitForTerminalContext(context.Background(), source)
 }
 
-// Block for the given terminal and return a Terminal[T].
-// This will receive on the Source[T] and add each T to the Terminal[T].
-// It will return when the Source[T] is closed or the Pipeline Control is closed.
-func WaitForTerminal[T any](source Source[T]) Terminal[T] {
-	result := NewTerminal[T]()
+// Block for the given terminal like WaitForTerminal, also returning when ctx is done.
+// The pipeline is left open when ctx is done, close it to stop the source.
+func WaitForTerminalContext[R any](ctx context.Context, source Source[R]) Result[R] {
+	result := Result[R]{Start: time.Now()}
 
 	pipeline := source.Pipeline()
-	logger := Logger().WithGroup("WaitForTerminal").With(slog.String("ID", NewSourceID()))
+	logger := pipeline.Logger().With(slog.String(logging.StageKey, "WaitForTerminal"), slog.String(logging.StageIDKey, NewSourceID()))
 
 	defer func() {
-		logger.Debug("Returning", slog.Int("count", result.Count()))
+		logger.Debug("Returning", slog.String("result", result.String()))
 	}()
 
+	// Return the result, why the pipeline ended it.
+	end := func(reason Reason) Result[R] {
+		result.End = time.Now()
+		result.Reason = reason
+		if err := pipeline.Error(); err != nil {
+			result.Reason = ReasonFailed
+			result.Err = err
+		}
+		return result
+	}
+
 	for {
 		select {
-		case t, ok := <-source.Out():
+		case r, ok := <-source.Out():
 			if !ok {
 				logger.Debug("In closed")
-				return result
+				select {
+				case <-pipeline.Control():
+					return end(ReasonCancelled)
+				default:
+					return end(ReasonCompleted)
+				}
 			}
 
-			result.result = append(result.result, NewOptional[T](&t))
+			result.Value = r
+			result.Received++
 		case <-pipeline.Control():
 			logger.Debug("Pipeline control closed")
+			return end(ReasonCancelled)
+		case <-ctx.Done():
+			logger.Debug("Context done")
+			result.End = time.Now()
+			result.Reason = ReasonCancelled
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				result.Reason = ReasonTimedOut
+			}
+			result.Err = ctx.Err()
 			return result
 		}
 	}
@@ -0,0 +1,66 @@
+package v3
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTerminalResult(t *testing.T) {
+	pipeline := NewPipeline()
+
+	result := WaitForTerminal(NewForEachTerminal(pipeline, NewSliceSource(pipeline, slice09), func(_ int) error { return nil }))
+	if count, ok := result.Get(); !ok || count != 10 || result.Received != 1 || result.Reason != ReasonCompleted || result.Err != nil || result.Duration() < 0 {
+		t.Fatalf("result [%v]", result)
+	}
+}
+
+func TestTerminalFailed(t *testing.T) {
+	pipeline := NewPipeline()
+
+	errConsume := errors.New("consume")
+	result := WaitForTerminal(NewForEachTerminal(pipeline, NewSliceSource(pipeline, slice09), func(t int) error {
+		if t == 5 {
+			return errConsume
+		}
+		return nil
+	}))
+	if _, ok := result.Get(); ok || result.Reason != ReasonFailed || !errors.Is(result.Err, errConsume) {
+		t.Fatalf("result [%v]", result)
+	}
+}
+
+func TestTerminalCancelled(t *testing.T) {
+	pipeline := NewPipeline()
+
+	in := NewSource[int](pipeline, 0)
+	forEach := NewForEachTerminal(pipeline, in, func(_ int) error { return nil })
+	pipeline.Close()
+
+	if result := WaitForTerminal(forEach); result.Reason != ReasonCancelled || result.Err != nil {
+		t.Fatalf("result [%v]", result)
+	}
+	in.Close()
+}
+
+func TestTerminalContext(t *testing.T) {
+	pipeline := NewPipeline()
+	defer pipeline.Close()
+
+	in := NewSource[int](pipeline, 0)
+	defer in.Close()
+	forEach := NewForEachTerminal(pipeline, in, func(_ int) error { return nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if result := WaitForTerminalContext(ctx, forEach); result.Reason != ReasonTimedOut || !errors.Is(result.Err, context.DeadlineExceeded) {
+		t.Fatalf("result [%v]", result)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if result := WaitForTerminalContext(ctx, forEach); result.Reason != ReasonCancelled || !errors.Is(result.Err, context.Canceled) {
+		t.Fatalf("result [%v]", result)
+	}
+}
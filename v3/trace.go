@@ -0,0 +1,11 @@
+package v3
+
+import "example.com/m/v2/tracing"
+
+// Return a new intermediate which starts a trace for each in T.
+// Wrap the user functions of the following stages with the tracing package, e.g. tracing.MapOK for NewMapperIntermediate and tracing.Consumer for NewForEachTerminal, to record a span per stage.
+func NewTraceIntermediate[T any](pipeline Pipeline, in Source[T], tracer *tracing.Tracer, options ...SourceOption) *source[tracing.Traced[T]] {
+	return NewMapperIntermediate(pipeline, in, func(t T) (tracing.Traced[T], bool, error) {
+		return tracing.Start(tracer, t), true, nil
+	}, options...)
+}
@@ -0,0 +1,29 @@
+package v3
+
+import (
+	"testing"
+
+	"example.com/m/v2/tracing"
+)
+
+func TestTraceIntermediate(t *testing.T) {
+	pipeline := NewPipeline()
+
+	exporter := tracing.NewMemoryExporter()
+	tracer := tracing.NewTracer(nil, exporter)
+
+	slice := NewSliceSource(pipeline, slice09)
+
+	trace := NewTraceIntermediate(pipeline, slice, tracer)
+
+	mapper := NewMapperIntermediate(pipeline, trace, tracing.MapOK(tracer, "Mapper", func(t int) (int, bool, error) { return t * 10, t%2 == 0, nil }))
+
+	forEach := NewForEachTerminal(pipeline, mapper, tracing.Consumer(tracer, "ForEach", func(t int) error { return nil }))
+
+	WaitForTerminal(forEach)
+
+	// Mapper and element spans for each T, plus a ForEach span for the 5 even T's.
+	if spans := exporter.Spans(); len(spans) != 25 {
+		t.Fatalf("spans [%v]", len(spans))
+	}
+}
@@ -1,8 +1,20 @@
 package v3
 
-// Return a new intermediate which wraps T in a sequence.
-func NewMapperIntermediate[T, R any](pipeline Pipeline, in Source[T], f func(T) (R, bool, error)) *source[R] {
-	source := NewSource[R](pipeline, 0)
+import (
+	"context"
+	"time"
+)
+
+// Return a new intermediate which maps each in T to R using f, dropping T when f returns false.
+func NewMapperIntermediate[T, R any](pipeline Pipeline, in Source[T], f func(T) (R, bool, error), options ...SourceOption) *source[R] {
+	return NewMapperIntermediateContext(pipeline, in, func(_ context.Context, t T) (R, bool, error) { return f(t) }, options...)
+}
+
+// Return a new intermediate like NewMapperIntermediate, calling f with the pipeline's context, or a child context if given WithElementTimeout.
+func NewMapperIntermediateContext[T, R any](pipeline Pipeline, in Source[T], f func(context.Context, T) (R, bool, error), options ...SourceOption) *source[R] {
+	source := newSource[R](pipeline, options)
+
+	metrics := NewSourceMetrics(source, "MapperIntermediate")
 
 	go func() {
 		defer func() {
@@ -10,28 +22,39 @@ func NewMapperIntermediate[T, R any](pipeline Pipeline, in Source[T], f func(T)
 		}()
 
 		for {
+			start := time.Now()
 			select {
 			case t, ok := <-in.Out():
 				if !ok {
 					return
 				}
+				metrics.Received(start)
 
-				r, ok, err := f(t)
+				var r R
+				called, err := source.call(metrics, t, func(ctx context.Context) (err error) {
+					r, ok, err = f(ctx, t)
+					return err
+				})
 				if err != nil {
+					metrics.Done()
 					return
 				}
-				if !ok {
+				if !called || !ok {
+					metrics.Done()
 					continue
 				}
 
+				start = time.Now()
 				select {
 				case source.Out() <- r:
-				case <-in.Control():
+					metrics.Sent(start)
+					metrics.Done()
+				case <-source.Control():
 					return
 				case <-pipeline.Control():
 					return
 				}
-			case <-in.Control():
+			case <-source.Control():
 				return
 			case <-pipeline.Control():
 				return
@@ -0,0 +1,28 @@
+package v3
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMapperIntermediateInputClosed(t *testing.T) {
+	pipeline := NewPipeline()
+
+	called := make(chan struct{})
+	in := NewSource[int](pipeline, 1)
+	mapper := NewMapperIntermediate(pipeline, in, func(t int) (int, bool, error) {
+		close(called)
+		return t * 10, true, nil
+	})
+
+	in.Out() <- 1
+	in.Close()
+
+	// The mapper is blocked sending once its input has closed.
+	<-called
+	time.Sleep(10 * time.Millisecond)
+
+	if r, ok := <-mapper.Out(); !ok || r != 10 {
+		t.Fatalf("r [%v] ok [%v]", r, ok)
+	}
+}